@@ -19,12 +19,29 @@ func main() {
 	flag.Parse()
 
 	// читаем конфиг
-	cfg, err := config.New(configPath, lg)
+	cfg, err := config.New(configPath)
 	if err != nil {
 		lg.Fatal("read config error: %v", err)
 
 		return
 	}
 
+	// формат и уровень проверены при чтении конфига. Применяются до вывода конфига, чтобы он выводился уже с ними
+	if err = lg.SetFormat(cfg.LogFormat); err != nil {
+		lg.Fatal("logger error: %v", err)
+
+		return
+	}
+
+	level, err := logger.ParseLevel(cfg.LogLevel)
+	if err != nil {
+		lg.Fatal("logger error: %v", err)
+
+		return
+	}
+	lg.SetLevel(level)
+
+	cfg.Print(lg)
+
 	app.Start(cfg, lg)
 }
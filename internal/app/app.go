@@ -2,69 +2,304 @@
 package app
 
 import (
+	"context"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/n-r-w/log-server-v2/internal/config"
 	"github.com/n-r-w/log-server-v2/internal/domain/usecase"
 	"github.com/n-r-w/log-server-v2/internal/presentation/http/router"
+	"github.com/n-r-w/log-server-v2/internal/presentation/syslog"
+	"github.com/n-r-w/log-server-v2/internal/repo/clickhouse"
+	"github.com/n-r-w/log-server-v2/internal/repo/external"
 	"github.com/n-r-w/log-server-v2/internal/repo/psql"
+	"github.com/n-r-w/log-server-v2/internal/repo/segment"
 	"github.com/n-r-w/log-server-v2/internal/repo/wbuf"
 	"github.com/n-r-w/log-server-v2/pkg/httpserver"
 	"github.com/n-r-w/log-server-v2/pkg/logger"
+	"github.com/n-r-w/log-server-v2/pkg/oidc"
 	"github.com/n-r-w/log-server-v2/pkg/postgres"
+	"github.com/n-r-w/log-server-v2/pkg/tools"
+	"github.com/n-r-w/log-server-v2/pkg/tracing"
 )
 
 func Start(cfg *config.Config, logger logger.Interface) {
-	// создаем доступ к БД
+	// трассировка запросов
+	traces, err := tracing.New(
+		tracing.Exporter(cfg.TraceExporter),
+		tracing.OTLPEndpoint(cfg.TraceOTLPEndpoint),
+		tracing.ServiceName(cfg.TraceServiceName),
+		tracing.SampleRatio(cfg.TraceSampleRatio))
+	if err != nil {
+		logger.Error("tracing error: %v", err)
+
+		return
+	}
+	defer func() {
+		// отправляем трассировки, накопленные до остановки
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*time.Duration(cfg.HttpShutdownTimeout))
+		defer cancel()
+		if err := traces.Shutdown(ctx); err != nil {
+			logger.Error("tracing shutdown error: %v", err)
+		}
+	}()
+
+	// создаем доступ к БД. Она нужна при любом хранилище журнала: в ней пользователи, сессии и аудит
 	pg, err := postgres.New(cfg.DatabaseURL, logger,
 		postgres.MaxConns(cfg.MaxDbSessions),
-		postgres.MaxMaxConnIdleTime(time.Duration(cfg.MaxDbSessionIdleTimeSec)*time.Second))
+		postgres.MaxMaxConnIdleTime(time.Duration(cfg.MaxDbSessionIdleTimeSec)*time.Second),
+		postgres.QueryTimeout(time.Duration(cfg.DbQueryTimeoutSec)*time.Second),
+		postgres.ConnTimeout(time.Duration(cfg.DbConnectTimeoutSec)*time.Second),
+		postgres.StatementTimeout(time.Duration(cfg.DbStatementTimeoutSec)*time.Second),
+		postgres.BreakerThreshold(cfg.DbBreakerFailures),
+		postgres.BreakerRetry(time.Duration(cfg.DbBreakerRetrySec)*time.Second),
+		postgres.Replicas(cfg.DatabaseReplicaURLs),
+		postgres.MaxReplicaLag(time.Duration(cfg.DatabaseReplicaMaxLagSec)*time.Second),
+		postgres.ReplicaCheckInterval(time.Duration(cfg.DatabaseReplicaCheckIntervalSec)*time.Second),
+		postgres.Tracing(!strings.EqualFold(cfg.TraceExporter, tracing.ExporterNone)))
 	if err != nil {
 		logger.Error("postgress error: %v", err)
 
 		return
 	}
+	defer pg.Close()
+
+	// хэширование паролей
+	hasher, err := tools.NewPasswordHasher(cfg.PasswordHashAlgorithm,
+		tools.BcryptCost(cfg.BcryptCost),
+		tools.Argon2Params(uint32(cfg.Argon2Memory), uint32(cfg.Argon2Time), uint8(cfg.Argon2Threads)))
+	if err != nil {
+		logger.Error("password hasher error: %v", err)
+
+		return
+	}
 
 	// создаем репозитории
-	userRepo := psql.NewUser(pg, logger, uint64(cfg.SuperAdminID), cfg.SuperAdminLogin, cfg.SuperPassword,
-		cfg.PasswordRegex, cfg.PasswordRegexError)
-	logRepo := psql.NewLog(pg, cfg.MaxLogRecordsResult)
+	userRepo := psql.NewUser(pg, hasher, cfg.PasswordRegex, cfg.PasswordRegexError)
+	var logRepo usecase.LogInterface
+	switch strings.ToLower(cfg.LogStorage) {
+	case config.LogStorageFile:
+		fileRepo, err := segment.New(cfg.LogFileDir, cfg.MaxLogRecordsResult, logger,
+			segment.SegmentSize(int64(cfg.LogFileSegmentSizeMb)<<20))
+		if err != nil {
+			logger.Error("log storage error: %v", err)
+
+			return
+		}
+		// закрывается после остановки буфера записи
+		defer func() {
+			if err := fileRepo.Close(); err != nil {
+				logger.Error("log storage close error: %v", err)
+			}
+		}()
+		logRepo = fileRepo
+	case config.LogStorageClickHouse:
+		clickhouseRepo, err := clickhouse.NewLog(cfg.ClickHouseURL, cfg.MaxLogRecordsResult,
+			time.Duration(cfg.LogInsertTimeoutSec)*time.Second,
+			time.Duration(cfg.LogFindTimeoutSec)*time.Second,
+			clickhouse.Database(cfg.ClickHouseDatabase),
+			clickhouse.Credentials(cfg.ClickHouseUser, cfg.ClickHousePassword),
+			clickhouse.MaxConns(cfg.MaxDbSessions))
+		if err != nil {
+			logger.Error("log storage error: %v", err)
+
+			return
+		}
+		logRepo = clickhouseRepo
+	default:
+		logRepo = psql.NewLog(pg, cfg.MaxLogRecordsResult,
+			time.Duration(cfg.LogInsertTimeoutSec)*time.Second,
+			time.Duration(cfg.LogFindTimeoutSec)*time.Second)
+	}
+	sessionRepo := psql.NewSession(pg)
+	loginFailureRepo := psql.NewLoginFailure(pg)
+	auditRepo := psql.NewAudit(pg, cfg.MaxLogRecordsResult)
+	twoFactorRepo := psql.NewTwoFactor(pg)
+	loginChallengeRepo := psql.NewLoginChallenge(pg)
 
 	// создаем буфер для асинхронной записи в БД
 	buffer := wbuf.NewDispatcher(cfg.MaxDbSessions, cfg.RateLimit, cfg.RateLimitBurst, logRepo, logger)
 
+	// собственные предупреждения и ошибки сервера пишем в его же журнал. Всё, что создано выше (БД и буфер),
+	// использует исходный журнал, поэтому ошибки записи в БД не порождают новых записей
+	stopBuffer := buffer.Stop
+	if cfg.SelfLog {
+		selfLogger := wbuf.NewSelfLogger(buffer, logger)
+		logger = selfLogger
+		stopBuffer = func() {
+			selfLogger.Stop()
+			buffer.Stop()
+		}
+	}
+
+	// проверка токенов внешних провайдеров OIDC, если они заданы
+	externalAuth := usecase.ExternalAuth{
+		Tokens:              nil,
+		TokensAutoCreate:    cfg.OIDCAutoCreateUsers,
+		Passwords:           nil,
+		PasswordsAutoCreate: cfg.LDAPAutoCreateUsers,
+	}
+	if len(cfg.OIDCProviders) > 0 {
+		providers := make([]oidc.Provider, 0, len(cfg.OIDCProviders))
+		for _, p := range cfg.OIDCProviders {
+			providers = append(providers, oidc.Provider{Issuer: p.Issuer, Audience: p.Audience, JWKS: p.JWKS})
+		}
+
+		verifier, err := oidc.New(providers, oidc.Claims(cfg.OIDCLoginClaim, cfg.OIDCNameClaim, cfg.OIDCRolesClaim))
+		if err != nil {
+			logger.Error("oidc error: %v", err)
+			stopBuffer()
+
+			return
+		}
+
+		externalAuth.Tokens = external.NewTokenVerifier(verifier, cfg.OIDCAdminRoles)
+	}
+
+	// проверка паролей через LDAP, если он задан. Локальные пользователи проверяются как обычно
+	if cfg.LDAPURL != "" {
+		ldapVerifier, err := external.NewPasswordVerifier(external.LDAPConfig{
+			URL:                cfg.LDAPURL,
+			StartTLS:           cfg.LDAPStartTLS,
+			InsecureSkipVerify: cfg.LDAPInsecureSkipVerify,
+			BindDN:             cfg.LDAPBindDN,
+			BindPassword:       cfg.LDAPBindPassword,
+			BaseDN:             cfg.LDAPBaseDN,
+			UserFilter:         cfg.LDAPUserFilter,
+			LoginAttribute:     cfg.LDAPLoginAttribute,
+			NameAttribute:      cfg.LDAPNameAttribute,
+			GroupAttribute:     cfg.LDAPGroupAttribute,
+			AdminGroups:        cfg.LDAPAdminGroups,
+			UserGroups:         cfg.LDAPUserGroups,
+			Timeout:            time.Duration(cfg.LDAPTimeoutSec) * time.Second,
+		})
+		if err != nil {
+			logger.Error("ldap error: %v", err)
+			stopBuffer()
+
+			return
+		}
+
+		externalAuth.Passwords = ldapVerifier
+	}
+
 	// создаем сценарии
-	userCase := usecase.NewUserCase(userRepo, uint64(cfg.SuperAdminID))
+	auditCase := usecase.NewAuditCase(auditRepo, logger)
+	loginGuard := usecase.NewLoginGuard(loginFailureRepo, loginLimits(cfg), auditCase)
+	userCase, err := usecase.NewUserCase(userRepo, sessionRepo, loginGuard, auditCase, hasher, externalAuth)
+	if err != nil {
+		logger.Error("user usecase error: %v", err)
+		stopBuffer()
+
+		return
+	}
+
+	// при первом запуске создаем админа
+	created, err := userCase.CreateAdmin(context.Background(), cfg.SuperAdminLogin, cfg.SuperPassword)
+	if err != nil {
+		logger.Error("admin user creation error: %v", err)
+		stopBuffer()
+
+		return
+	}
+	if created {
+		logger.Warn("admin user %s created, change its password", cfg.SuperAdminLogin)
+	}
+	sessionCase := usecase.NewSessionCase(sessionRepo, userRepo, auditCase)
+	twoFactorCase := usecase.NewTwoFactorCase(twoFactorRepo, loginChallengeRepo, userRepo, loginGuard, auditCase,
+		usecase.TwoFactorSettings{
+			Issuer:       cfg.TwoFactorIssuer,
+			ChallengeAge: time.Duration(cfg.TwoFactorChallengeAgeSec) * time.Second,
+			MaxAttempts:  cfg.TwoFactorMaxAttempts,
+		})
 	logCase := usecase.NewLogCase(buffer) // вместо logRepo передаем буфер, т.к. он реализует интерфейс usecase.LogInterface
+	healthCase := usecase.NewHealthCase(psql.NewHealth(pg), buffer)
 
 	// создаем маршрутизатор запросов
-	rt := router.NewRouter(logger, userCase, logCase, cfg.SessionEncriptionKey, uint64(cfg.SuperAdminID), cfg.SessionAge, cfg.MaxLogRecordsResult)
+	rt := router.NewRouter(logger, userCase, sessionCase, logCase, auditCase, twoFactorCase, healthCase, cfg.SessionEncriptionKey, cfg.SessionAge, cfg.MaxLogRecordsResult,
+		cfg.MaxRequestSize, cfg.MaxDecompressedSize,
+		router.CookieSecure(cfg.CookieSecure),
+		router.CookieHTTPOnly(cfg.CookieHTTPOnly),
+		router.CookieSameSite(cfg.CookieSameSite),
+		router.CSRFProtection(cfg.CSRFProtection),
+		router.CORSAllowedOrigins(cfg.CORSAllowedOrigins),
+		router.CORSAllowCredentials(cfg.CORSAllowCredentials),
+		router.ClientCertificateLogin(cfg.TLSClientCertLogin),
+		router.PreviousSessionKeys(cfg.SessionPreviousKeys),
+	)
 
 	// запускаем http сервер
-	httpServer := httpserver.New(rt.Handler(), logger,
+	httpOptions := []httpserver.Option{
 		httpserver.Address(cfg.Host, cfg.Port),
-		httpserver.ReadTimeout(time.Second*time.Duration(cfg.HttpReadTimeout)),
-		httpserver.WriteTimeout(time.Second*time.Duration(cfg.HttpWriteTimeout)),
-		httpserver.ShutdownTimeout(time.Second*time.Duration(cfg.HttpShutdownTimeout)),
-	)
+		httpserver.ReadTimeout(time.Second * time.Duration(cfg.HttpReadTimeout)),
+		httpserver.WriteTimeout(time.Second * time.Duration(cfg.HttpWriteTimeout)),
+		httpserver.ShutdownTimeout(time.Second * time.Duration(cfg.HttpShutdownTimeout)),
+	}
+	if cfg.TLSCertFile != "" {
+		httpOptions = append(httpOptions, httpserver.TLS(cfg.TLSCertFile, cfg.TLSKeyFile))
+	}
+	if cfg.TLSClientCAFile != "" {
+		httpOptions = append(httpOptions, httpserver.ClientCA(cfg.TLSClientCAFile, cfg.TLSClientCertRequired))
+	}
+	httpServer := httpserver.New(rt.Handler(), logger, httpOptions...)
+
+	// запускаем прием syslog, если он включен. Записи идут через тот же сценарий, что и для http,
+	// поэтому на них действует то же ограничение скорости
+	var syslogServer *syslog.Server
+	var syslogNotify <-chan error
+	if cfg.SyslogUDPAddress != "" || cfg.SyslogTCPAddress != "" {
+		syslogServer = syslog.New(logCase, logger,
+			syslog.UDPAddress(cfg.SyslogUDPAddress),
+			syslog.TCPAddress(cfg.SyslogTCPAddress),
+		)
+		syslogNotify = syslogServer.Notify()
+	}
+
+	// по SIGHUP перечитываем конфиг и применяем настройки, которые можно менять без перезапуска
+	settings := &runtimeSettings{
+		logger:         logger,
+		rateLimit:      buffer,
+		passwordPolicy: userRepo,
+		loginLimits:    userCase,
+	}
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
 
 	// и ждем от него сигнала
 	interrupt := make(chan os.Signal, 1)
 	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
 
-	select {
-	case <-interrupt:
-		logger.Info("shutdown, timeout %d ...", cfg.HttpShutdownTimeout)
-	case err = <-httpServer.Notify():
-		logger.Error("http server notification: %v", err)
+wait:
+	for {
+		select {
+		case <-hangup:
+			logger.Info("SIGHUP received, reloading config")
+			settings.reload(cfg)
+		case <-interrupt:
+			logger.Info("shutdown, timeout %d ...", cfg.HttpShutdownTimeout)
+
+			break wait
+		case err = <-httpServer.Notify():
+			logger.Error("http server notification: %v", err)
+
+			break wait
+		case err = <-syslogNotify:
+			logger.Error("syslog server notification: %v", err)
+
+			break wait
+		}
 	}
+	signal.Stop(hangup)
 
 	// ждем завершения
 	err = httpServer.Shutdown()
-	buffer.Stop()
+	if syslogServer != nil {
+		syslogServer.Shutdown()
+	}
+	stopBuffer()
 	if err != nil {
 		logger.Error("shutdown error: %v", err)
 	} else {
@@ -0,0 +1,74 @@
+package app
+
+import (
+	"time"
+
+	"github.com/n-r-w/log-server-v2/internal/config"
+	"github.com/n-r-w/log-server-v2/internal/domain/usecase"
+	"github.com/n-r-w/log-server-v2/pkg/logger"
+)
+
+// Получатели настроек, которые можно изменить без перезапуска сервера
+type (
+	rateLimitSetter interface {
+		SetRateLimit(rateLimit int, rateLimitBurst int)
+	}
+
+	passwordPolicySetter interface {
+		SetPasswordPolicy(passwordRegex string, passwordRegexError string)
+	}
+
+	loginLimitsSetter interface {
+		SetLoginLimits(limits usecase.LoginLimits)
+	}
+)
+
+// runtimeSettings Настройки, которые применяются на ходу при получении SIGHUP.
+// Остальные изменения в конфиге вступают в силу только после перезапуска
+type runtimeSettings struct {
+	logger         logger.Interface
+	rateLimit      rateLimitSetter
+	passwordPolicy passwordPolicySetter
+	loginLimits    loginLimitsSetter
+}
+
+// apply Применить настройки из конфига
+func (s *runtimeSettings) apply(cfg *config.Config) {
+	setLogLevel(s.logger, cfg.LogLevel)
+	s.rateLimit.SetRateLimit(cfg.RateLimit, cfg.RateLimitBurst)
+	s.passwordPolicy.SetPasswordPolicy(cfg.PasswordRegex, cfg.PasswordRegexError)
+	s.loginLimits.SetLoginLimits(loginLimits(cfg))
+}
+
+// reload Перечитать конфиг и применить настройки. При ошибке продолжают действовать текущие
+func (s *runtimeSettings) reload(cfg *config.Config) {
+	newCfg, err := cfg.Reload()
+	if err != nil {
+		s.logger.Error("config reload error, current settings are kept: %v", err)
+
+		return
+	}
+
+	s.apply(newCfg)
+
+	s.logger.Info("config reloaded: LOG_LEVEL: %s, RATE_LIMIT: %d, RATE_LIMIT_BURST: %d, PASSWORD_REGEX: %s",
+		newCfg.LogLevel, newCfg.RateLimit, newCfg.RateLimitBurst, newCfg.PasswordRegex)
+	s.logger.Info("config reloaded: LOGIN_MAX_FAILURES: %d, LOGIN_MAX_ADDRESS_FAILURES: %d, LOGIN_DELAY_MS: %d, LOGIN_LOCKOUT_SEC: %d",
+		newCfg.LoginMaxFailures, newCfg.LoginMaxAddressFailures, newCfg.LoginDelayMs, newCfg.LoginLockoutSec)
+}
+
+func setLogLevel(l logger.Interface, name string) {
+	// уровень проверен при чтении конфига
+	if level, err := logger.ParseLevel(name); err == nil {
+		l.SetLevel(level)
+	}
+}
+
+func loginLimits(cfg *config.Config) usecase.LoginLimits {
+	return usecase.LoginLimits{
+		MaxLoginFailures:   cfg.LoginMaxFailures,
+		MaxAddressFailures: cfg.LoginMaxAddressFailures,
+		Delay:              time.Duration(cfg.LoginDelayMs) * time.Millisecond,
+		Lockout:            time.Duration(cfg.LoginLockoutSec) * time.Second,
+	}
+}
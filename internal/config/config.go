@@ -5,54 +5,171 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 
 	"github.com/BurntSushi/toml"
 	"github.com/n-r-w/log-server-v2/pkg/logger"
+	"github.com/n-r-w/log-server-v2/pkg/tracing"
 )
 
 // Config logserver.toml
 type Config struct {
-	SuperAdminID            int
-	Host                    string `toml:"HOST"`
-	Port                    string `toml:"PORT"`
-	SuperAdminLogin         string `toml:"SUPERADMIN_LOGIN"`
-	SuperPassword           string `toml:"SUPERADMIN_PASSWORD"`
-	SessionAge              int    `toml:"SESSION_AGE"`
-	LogLevel                string `toml:"LOG_LEVEL"`
-	DatabaseURL             string `toml:"DATABASE_URL"`
-	SessionEncriptionKey    string `toml:"SESSION_ENCRYPTION_KEY"`
-	MaxDbSessions           int    `toml:"MAX_DB_SESSIONS"`
-	MaxDbSessionIdleTimeSec int    `toml:"MAX_DB_SESSION_IDLE_TIME_SEC"`
-	MaxLogRecordsResult     int    `toml:"MAX_LOG_RECORDS_RESULT"`
-	PasswordRegex           string `toml:"PASSWORD_REGEX"`
-	PasswordRegexError      string `toml:"PASSWORD_REGEX_ERROR"`
-	HttpReadTimeout         int    `toml:"HTTP_READ_TIMEOUT"`
-	HttpWriteTimeout        int    `toml:"HTTP_WRITE_TIMEOUT"`
-	HttpShutdownTimeout     int    `toml:"HTTP_SHUTDOWN_TIMEOUT"`
-	RateLimit               int    `toml:"RATE_LIMIT"`
-	RateLimitBurst          int    `toml:"RATE_LIMIT_BURST"`
+	Host                    string   `toml:"HOST"`
+	Port                    string   `toml:"PORT"`
+	SuperAdminLogin         string   `toml:"SUPERADMIN_LOGIN"`
+	SuperPassword           string   `toml:"SUPERADMIN_PASSWORD"`
+	SessionAge              int      `toml:"SESSION_AGE"`
+	LogLevel                string   `toml:"LOG_LEVEL"`
+	LogFormat               string   `toml:"LOG_FORMAT"`
+	DatabaseURL             string   `toml:"DATABASE_URL"`
+	SessionEncriptionKey    string   `toml:"SESSION_ENCRYPTION_KEY"`
+	MaxDbSessions           int      `toml:"MAX_DB_SESSIONS"`
+	MaxDbSessionIdleTimeSec int      `toml:"MAX_DB_SESSION_IDLE_TIME_SEC"`
+	MaxLogRecordsResult     int      `toml:"MAX_LOG_RECORDS_RESULT"`
+	PasswordRegex           string   `toml:"PASSWORD_REGEX"`
+	PasswordRegexError      string   `toml:"PASSWORD_REGEX_ERROR"`
+	HttpReadTimeout         int      `toml:"HTTP_READ_TIMEOUT"`
+	HttpWriteTimeout        int      `toml:"HTTP_WRITE_TIMEOUT"`
+	HttpShutdownTimeout     int      `toml:"HTTP_SHUTDOWN_TIMEOUT"`
+	RateLimit               int      `toml:"RATE_LIMIT"`
+	RateLimitBurst          int      `toml:"RATE_LIMIT_BURST"`
+	MaxRequestSize          int      `toml:"MAX_REQUEST_SIZE"`
+	MaxDecompressedSize     int      `toml:"MAX_DECOMPRESSED_REQUEST_SIZE"`
+	PasswordHashAlgorithm   string   `toml:"PASSWORD_HASH_ALGORITHM"`
+	BcryptCost              int      `toml:"BCRYPT_COST"`
+	Argon2Memory            int      `toml:"ARGON2_MEMORY"`
+	Argon2Time              int      `toml:"ARGON2_TIME"`
+	Argon2Threads           int      `toml:"ARGON2_THREADS"`
+	LoginMaxFailures        int      `toml:"LOGIN_MAX_FAILURES"`
+	LoginMaxAddressFailures int      `toml:"LOGIN_MAX_ADDRESS_FAILURES"`
+	LoginDelayMs            int      `toml:"LOGIN_DELAY_MS"`
+	LoginLockoutSec         int      `toml:"LOGIN_LOCKOUT_SEC"`
+	CookieSecure            bool     `toml:"COOKIE_SECURE"`
+	CookieHTTPOnly          bool     `toml:"COOKIE_HTTP_ONLY"`
+	CookieSameSite          string   `toml:"COOKIE_SAME_SITE"`
+	CSRFProtection          bool     `toml:"CSRF_PROTECTION"`
+	CORSAllowedOrigins      []string `toml:"CORS_ALLOWED_ORIGINS"`
+	CORSAllowCredentials    bool     `toml:"CORS_ALLOW_CREDENTIALS"`
+	SyslogUDPAddress        string   `toml:"SYSLOG_UDP_ADDRESS"`
+	SyslogTCPAddress        string   `toml:"SYSLOG_TCP_ADDRESS"`
+	SelfLog                 bool     `toml:"SELF_LOG"`
+
+	OIDCProviders       []OIDCProvider `toml:"OIDC_PROVIDERS"`
+	OIDCLoginClaim      string         `toml:"OIDC_LOGIN_CLAIM"`
+	OIDCNameClaim       string         `toml:"OIDC_NAME_CLAIM"`
+	OIDCRolesClaim      string         `toml:"OIDC_ROLES_CLAIM"`
+	OIDCAdminRoles      []string       `toml:"OIDC_ADMIN_ROLES"`
+	OIDCAutoCreateUsers bool           `toml:"OIDC_AUTO_CREATE_USERS"`
+
+	LDAPURL                string   `toml:"LDAP_URL"`
+	LDAPStartTLS           bool     `toml:"LDAP_START_TLS"`
+	LDAPInsecureSkipVerify bool     `toml:"LDAP_INSECURE_SKIP_VERIFY"`
+	LDAPBindDN             string   `toml:"LDAP_BIND_DN"`
+	LDAPBindPassword       string   `toml:"LDAP_BIND_PASSWORD"`
+	LDAPBaseDN             string   `toml:"LDAP_BASE_DN"`
+	LDAPUserFilter         string   `toml:"LDAP_USER_FILTER"`
+	LDAPLoginAttribute     string   `toml:"LDAP_LOGIN_ATTRIBUTE"`
+	LDAPNameAttribute      string   `toml:"LDAP_NAME_ATTRIBUTE"`
+	LDAPGroupAttribute     string   `toml:"LDAP_GROUP_ATTRIBUTE"`
+	LDAPAdminGroups        []string `toml:"LDAP_ADMIN_GROUPS"`
+	LDAPUserGroups         []string `toml:"LDAP_USER_GROUPS"`
+	LDAPTimeoutSec         int      `toml:"LDAP_TIMEOUT_SEC"`
+	LDAPAutoCreateUsers    bool     `toml:"LDAP_AUTO_CREATE_USERS"`
+
+	TwoFactorIssuer          string `toml:"TWO_FACTOR_ISSUER"`
+	TwoFactorChallengeAgeSec int    `toml:"TWO_FACTOR_CHALLENGE_AGE_SEC"`
+	TwoFactorMaxAttempts     int    `toml:"TWO_FACTOR_MAX_ATTEMPTS"`
+
+	TLSCertFile           string `toml:"TLS_CERT_FILE"`
+	TLSKeyFile            string `toml:"TLS_KEY_FILE"`
+	TLSClientCAFile       string `toml:"TLS_CLIENT_CA_FILE"`
+	TLSClientCertRequired bool   `toml:"TLS_CLIENT_CERT_REQUIRED"`
+	TLSClientCertLogin    string `toml:"TLS_CLIENT_CERT_LOGIN"`
+
+	// Реплики БД только для чтения. На них выполняется поиск в журнале, журнале аудита и список пользователей
+	DatabaseReplicaURLs             []string `toml:"DATABASE_REPLICA_URLS"`
+	DatabaseReplicaURLsFile         string   `toml:"DATABASE_REPLICA_URLS_FILE"`
+	DatabaseReplicaMaxLagSec        int      `toml:"DATABASE_REPLICA_MAX_LAG_SEC"`
+	DatabaseReplicaCheckIntervalSec int      `toml:"DATABASE_REPLICA_CHECK_INTERVAL_SEC"`
+
+	DbQueryTimeoutSec   int `toml:"DB_QUERY_TIMEOUT_SEC"`
+	LogInsertTimeoutSec int `toml:"LOG_INSERT_TIMEOUT_SEC"`
+	LogFindTimeoutSec   int `toml:"LOG_FIND_TIMEOUT_SEC"`
+
+	// Хранилище журнала: PostgreSQL (DATABASE_URL), файлы в каталоге LOG_FILE_DIR или ClickHouse (CLICKHOUSE_URL).
+	// Пользователи, сессии, аудит и второй фактор всегда хранятся в PostgreSQL, поэтому DATABASE_URL нужен при любом хранилище
+	LogStorage           string `toml:"LOG_STORAGE"`
+	LogFileDir           string `toml:"LOG_FILE_DIR"`
+	LogFileSegmentSizeMb int    `toml:"LOG_FILE_SEGMENT_SIZE_MB"`
+	ClickHouseURL        string `toml:"CLICKHOUSE_URL"`
+	ClickHouseDatabase   string `toml:"CLICKHOUSE_DATABASE"`
+	ClickHouseUser       string `toml:"CLICKHOUSE_USER"`
+	ClickHousePassword   string `toml:"CLICKHOUSE_PASSWORD"`
+
+	DbConnectTimeoutSec   int `toml:"DB_CONNECT_TIMEOUT_SEC"`
+	DbStatementTimeoutSec int `toml:"DB_STATEMENT_TIMEOUT_SEC"`
+	// Защита от обращений к недоступной БД: после DB_BREAKER_FAILURES ошибок соединения подряд запросы
+	// сразу завершаются ошибкой, а соединение проверяется раз в DB_BREAKER_RETRY_SEC
+	DbBreakerFailures int `toml:"DB_BREAKER_FAILURES"`
+	DbBreakerRetrySec int `toml:"DB_BREAKER_RETRY_SEC"`
+
+	TraceExporter     string  `toml:"TRACE_EXPORTER"`
+	TraceOTLPEndpoint string  `toml:"TRACE_OTLP_ENDPOINT"`
+	TraceServiceName  string  `toml:"TRACE_SERVICE_NAME"`
+	TraceSampleRatio  float64 `toml:"TRACE_SAMPLE_RATIO"`
+
+	// Секреты можно хранить в отдельных файлах (например, Docker или Kubernetes secrets).
+	// Если файл задан, то значение берется из него
+	SuperPasswordFile        string   `toml:"SUPERADMIN_PASSWORD_FILE"`
+	DatabaseURLFile          string   `toml:"DATABASE_URL_FILE"`
+	SessionEncriptionKeyFile string   `toml:"SESSION_ENCRYPTION_KEY_FILE"`
+	SessionPreviousKeys      []string `toml:"SESSION_PREVIOUS_KEYS"`
+	SessionPreviousKeysFile  string   `toml:"SESSION_PREVIOUS_KEYS_FILE"`
+	LDAPBindPasswordFile     string   `toml:"LDAP_BIND_PASSWORD_FILE"`
+	ClickHousePasswordFile   string   `toml:"CLICKHOUSE_PASSWORD_FILE"`
+	// DevMode разрешает ключи и пароли по умолчанию и слабые пароли. Только для разработки
+	DevMode bool `toml:"DEV_MODE"`
+
+	// файл, из которого был прочитан конфиг. Нужен для Reload
+	path string
 }
 
+// OIDCProvider Провайдер OpenID Connect, токены которого принимаются
+type OIDCProvider struct {
+	Issuer   string `toml:"ISSUER"`
+	Audience string `toml:"AUDIENCE"`
+	JWKS     string `toml:"JWKS"`
+}
+
+// Хранилища журнала
+const (
+	LogStoragePostgres   = "postgres"
+	LogStorageFile       = "file"
+	LogStorageClickHouse = "clickhouse"
+)
+
 const (
-	superAdminID            = 1
 	maxDbSessions           = 50
 	maxDbSessionIdleTimeSec = 50
 	maxLogRecordsResult     = 100000
 	defaultSessionAge       = 60 * 60 * 24 // 24 часа
+	maxRequestSize          = 10 << 20     // 10 Мб
+	maxDecompressedSize     = 100 << 20    // 100 Мб
 )
 
-// New Инициализация конфига значениями по умолчанию
-func New(path string, logger logger.Interface) (*Config, error) {
+// New Чтение конфига: значения по умолчанию, переменные окружения и файл path, если он задан.
+// Настройки проверяются, вывести их в лог можно через Print
+func New(path string) (*Config, error) {
 	c := &Config{
-		SuperAdminID:            superAdminID,
 		Host:                    "0.0.0.0",
 		Port:                    "8080",
 		SuperAdminLogin:         "admin",
 		SuperPassword:           "admin",
 		SessionAge:              defaultSessionAge,
 		LogLevel:                "debug",
+		LogFormat:               "text",
 		DatabaseURL:             "",
-		SessionEncriptionKey:    "e09469b1507d0e7a98831750aff903e0831a428f9addf3cfa348fa64dcf",
+		SessionEncriptionKey:    "",
 		MaxDbSessions:           maxDbSessions,
 		MaxDbSessionIdleTimeSec: maxDbSessionIdleTimeSec,
 		MaxLogRecordsResult:     maxLogRecordsResult,
@@ -63,50 +180,312 @@ func New(path string, logger logger.Interface) (*Config, error) {
 		HttpShutdownTimeout:     10,
 		RateLimit:               10000,
 		RateLimitBurst:          20000,
+		MaxRequestSize:          maxRequestSize,
+		MaxDecompressedSize:     maxDecompressedSize,
+		PasswordHashAlgorithm:   "bcrypt",
+		BcryptCost:              10,
+		Argon2Memory:            64 * 1024,
+		Argon2Time:              3,
+		Argon2Threads:           2,
+		LoginMaxFailures:        5,
+		LoginMaxAddressFailures: 50,
+		LoginDelayMs:            500,
+		LoginLockoutSec:         900,
+		CookieSecure:            false,
+		CookieHTTPOnly:          true,
+		CookieSameSite:          "lax",
+		CSRFProtection:          false,
+		CORSAllowedOrigins:      []string{"*"},
+		CORSAllowCredentials:    false,
+		SyslogUDPAddress:        "",
+		SyslogTCPAddress:        "",
+		SelfLog:                 false,
+		OIDCProviders:           nil,
+		OIDCLoginClaim:          "preferred_username",
+		OIDCNameClaim:           "name",
+		OIDCRolesClaim:          "groups",
+		OIDCAdminRoles:          nil,
+		OIDCAutoCreateUsers:     true,
+		LDAPURL:                 "",
+		LDAPStartTLS:            false,
+		LDAPInsecureSkipVerify:  false,
+		LDAPBindDN:              "",
+		LDAPBindPassword:        "",
+		LDAPBaseDN:              "",
+		LDAPUserFilter:          "(uid=%s)",
+		LDAPLoginAttribute:      "uid",
+		LDAPNameAttribute:       "cn",
+		LDAPGroupAttribute:      "memberOf",
+		LDAPAdminGroups:         nil,
+		LDAPUserGroups:          nil,
+		LDAPTimeoutSec:          10,
+		LDAPAutoCreateUsers:     true,
+
+		TwoFactorIssuer:          "Log Server",
+		TwoFactorChallengeAgeSec: 300,
+		TwoFactorMaxAttempts:     5,
+
+		TLSCertFile:           "",
+		TLSKeyFile:            "",
+		TLSClientCAFile:       "",
+		TLSClientCertRequired: false,
+		TLSClientCertLogin:    "",
+
+		DatabaseReplicaURLs:             nil,
+		DatabaseReplicaURLsFile:         "",
+		DatabaseReplicaMaxLagSec:        10,
+		DatabaseReplicaCheckIntervalSec: 5,
+
+		DbQueryTimeoutSec:   10,
+		LogInsertTimeoutSec: 10,
+		LogFindTimeoutSec:   60,
+
+		LogStorage:           LogStoragePostgres,
+		LogFileDir:           "data/log",
+		LogFileSegmentSizeMb: 64,
+		ClickHouseURL:        "http://localhost:8123",
+		ClickHouseDatabase:   "default",
+		ClickHouseUser:       "default",
+		ClickHousePassword:   "",
+
+		DbConnectTimeoutSec:   5,
+		DbStatementTimeoutSec: 120,
+		DbBreakerFailures:     5,
+		DbBreakerRetrySec:     5,
+
+		TraceExporter:     tracing.ExporterNone,
+		TraceOTLPEndpoint: "",
+		TraceServiceName:  "logserver",
+		TraceSampleRatio:  1,
+
+		SuperPasswordFile:        "",
+		DatabaseURLFile:          "",
+		SessionEncriptionKeyFile: "",
+		SessionPreviousKeys:      nil,
+		SessionPreviousKeysFile:  "",
+		LDAPBindPasswordFile:     "",
+		ClickHousePasswordFile:   "",
+		DevMode:                  false,
+
+		path: path,
 	}
 
-	c.readEnv()
+	if err := c.readEnv(); err != nil {
+		return nil, err
+	}
 
 	if path != "" {
 		if _, err := toml.DecodeFile(path, c); err != nil {
-			return nil, err
+			return nil, fmt.Errorf("config file %s: %w", path, err)
 		}
 	}
 
-	if c.DatabaseURL == "" {
-		return nil, fmt.Errorf("DATABASE_URL undefined")
+	if err := c.readSecretFiles(); err != nil {
+		return nil, err
 	}
 
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Reload Повторное чтение конфига из тех же источников, что и при запуске. Возвращает новый конфиг,
+// текущий не изменяется
+func (c *Config) Reload() (*Config, error) {
+	return New(c.path)
+}
+
+// Print Вывод настроек в лог. Пароли и ключи не выводятся
+func (c *Config) Print(logger logger.Interface) {
+	if c.DevMode {
+		logger.Warn("DEV_MODE: default and weak secrets are allowed, don't use it in production")
+	}
+	logger.Info("HOST: %s, PORT: %s", c.Host, c.Port)
+	logger.Info("LOG_LEVEL: %s, LOG_FORMAT: %s", c.LogLevel, c.LogFormat)
+	logger.Info("SUPERADMIN_LOGIN: %s", c.SuperAdminLogin)
 	logger.Info("MAX_DB_SESSIONS: %d", c.MaxDbSessions)
-	logger.Info("SESSION_AGE: %d", c.SessionAge)
+	logger.Info("SESSION_AGE: %d, SESSION_PREVIOUS_KEYS: %d", c.SessionAge, len(c.SessionPreviousKeys))
 	logger.Info("MAX_DB_SESSION_IDLE_TIME_SEC: %d", c.MaxDbSessionIdleTimeSec)
+	logger.Info("DB_QUERY_TIMEOUT_SEC: %d, LOG_INSERT_TIMEOUT_SEC: %d, LOG_FIND_TIMEOUT_SEC: %d",
+		c.DbQueryTimeoutSec, c.LogInsertTimeoutSec, c.LogFindTimeoutSec)
+	logger.Info("LOG_STORAGE: %s", c.LogStorage)
+	if strings.EqualFold(c.LogStorage, LogStorageFile) {
+		logger.Info("LOG_FILE_DIR: %s, LOG_FILE_SEGMENT_SIZE_MB: %d", c.LogFileDir, c.LogFileSegmentSizeMb)
+	}
+	if strings.EqualFold(c.LogStorage, LogStorageClickHouse) {
+		logger.Info("CLICKHOUSE_URL: %s, CLICKHOUSE_DATABASE: %s, CLICKHOUSE_USER: %s", c.ClickHouseURL, c.ClickHouseDatabase, c.ClickHouseUser)
+	}
+	logger.Info("DB_CONNECT_TIMEOUT_SEC: %d, DB_STATEMENT_TIMEOUT_SEC: %d", c.DbConnectTimeoutSec, c.DbStatementTimeoutSec)
+	logger.Info("DB_BREAKER_FAILURES: %d, DB_BREAKER_RETRY_SEC: %d", c.DbBreakerFailures, c.DbBreakerRetrySec)
 	logger.Info("RATE_LIMIT: %d", c.RateLimit)
 	logger.Info("RATE_LIMIT_BURST: %d", c.RateLimitBurst)
-	logger.Info("LS_DATABASE_URL: %s", c.DatabaseURL)
-
-	return c, nil
+	logger.Info("PASSWORD_HASH_ALGORITHM: %s, BCRYPT_COST: %d", c.PasswordHashAlgorithm, c.BcryptCost)
+	logger.Info("ARGON2_MEMORY: %d, ARGON2_TIME: %d, ARGON2_THREADS: %d", c.Argon2Memory, c.Argon2Time, c.Argon2Threads)
+	logger.Info("LOGIN_MAX_FAILURES: %d, LOGIN_MAX_ADDRESS_FAILURES: %d", c.LoginMaxFailures, c.LoginMaxAddressFailures)
+	logger.Info("LOGIN_DELAY_MS: %d, LOGIN_LOCKOUT_SEC: %d", c.LoginDelayMs, c.LoginLockoutSec)
+	logger.Info("COOKIE_SECURE: %v, COOKIE_HTTP_ONLY: %v, COOKIE_SAME_SITE: %s", c.CookieSecure, c.CookieHTTPOnly, c.CookieSameSite)
+	logger.Info("CSRF_PROTECTION: %v", c.CSRFProtection)
+	logger.Info("SELF_LOG: %v", c.SelfLog)
+	logger.Info("CORS_ALLOWED_ORIGINS: %s, CORS_ALLOW_CREDENTIALS: %v", strings.Join(c.CORSAllowedOrigins, ","), c.CORSAllowCredentials)
+	logger.Info("TWO_FACTOR_ISSUER: %s, TWO_FACTOR_CHALLENGE_AGE_SEC: %d, TWO_FACTOR_MAX_ATTEMPTS: %d",
+		c.TwoFactorIssuer, c.TwoFactorChallengeAgeSec, c.TwoFactorMaxAttempts)
+	if c.TLSCertFile != "" {
+		logger.Info("TLS_CERT_FILE: %s, TLS_KEY_FILE: %s", c.TLSCertFile, c.TLSKeyFile)
+		logger.Info("TLS_CLIENT_CA_FILE: %s, TLS_CLIENT_CERT_REQUIRED: %v, TLS_CLIENT_CERT_LOGIN: %s",
+			c.TLSClientCAFile, c.TLSClientCertRequired, c.TLSClientCertLogin)
+	}
+	logger.Info("TRACE_EXPORTER: %s", c.TraceExporter)
+	if !strings.EqualFold(c.TraceExporter, tracing.ExporterNone) {
+		logger.Info("TRACE_OTLP_ENDPOINT: %s, TRACE_SERVICE_NAME: %s, TRACE_SAMPLE_RATIO: %v",
+			c.TraceOTLPEndpoint, c.TraceServiceName, c.TraceSampleRatio)
+	}
+	logger.Info("MAX_REQUEST_SIZE: %d", c.MaxRequestSize)
+	logger.Info("MAX_DECOMPRESSED_REQUEST_SIZE: %d", c.MaxDecompressedSize)
+	logger.Info("DATABASE_URL: %s", redactDatabaseURL(c.DatabaseURL))
+	for _, dsn := range c.DatabaseReplicaURLs {
+		logger.Info("DATABASE_REPLICA_URLS: %s", redactDatabaseURL(dsn))
+	}
+	if len(c.DatabaseReplicaURLs) > 0 {
+		logger.Info("DATABASE_REPLICA_MAX_LAG_SEC: %d, DATABASE_REPLICA_CHECK_INTERVAL_SEC: %d",
+			c.DatabaseReplicaMaxLagSec, c.DatabaseReplicaCheckIntervalSec)
+	}
+	if c.SyslogUDPAddress != "" || c.SyslogTCPAddress != "" {
+		logger.Info("SYSLOG_UDP_ADDRESS: %s", c.SyslogUDPAddress)
+		logger.Info("SYSLOG_TCP_ADDRESS: %s", c.SyslogTCPAddress)
+	}
+	for _, p := range c.OIDCProviders {
+		logger.Info("OIDC provider: %s, audience: %s, jwks: %s", p.Issuer, p.Audience, p.JWKS)
+	}
+	if len(c.OIDCProviders) > 0 {
+		logger.Info("OIDC_LOGIN_CLAIM: %s, OIDC_NAME_CLAIM: %s, OIDC_ROLES_CLAIM: %s", c.OIDCLoginClaim, c.OIDCNameClaim, c.OIDCRolesClaim)
+		logger.Info("OIDC_ADMIN_ROLES: %s, OIDC_AUTO_CREATE_USERS: %v", strings.Join(c.OIDCAdminRoles, ","), c.OIDCAutoCreateUsers)
+	}
+	if c.LDAPURL != "" {
+		logger.Info("LDAP_URL: %s, LDAP_START_TLS: %v, LDAP_BIND_DN: %s", c.LDAPURL, c.LDAPStartTLS, c.LDAPBindDN)
+		logger.Info("LDAP_BASE_DN: %s, LDAP_USER_FILTER: %s", c.LDAPBaseDN, c.LDAPUserFilter)
+		logger.Info("LDAP_ADMIN_GROUPS: %s, LDAP_USER_GROUPS: %s, LDAP_AUTO_CREATE_USERS: %v",
+			strings.Join(c.LDAPAdminGroups, ";"), strings.Join(c.LDAPUserGroups, ";"), c.LDAPAutoCreateUsers)
+	}
 }
 
-// Чтение переменных окружения
-func (c *Config) readEnv() {
+// Чтение переменных окружения. Ошибка, если значение не удалось разобрать
+func (c *Config) readEnv() error {
+	var errs []string
+
 	eString(&c.Host, "LS_HOST")
 	eString(&c.Port, "LS_PORT")
 	eString(&c.SuperAdminLogin, "LS_SUPERADMIN_LOGIN")
 	eString(&c.SuperPassword, "LS_SUPERADMIN_PASSWORD")
-	eInt(&c.SessionAge, "LS_SESSION_AGE")
+	eInt(&c.SessionAge, "LS_SESSION_AGE", &errs)
 	eString(&c.LogLevel, "LS_LOG_LEVEL")
+	eString(&c.LogFormat, "LS_LOG_FORMAT")
 	eString(&c.DatabaseURL, "LS_DATABASE_URL")
-	eInt(&c.MaxDbSessions, "LS_MAX_DB_SESSIONS")
-	eInt(&c.MaxDbSessionIdleTimeSec, "LS_MAX_DB_SESSION_IDLE_TIME_SEC")
+	eInt(&c.MaxDbSessions, "LS_MAX_DB_SESSIONS", &errs)
+	eInt(&c.MaxDbSessionIdleTimeSec, "LS_MAX_DB_SESSION_IDLE_TIME_SEC", &errs)
 	eString(&c.SessionEncriptionKey, "LS_SESSION_ENCRYPTION_KEY")
-	eInt(&c.MaxLogRecordsResult, "LS_MAX_LOG_RECORDS_RESULT")
-	eInt(&c.HttpReadTimeout, "LS_HTTP_READ_TIMEOUT")
-	eInt(&c.HttpWriteTimeout, "LS_HTTP_WRITE_TIMEOUT")
-	eInt(&c.HttpShutdownTimeout, "LS_HTTP_SHUTDOWN_TIMEOUT")
-	eInt(&c.RateLimit, "LS_RATE_LIMIT")
-	eInt(&c.RateLimitBurst, "LS_RATE_LIMIT_BURST")
+	eInt(&c.MaxLogRecordsResult, "LS_MAX_LOG_RECORDS_RESULT", &errs)
+	eInt(&c.HttpReadTimeout, "LS_HTTP_READ_TIMEOUT", &errs)
+	eInt(&c.HttpWriteTimeout, "LS_HTTP_WRITE_TIMEOUT", &errs)
+	eInt(&c.HttpShutdownTimeout, "LS_HTTP_SHUTDOWN_TIMEOUT", &errs)
+	eInt(&c.RateLimit, "LS_RATE_LIMIT", &errs)
+	eInt(&c.RateLimitBurst, "LS_RATE_LIMIT_BURST", &errs)
 	eString(&c.PasswordRegex, "LS_PASSWORD_REGEX")
 	eString(&c.PasswordRegexError, "LS_PASSWORD_REGEX_ERROR")
+	eInt(&c.MaxRequestSize, "LS_MAX_REQUEST_SIZE", &errs)
+	eInt(&c.MaxDecompressedSize, "LS_MAX_DECOMPRESSED_REQUEST_SIZE", &errs)
+	eString(&c.PasswordHashAlgorithm, "LS_PASSWORD_HASH_ALGORITHM")
+	eInt(&c.BcryptCost, "LS_BCRYPT_COST", &errs)
+	eInt(&c.Argon2Memory, "LS_ARGON2_MEMORY", &errs)
+	eInt(&c.Argon2Time, "LS_ARGON2_TIME", &errs)
+	eInt(&c.Argon2Threads, "LS_ARGON2_THREADS", &errs)
+	eInt(&c.LoginMaxFailures, "LS_LOGIN_MAX_FAILURES", &errs)
+	eInt(&c.LoginMaxAddressFailures, "LS_LOGIN_MAX_ADDRESS_FAILURES", &errs)
+	eInt(&c.LoginDelayMs, "LS_LOGIN_DELAY_MS", &errs)
+	eInt(&c.LoginLockoutSec, "LS_LOGIN_LOCKOUT_SEC", &errs)
+	eBool(&c.CookieSecure, "LS_COOKIE_SECURE", &errs)
+	eBool(&c.CookieHTTPOnly, "LS_COOKIE_HTTP_ONLY", &errs)
+	eString(&c.CookieSameSite, "LS_COOKIE_SAME_SITE")
+	eBool(&c.CSRFProtection, "LS_CSRF_PROTECTION", &errs)
+	eStrings(&c.CORSAllowedOrigins, "LS_CORS_ALLOWED_ORIGINS")
+	eBool(&c.CORSAllowCredentials, "LS_CORS_ALLOW_CREDENTIALS", &errs)
+	eString(&c.TwoFactorIssuer, "LS_TWO_FACTOR_ISSUER")
+	eInt(&c.TwoFactorChallengeAgeSec, "LS_TWO_FACTOR_CHALLENGE_AGE_SEC", &errs)
+	eInt(&c.TwoFactorMaxAttempts, "LS_TWO_FACTOR_MAX_ATTEMPTS", &errs)
+	eString(&c.TLSCertFile, "LS_TLS_CERT_FILE")
+	eString(&c.TLSKeyFile, "LS_TLS_KEY_FILE")
+	eString(&c.TLSClientCAFile, "LS_TLS_CLIENT_CA_FILE")
+	eBool(&c.TLSClientCertRequired, "LS_TLS_CLIENT_CERT_REQUIRED", &errs)
+	eString(&c.TLSClientCertLogin, "LS_TLS_CLIENT_CERT_LOGIN")
+	eString(&c.SyslogUDPAddress, "LS_SYSLOG_UDP_ADDRESS")
+	eString(&c.SyslogTCPAddress, "LS_SYSLOG_TCP_ADDRESS")
+	eBool(&c.SelfLog, "LS_SELF_LOG", &errs)
+	eSemicolonList(&c.DatabaseReplicaURLs, "LS_DATABASE_REPLICA_URLS")
+	eString(&c.DatabaseReplicaURLsFile, "LS_DATABASE_REPLICA_URLS_FILE")
+	eInt(&c.DatabaseReplicaMaxLagSec, "LS_DATABASE_REPLICA_MAX_LAG_SEC", &errs)
+	eInt(&c.DatabaseReplicaCheckIntervalSec, "LS_DATABASE_REPLICA_CHECK_INTERVAL_SEC", &errs)
+	eInt(&c.DbQueryTimeoutSec, "LS_DB_QUERY_TIMEOUT_SEC", &errs)
+	eInt(&c.LogInsertTimeoutSec, "LS_LOG_INSERT_TIMEOUT_SEC", &errs)
+	eInt(&c.LogFindTimeoutSec, "LS_LOG_FIND_TIMEOUT_SEC", &errs)
+	eString(&c.LogStorage, "LS_LOG_STORAGE")
+	eString(&c.LogFileDir, "LS_LOG_FILE_DIR")
+	eInt(&c.LogFileSegmentSizeMb, "LS_LOG_FILE_SEGMENT_SIZE_MB", &errs)
+	eString(&c.ClickHouseURL, "LS_CLICKHOUSE_URL")
+	eString(&c.ClickHouseDatabase, "LS_CLICKHOUSE_DATABASE")
+	eString(&c.ClickHouseUser, "LS_CLICKHOUSE_USER")
+	eString(&c.ClickHousePassword, "LS_CLICKHOUSE_PASSWORD")
+	eString(&c.ClickHousePasswordFile, "LS_CLICKHOUSE_PASSWORD_FILE")
+	eInt(&c.DbConnectTimeoutSec, "LS_DB_CONNECT_TIMEOUT_SEC", &errs)
+	eInt(&c.DbStatementTimeoutSec, "LS_DB_STATEMENT_TIMEOUT_SEC", &errs)
+	eInt(&c.DbBreakerFailures, "LS_DB_BREAKER_FAILURES", &errs)
+	eInt(&c.DbBreakerRetrySec, "LS_DB_BREAKER_RETRY_SEC", &errs)
+	eString(&c.TraceExporter, "LS_TRACE_EXPORTER")
+	eString(&c.TraceOTLPEndpoint, "LS_TRACE_OTLP_ENDPOINT")
+	eString(&c.TraceServiceName, "LS_TRACE_SERVICE_NAME")
+	eFloat(&c.TraceSampleRatio, "LS_TRACE_SAMPLE_RATIO", &errs)
+	eString(&c.SuperPasswordFile, "LS_SUPERADMIN_PASSWORD_FILE")
+	eString(&c.DatabaseURLFile, "LS_DATABASE_URL_FILE")
+	eString(&c.SessionEncriptionKeyFile, "LS_SESSION_ENCRYPTION_KEY_FILE")
+	eStrings(&c.SessionPreviousKeys, "LS_SESSION_PREVIOUS_KEYS")
+	eString(&c.SessionPreviousKeysFile, "LS_SESSION_PREVIOUS_KEYS_FILE")
+	eBool(&c.DevMode, "LS_DEV_MODE", &errs)
+
+	// через переменные окружения можно задать только одного провайдера OIDC
+	var oidc OIDCProvider
+	eString(&oidc.Issuer, "LS_OIDC_ISSUER")
+	eString(&oidc.Audience, "LS_OIDC_AUDIENCE")
+	eString(&oidc.JWKS, "LS_OIDC_JWKS")
+	if oidc.Issuer != "" {
+		c.OIDCProviders = []OIDCProvider{oidc}
+	}
+	eString(&c.OIDCLoginClaim, "LS_OIDC_LOGIN_CLAIM")
+	eString(&c.OIDCNameClaim, "LS_OIDC_NAME_CLAIM")
+	eString(&c.OIDCRolesClaim, "LS_OIDC_ROLES_CLAIM")
+	eStrings(&c.OIDCAdminRoles, "LS_OIDC_ADMIN_ROLES")
+	eBool(&c.OIDCAutoCreateUsers, "LS_OIDC_AUTO_CREATE_USERS", &errs)
+
+	eString(&c.LDAPURL, "LS_LDAP_URL")
+	eBool(&c.LDAPStartTLS, "LS_LDAP_START_TLS", &errs)
+	eBool(&c.LDAPInsecureSkipVerify, "LS_LDAP_INSECURE_SKIP_VERIFY", &errs)
+	eString(&c.LDAPBindDN, "LS_LDAP_BIND_DN")
+	eString(&c.LDAPBindPassword, "LS_LDAP_BIND_PASSWORD")
+	eString(&c.LDAPBindPasswordFile, "LS_LDAP_BIND_PASSWORD_FILE")
+	eString(&c.LDAPBaseDN, "LS_LDAP_BASE_DN")
+	eString(&c.LDAPUserFilter, "LS_LDAP_USER_FILTER")
+	eString(&c.LDAPLoginAttribute, "LS_LDAP_LOGIN_ATTRIBUTE")
+	eString(&c.LDAPNameAttribute, "LS_LDAP_NAME_ATTRIBUTE")
+	eString(&c.LDAPGroupAttribute, "LS_LDAP_GROUP_ATTRIBUTE")
+	eSemicolonList(&c.LDAPAdminGroups, "LS_LDAP_ADMIN_GROUPS")
+	eSemicolonList(&c.LDAPUserGroups, "LS_LDAP_USER_GROUPS")
+	eInt(&c.LDAPTimeoutSec, "LS_LDAP_TIMEOUT_SEC", &errs)
+	eBool(&c.LDAPAutoCreateUsers, "LS_LDAP_AUTO_CREATE_USERS", &errs)
+
+	if len(errs) > 0 {
+		return fmt.Errorf("environment: %s", strings.Join(errs, "; "))
+	}
+
+	return nil
 }
 
 func eString(dest *string, env string) {
@@ -115,10 +494,75 @@ func eString(dest *string, env string) {
 	}
 }
 
-func eInt(dest *int, env string) {
+func eBool(dest *bool, env string, errs *[]string) {
+	if e := os.Getenv(env); len(e) > 0 {
+		b, err := strconv.ParseBool(e)
+		if err != nil {
+			*errs = append(*errs, fmt.Sprintf("%s: %q is not a boolean, expected true or false", env, e))
+
+			return
+		}
+		*dest = b
+	}
+}
+
+// eStrings Список значений, разделенных запятыми
+func eStrings(dest *[]string, env string) {
+	if e := os.Getenv(env); len(e) > 0 {
+		var values []string
+		for _, v := range strings.Split(e, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				values = append(values, v)
+			}
+		}
+		*dest = values
+	}
+}
+
+// eSemicolonList Список значений, разделенных точкой с запятой. Для значений, которые содержат запятые:
+// DN групп LDAP, адреса БД с несколькими хостами
+func eSemicolonList(dest *[]string, env string) {
+	if e := os.Getenv(env); len(e) > 0 {
+		var values []string
+		for _, v := range strings.Split(e, ";") {
+			if v = strings.TrimSpace(v); v != "" {
+				values = append(values, v)
+			}
+		}
+		*dest = values
+	}
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+func eInt(dest *int, env string, errs *[]string) {
+	if e := os.Getenv(env); len(e) > 0 {
+		i, err := strconv.Atoi(strings.TrimSpace(e))
+		if err != nil {
+			*errs = append(*errs, fmt.Sprintf("%s: %q is not an integer", env, e))
+
+			return
+		}
+		*dest = i
+	}
+}
+
+func eFloat(dest *float64, env string, errs *[]string) {
 	if e := os.Getenv(env); len(e) > 0 {
-		if i, err := strconv.Atoi(e); err == nil {
-			*dest = i
+		f, err := strconv.ParseFloat(strings.TrimSpace(e), 64)
+		if err != nil {
+			*errs = append(*errs, fmt.Sprintf("%s: %q is not a number", env, e))
+
+			return
 		}
+		*dest = f
 	}
 }
@@ -0,0 +1,165 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/n-r-w/log-server-v2/pkg/tools"
+)
+
+// Минимальная длина ключа кук сессии вне режима разработки
+const minSessionKeyLength = 32
+
+// Ключи, которые опубликованы в репозитории: ранее использовавшийся ключ по умолчанию и ключ из примеров конфига
+var knownSessionKeys = []string{
+	"e09469b1507d0e7a98831750aff903e0831a428f9addf3cfa348fa64dcf",
+	"e09469b1507d0e7a98831750aff903e0831a428f9addf3cfa348fa64dcfb249a0f8c666f8dda6315c19c5ed946d89703a134db0eae8b4632d063b4a06207b8a3",
+}
+
+// Пароли, которые подбираются в первую очередь. Сравнение без учета регистра
+var weakPasswords = []string{
+	"1", "12", "123", "1234", "12345", "123456", "12345678", "123456789", "qwerty", "password", "passw0rd",
+	"admin", "administrator", "root", "postgres", "secret", "changeme", "test", "default",
+}
+
+// Минимальная длина пароля админа вне режима разработки
+const minSuperPasswordLength = 8
+
+// readSecretFiles Чтение секретов из файлов, если они заданы. Значение из файла имеет приоритет
+func (c *Config) readSecretFiles() error {
+	files := []struct {
+		name string
+		file string
+		dest *string
+	}{
+		{"SUPERADMIN_PASSWORD_FILE", c.SuperPasswordFile, &c.SuperPassword},
+		{"DATABASE_URL_FILE", c.DatabaseURLFile, &c.DatabaseURL},
+		{"SESSION_ENCRYPTION_KEY_FILE", c.SessionEncriptionKeyFile, &c.SessionEncriptionKey},
+		{"LDAP_BIND_PASSWORD_FILE", c.LDAPBindPasswordFile, &c.LDAPBindPassword},
+		{"CLICKHOUSE_PASSWORD_FILE", c.ClickHousePasswordFile, &c.ClickHousePassword},
+	}
+
+	for _, f := range files {
+		if f.file == "" {
+			continue
+		}
+
+		value, err := readSecretFile(f.file)
+		if err != nil {
+			return fmt.Errorf("%s: %w", f.name, err)
+		}
+		*f.dest = value
+	}
+
+	// списки - по одному значению в строке
+	lists := []struct {
+		name string
+		file string
+		dest *[]string
+	}{
+		{"SESSION_PREVIOUS_KEYS_FILE", c.SessionPreviousKeysFile, &c.SessionPreviousKeys},
+		{"DATABASE_REPLICA_URLS_FILE", c.DatabaseReplicaURLsFile, &c.DatabaseReplicaURLs},
+	}
+
+	for _, l := range lists {
+		if l.file == "" {
+			continue
+		}
+
+		value, err := readSecretFile(l.file)
+		if err != nil {
+			return fmt.Errorf("%s: %w", l.name, err)
+		}
+
+		*l.dest = nil
+		for _, v := range strings.Split(value, "\n") {
+			if v = strings.TrimSpace(v); v != "" {
+				*l.dest = append(*l.dest, v)
+			}
+		}
+	}
+
+	// при разработке можно обойтись без ключа, но тогда сессии не переживают перезапуск сервера
+	if c.SessionEncriptionKey == "" && c.DevMode {
+		key, err := tools.RandomToken(minSessionKeyLength)
+		if err != nil {
+			return err //nolint:wrapcheck
+		}
+		c.SessionEncriptionKey = key
+	}
+
+	return nil
+}
+
+// readSecretFile Содержимое файла без завершающего перевода строки, который обычно добавляют редакторы и echo
+func readSecretFile(name string) (string, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return "", err //nolint:wrapcheck
+	}
+
+	value := strings.TrimRight(string(data), "\r\n")
+	if value == "" {
+		return "", fmt.Errorf("file %s is empty", name)
+	}
+
+	return value, nil
+}
+
+// checkSecrets Проверка, что ключи и пароли не взяты из примеров и не подбираются в первую очередь.
+// В режиме разработки не выполняется
+func (c *Config) checkSecrets(check func(ok bool, format string, args ...interface{})) {
+	if c.DevMode {
+		return
+	}
+
+	const hint = "set a random value or enable DEV_MODE for development"
+
+	checkKey := func(name string, key string) {
+		check(!containsString(knownSessionKeys, key), "%s: the key is published in the repository, %s", name, hint)
+		check(len(key) >= minSessionKeyLength, "%s: the key must be at least %d characters long, %s", name, minSessionKeyLength, hint)
+	}
+
+	if c.SessionEncriptionKey != "" {
+		checkKey("SESSION_ENCRYPTION_KEY", c.SessionEncriptionKey)
+	}
+	for _, key := range c.SessionPreviousKeys {
+		checkKey("SESSION_PREVIOUS_KEYS", key)
+	}
+
+	check(!isWeakPassword(c.SuperPassword) && len(c.SuperPassword) >= minSuperPasswordLength,
+		"SUPERADMIN_PASSWORD: the password is too weak, use at least %d characters or enable DEV_MODE for development", minSuperPasswordLength)
+
+	// пустой пароль БД допустим: аутентификация может идти по сертификату или через unix сокет
+	checkDatabaseURL := func(name string, dsn string) {
+		dbConfig, err := pgx.ParseConfig(dsn)
+		if err != nil {
+			// текст ошибки разбора может содержать пароль
+			check(false, "%s: invalid database url", name)
+		} else {
+			check(dbConfig.Password == "" || !isWeakPassword(dbConfig.Password), "%s: the database password is too weak, %s", name, hint)
+		}
+	}
+
+	if c.DatabaseURL != "" {
+		checkDatabaseURL("DATABASE_URL", c.DatabaseURL)
+	}
+	for _, dsn := range c.DatabaseReplicaURLs {
+		checkDatabaseURL("DATABASE_REPLICA_URLS", dsn)
+	}
+
+	if strings.EqualFold(c.LogStorage, LogStorageClickHouse) {
+		check(c.ClickHousePassword == "" || !isWeakPassword(c.ClickHousePassword), "CLICKHOUSE_PASSWORD: the password is too weak, %s", hint)
+	}
+}
+
+func isWeakPassword(password string) bool {
+	password = strings.ToLower(strings.TrimSpace(password))
+	if password == "" {
+		return true
+	}
+
+	return containsString(weakPasswords, password)
+}
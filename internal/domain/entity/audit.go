@@ -0,0 +1,67 @@
+// Package entity ...
+package entity
+
+import (
+	"time"
+)
+
+// Действия, которые фиксируются в журнале аудита
+const (
+	AuditLogin          = "login"
+	AuditLogout         = "logout"
+	AuditLoginLockout   = "login-lockout"
+	AuditUnlockUser     = "unlock-user"
+	AuditAddUser        = "add-user"
+	AuditChangePassword = "change-password"
+	AuditCloseSession   = "close-session"
+	AuditRevokeSessions = "revoke-sessions"
+	// второй фактор
+	AuditLoginTwoFactor   = "login-2fa"
+	AuditEnableTwoFactor  = "enable-2fa"
+	AuditDisableTwoFactor = "disable-2fa"
+	AuditRecoveryCodes    = "recovery-codes"
+	AuditTwoFactorPolicy  = "2fa-policy"
+)
+
+// Результат действия
+const (
+	AuditSuccess = "success"
+	AuditFailure = "failure"
+)
+
+// AuditEvent Сущность "Событие аудита" - действие пользователя, связанное с аутентификацией или администрированием
+type AuditEvent struct {
+	ID   uint64    `json:"id"`
+	Time time.Time `json:"time"`
+	// ActorID ID пользователя, выполнившего действие. 0, если пользователь неизвестен
+	ActorID uint64 `json:"actorId"`
+	// Actor логин пользователя, выполнившего действие
+	Actor string `json:"actor"`
+	// Action одна из констант Audit...
+	Action string `json:"action"`
+	// Target объект действия: логин пользователя, ID сессии и т.п.
+	Target    string `json:"target"`
+	Address   string `json:"address"`
+	RequestID string `json:"requestId"`
+	// Result AuditSuccess или AuditFailure
+	Result string `json:"result"`
+	// Details причина неудачи
+	Details string `json:"details,omitempty"`
+}
+
+// AuditQuery Параметры поиска событий аудита. Пустые значения не участвуют в отборе
+type AuditQuery struct {
+	TimeFrom time.Time
+	TimeTo   time.Time
+	Actor    string
+	Action   string
+	Target   string
+	// Limit максимальное количество событий в ответе
+	Limit int
+}
+
+// RequestInfo Информация о запросе, в рамках которого выполняется действие. Нужна для аудита
+type RequestInfo struct {
+	Address   string
+	RequestID string
+}
@@ -0,0 +1,26 @@
+// Package entity ...
+package entity
+
+// Состояние сервера или его компонента
+const (
+	HealthOK = "ok"
+	// HealthDegraded Компонент работает не полностью, но сервер в целом обслуживает запросы.
+	// Например, недоступна реплика и чтение идет с основного сервера
+	HealthDegraded = "degraded"
+	// HealthUnavailable Сервер не может обслуживать запросы, например недоступна БД
+	HealthUnavailable = "unavailable"
+)
+
+// ComponentHealth Состояние компонента сервера: БД, буфера записи и т.п.
+type ComponentHealth struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	// Details Пояснение для человека. Не должно содержать адресов и других сведений о внутреннем устройстве
+	Details string `json:"details,omitempty"`
+}
+
+// Health Состояние сервера. Status - худшее из состояний компонентов
+type Health struct {
+	Status     string            `json:"status"`
+	Components []ComponentHealth `json:"components"`
+}
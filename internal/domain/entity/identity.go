@@ -0,0 +1,12 @@
+// Package entity ...
+package entity
+
+// Identity Пользователь, подтвержденный внешним провайдером аутентификации (OIDC, LDAP и т.п.)
+type Identity struct {
+	// Provider идентификатор провайдера. Сохраняется в User.AuthProvider
+	Provider string
+	Login    string
+	Name     string
+	// Role роль, полученная из атрибутов пользователя у провайдера
+	Role string
+}
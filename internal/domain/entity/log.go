@@ -7,15 +7,32 @@ import (
 	validation "github.com/go-ozzo/ozzo-validation/v4"
 )
 
+// Уровни важности записи в журнале
+const (
+	LevelDebug = 1
+	LevelInfo  = 2
+	LevelWarn  = 3
+	LevelError = 4
+	LevelFatal = 5
+)
+
+// ServerLogSource Источник записей с собственными предупреждениями и ошибками сервера.
+// Зарезервирован: клиенты не могут добавлять записи с таким источником
+const ServerLogSource = "logserver"
+
 // LogRecord Сущность "Запись в журнале"
 type LogRecord struct {
 	ID       uint64    `json:"id"`
 	LogTime  time.Time `json:"logTime"`
 	RealTime time.Time `json:"realTime"`
 	Level    int       `json:"level"`
-	Message1 string    `json:"message1"`
-	Message2 string    `json:"message2"`
-	Message3 string    `json:"message3"`
+	// Host имя хоста, с которого пришла запись
+	Host string `json:"host,omitempty"`
+	// Source имя приложения-источника записи
+	Source   string `json:"source,omitempty"`
+	Message1 string `json:"message1"`
+	Message2 string `json:"message2"`
+	Message3 string `json:"message3"`
 }
 
 // IsEmpty ...
@@ -32,3 +49,64 @@ func (l *LogRecord) Validate() error {
 		validation.Field(&l.Message1, validation.Required),
 	)
 }
+
+// LogQuery Параметры поиска записей в журнале. Пустые значения не участвуют в отборе
+type LogQuery struct {
+	TimeFrom time.Time
+	TimeTo   time.Time
+	// Levels допустимые уровни
+	Levels   []int
+	MinLevel int
+	MaxLevel int
+	// Hosts допустимые значения LogRecord.Host
+	Hosts []string
+	// Sources допустимые значения LogRecord.Source
+	Sources []string
+	// Message подстрока, которая должна содержаться в одном из сообщений (без учета регистра)
+	Message string
+	// Limit максимальное количество записей в ответе
+	Limit int
+	// Cursor позиция, после которой надо продолжить выборку
+	Cursor *LogCursor
+}
+
+// Группировка записей журнала при подсчете
+const (
+	LogGroupLevel  = "level"
+	LogGroupHost   = "host"
+	LogGroupSource = "source"
+	LogGroupHour   = "hour"
+	LogGroupDay    = "day"
+)
+
+// LogCount Количество записей журнала в группе. При группировке по времени Key - начало часа или суток
+// в формате RFC 3339 (UTC), при группировке по уровню - уровень числом
+type LogCount struct {
+	Key   string `json:"key"`
+	Count uint64 `json:"count"`
+}
+
+// ValidLogGroup Допустимое значение группировки
+func ValidLogGroup(group string) bool {
+	switch group {
+	case LogGroupLevel, LogGroupHost, LogGroupSource, LogGroupHour, LogGroupDay:
+		return true
+	default:
+		return false
+	}
+}
+
+// LogCursor Позиция в журнале для постраничной выборки. Записи упорядочены по убыванию LogTime и ID,
+// поэтому продолжение выборки - это записи, расположенные строго после записи с этими LogTime и ID
+type LogCursor struct {
+	LogTime time.Time
+	ID      uint64
+}
+
+// NewLogCursor Позиция сразу после записи
+func NewLogCursor(record LogRecord) *LogCursor {
+	return &LogCursor{
+		LogTime: record.LogTime,
+		ID:      record.ID,
+	}
+}
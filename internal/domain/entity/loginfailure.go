@@ -0,0 +1,27 @@
+// Package entity ...
+package entity
+
+import (
+	"time"
+)
+
+// LoginFailure Сущность "Неудачные попытки входа". Ведется отдельно для каждого логина и для каждого адреса клиента
+type LoginFailure struct {
+	// Key логин или адрес клиента с префиксом, указывающим на тип ключа
+	Key string
+	// Failures количество неудачных попыток подряд
+	Failures    int
+	LastFailure time.Time
+	// LockedUntil время, до которого вход запрещен
+	LockedUntil time.Time
+}
+
+// IsEmpty ...
+func (f *LoginFailure) IsEmpty() bool {
+	return f.Failures == 0
+}
+
+// IsLocked Запрещен ли вход на момент now
+func (f *LoginFailure) IsLocked(now time.Time) bool {
+	return now.Before(f.LockedUntil)
+}
@@ -0,0 +1,27 @@
+// Package entity ...
+package entity
+
+import (
+	"time"
+)
+
+// Session Сущность "Сессия пользователя"
+type Session struct {
+	// ID идентификатор сессии - хэш токена, который хранится у клиента. Сам токен на сервере не хранится
+	ID        string    `json:"id"`
+	UserID    uint64    `json:"userId"`
+	CreatedAt time.Time `json:"createdAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	Address   string    `json:"address"`
+	UserAgent string    `json:"userAgent"`
+}
+
+// IsEmpty ...
+func (s *Session) IsEmpty() bool {
+	return s.ID == ""
+}
+
+// IsExpired Истек ли срок действия сессии
+func (s *Session) IsExpired(now time.Time) bool {
+	return !now.Before(s.ExpiresAt)
+}
@@ -0,0 +1,82 @@
+// Package entity ...
+package entity
+
+import (
+	"time"
+)
+
+// TOTP Сущность "Второй фактор пользователя" - секрет для одноразовых кодов TOTP и резервные коды
+type TOTP struct {
+	UserID uint64
+	Secret string
+	// Enabled подключение подтверждено кодом из приложения. До этого секрет при входе не используется
+	Enabled bool
+	// LastStep номер периода последнего принятого кода. Защита от повторного использования кода
+	LastStep int64
+	// RecoveryCodes хэши неиспользованных резервных кодов
+	RecoveryCodes []string
+}
+
+// IsEmpty ...
+func (t *TOTP) IsEmpty() bool {
+	return t.UserID == 0
+}
+
+// TOTPEnrolment Данные для подключения приложения-аутентификатора
+type TOTPEnrolment struct {
+	Secret string `json:"secret"`
+	// URI ссылка otpauth:// для QR кода
+	URI string `json:"uri"`
+}
+
+// TwoFactorStatus Состояние второго фактора пользователя
+type TwoFactorStatus struct {
+	Enabled bool `json:"enabled"`
+	// Required второй фактор обязателен для роли пользователя
+	Required bool `json:"required"`
+	// RecoveryCodesLeft количество неиспользованных резервных кодов
+	RecoveryCodesLeft int `json:"recoveryCodesLeft"`
+}
+
+// TwoFactorPolicy Обязательность второго фактора для роли
+type TwoFactorPolicy struct {
+	Role     string `json:"role"`
+	Required bool   `json:"required"`
+}
+
+// LoginChallenge Сущность "Незавершенный вход" - пароль проверен, ожидается код второго фактора
+type LoginChallenge struct {
+	// ID хэш токена, который передается клиенту. Сам токен на сервере не хранится
+	ID        string
+	UserID    uint64
+	ExpiresAt time.Time
+	// Attempts количество неверных кодов
+	Attempts int
+}
+
+// IsEmpty ...
+func (c *LoginChallenge) IsEmpty() bool {
+	return c.ID == ""
+}
+
+// IsExpired ...
+func (c *LoginChallenge) IsExpired(now time.Time) bool {
+	return !now.Before(c.ExpiresAt)
+}
+
+// LoginStep Результат проверки пароля, если для входа нужен второй фактор
+type LoginStep struct {
+	TwoFactorRequired bool `json:"twoFactorRequired"`
+	// Challenge токен, который надо передать вместе с кодом
+	Challenge string `json:"challenge"`
+	// Enrolment заполняется, если второй фактор обязателен, но еще не подключен. Его надо подключить,
+	// передав код из приложения вместо кода второго фактора
+	Enrolment *TOTPEnrolment `json:"enrolment,omitempty"`
+}
+
+// LoginResult Результат второго шага входа
+type LoginResult struct {
+	UserID uint64 `json:"-"`
+	// RecoveryCodes резервные коды, если второй фактор был подключен при этом входе
+	RecoveryCodes []string `json:"recoveryCodes,omitempty"`
+}
@@ -9,11 +9,34 @@ import (
 	"github.com/n-r-w/log-server-v2/pkg/tools"
 )
 
+// Роли пользователей
+const (
+	RoleAdmin = "admin"
+	RoleUser  = "user"
+)
+
+// Roles Все роли пользователей
+var Roles = []string{RoleAdmin, RoleUser}
+
+// IsValidRole ...
+func IsValidRole(role string) bool {
+	for _, r := range Roles {
+		if r == role {
+			return true
+		}
+	}
+
+	return false
+}
+
 // User Сущность "Пользователь"
 type User struct {
-	ID                uint64 `json:"id"`
-	Login             string `json:"login"`
-	Name              string `json:"name"`
+	ID    uint64 `json:"id"`
+	Login string `json:"login"`
+	Name  string `json:"name"`
+	Role  string `json:"role"`
+	// AuthProvider провайдер, через который пользователь входит. Пустой - локальный пароль
+	AuthProvider      string `json:"authProvider,omitempty"`
 	Password          string `json:"password,omitempty"`
 	EncryptedPassword string `json:"-"`
 }
@@ -23,26 +46,41 @@ func (u *User) IsEmpty() bool {
 	return u.ID == 0
 }
 
+// IsAdmin ...
+func (u *User) IsAdmin() bool {
+	return u.Role == RoleAdmin
+}
+
 // Validate Валидация ...
 func (u *User) Validate(passwordRegex string, passwordRegexError string) error {
 	return validation.ValidateStruct(
 		u,
 		validation.Field(&u.Login, validation.Required),
 		validation.Field(&u.Name, validation.Required),
+		validation.Field(&u.Role, validation.Required, validation.In(RoleAdmin, RoleUser)),
 		validation.Field(&u.Password, validation.When(len(u.EncryptedPassword) == 0, validation.Required)),
 		validation.Field(&u.Password, validation.When(len(u.EncryptedPassword) == 0,
 			validation.Match(regexp.MustCompile(passwordRegex)).Error(passwordRegexError))),
 	)
 }
 
-// Prepare Подготовка данных после первой инициализации (инициализация хэша пароля)
-func (u *User) Prepare(sanitize bool) error {
+// Normalize Удаление лишних пробелов и роль по умолчанию. Выполняется до проверки (Validate)
+func (u *User) Normalize() {
 	u.Login = strings.TrimSpace(u.Login)
 	u.Name = strings.TrimSpace(u.Name)
 	u.Password = strings.TrimSpace(u.Password)
+	u.Role = strings.TrimSpace(u.Role)
+	if u.Role == "" {
+		u.Role = RoleUser
+	}
+}
+
+// Prepare Подготовка данных после первой инициализации (инициализация хэша пароля)
+func (u *User) Prepare(hasher *tools.PasswordHasher, sanitize bool) error {
+	u.Normalize()
 
 	if len(u.Password) > 0 {
-		enc, err := tools.EncryptPassword(u.Password)
+		enc, err := hasher.Hash(u.Password)
 		if err != nil {
 
 			return err
@@ -64,6 +102,6 @@ func (u *User) sanitize() {
 }
 
 // ComparePassword Подходит ли пароль
-func (u *User) ComparePassword(password string) bool {
-	return tools.ComparePassword(u.EncryptedPassword, password)
+func (u *User) ComparePassword(hasher *tools.PasswordHasher, password string) bool {
+	return hasher.Compare(u.EncryptedPassword, password)
 }
@@ -0,0 +1,76 @@
+// Package usecase Сценарии работы с журналом аудита. События аудита формируются в юскейсах,
+// т.к. только здесь известно, какое действие выполнено и чем оно закончилось
+package usecase
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/n-r-w/log-server-v2/internal/domain/entity"
+	"github.com/n-r-w/log-server-v2/pkg/logger"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type auditUseCase struct {
+	repo   AuditInterface
+	logger logger.Interface
+}
+
+func NewAuditCase(r AuditInterface, logger logger.Interface) *auditUseCase {
+	return &auditUseCase{
+		repo:   r,
+		logger: logger,
+	}
+}
+
+// Find Поиск событий аудита. Только для админа
+func (a *auditUseCase) Find(ctx context.Context, currentUser entity.User, query entity.AuditQuery) ([]entity.AuditEvent, error) {
+	if !currentUser.IsAdmin() {
+		return nil, errNotAdmin
+	}
+
+	return a.repo.Find(ctx, query) //nolint:wrapcheck
+}
+
+// write Запись события. Ошибка записи не отменяет уже выполненное действие, поэтому она только выводится в журнал.
+// По той же причине событие записывается и после отмены запроса
+func (a *auditUseCase) write(ctx context.Context, event entity.AuditEvent) {
+	if err := a.repo.Insert(detach(ctx), event); err != nil {
+		a.logger.Error("audit: %s %s by %s: %v", event.Action, event.Target, event.Actor, err)
+	}
+}
+
+// event Запись события, выполненного пользователем actor. err - результат действия
+func (a *auditUseCase) event(ctx context.Context, actor entity.User, action string, target string, req entity.RequestInfo, err error) {
+	a.write(ctx, newAuditEvent(actor, action, target, req, err))
+}
+
+func newAuditEvent(actor entity.User, action string, target string, req entity.RequestInfo, err error) entity.AuditEvent {
+	event := entity.AuditEvent{
+		ID:        0,
+		Time:      time.Now().UTC(),
+		ActorID:   actor.ID,
+		Actor:     actor.Login,
+		Action:    action,
+		Target:    strings.TrimSpace(target),
+		Address:   req.Address,
+		RequestID: req.RequestID,
+		Result:    entity.AuditSuccess,
+		Details:   "",
+	}
+
+	if err != nil {
+		event.Result = entity.AuditFailure
+		event.Details = err.Error()
+	}
+
+	return event
+}
+
+// detach Контекст для записи, которая должна выполниться, даже если клиент уже разорвал соединение: аудит,
+// учет неудачных попыток входа. Иначе, например, перебор паролей можно было бы вести, разрывая соединение
+// до учета неудачной попытки. Из контекста запроса берется только трассировка
+func detach(ctx context.Context) context.Context {
+	return trace.ContextWithSpanContext(context.Background(), trace.SpanContextFromContext(ctx))
+}
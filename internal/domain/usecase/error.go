@@ -1,8 +1,43 @@
 package usecase
 
-import "errors"
+import (
+	"errors"
+
+	"github.com/n-r-w/log-server-v2/internal/domain/entity"
+)
 
 var (
 	errNotAdmin     = errors.New("not admin user")
 	errUserNotFound = errors.New("user not found")
+
+	errSessionNotFound = errors.New("session not found")
+	errUnauthorized    = errors.New("unauthorized")
+
+	errIncorrectPassword = errors.New("incorrect email or password")
+
+	errTokenAuthDisabled = errors.New("bearer token authentication is not configured")
+	errForeignUser       = errors.New("user is managed by another authentication provider")
+	errProviderFailed    = errors.New("authentication provider is unavailable")
+
+	errIncorrectCode       = errors.New("incorrect two-factor code")
+	errTwoFactorEnabled    = errors.New("two-factor authentication is already enabled")
+	errTwoFactorNotEnabled = errors.New("two-factor authentication is not enabled")
+	errTwoFactorRequired   = errors.New("two-factor authentication is required, log in with a password and a code")
+	errUnknownRole         = errors.New("unknown role")
+
+	errReservedSource  = validationError("source " + entity.ServerLogSource + " is reserved for the server's own records")
+	errUnknownLogGroup = errors.New("unknown log group")
 )
+
+// validationError ошибка в данных запроса. Метод InvalidRequest позволяет обработчику запроса
+// отличить ее от ошибок сервера, не завися от пакета usecase
+type validationError string
+
+func (e validationError) Error() string {
+	return string(e)
+}
+
+// InvalidRequest Ошибка в данных запроса
+func (e validationError) InvalidRequest() bool {
+	return true
+}
@@ -0,0 +1,47 @@
+package usecase
+
+import (
+	"context"
+
+	"github.com/n-r-w/log-server-v2/internal/domain/entity"
+)
+
+type healthUseCase struct {
+	components []HealthInterface
+}
+
+func NewHealthCase(components ...HealthInterface) *healthUseCase {
+	return &healthUseCase{
+		components: components,
+	}
+}
+
+// Health Состояние сервера. Сервер недоступен, если недоступен хотя бы один из компонентов
+func (h *healthUseCase) Health(ctx context.Context) entity.Health {
+	health := entity.Health{
+		Status:     entity.HealthOK,
+		Components: []entity.ComponentHealth{},
+	}
+
+	for _, c := range h.components {
+		for _, component := range c.Health(ctx) {
+			if healthSeverity(component.Status) > healthSeverity(health.Status) {
+				health.Status = component.Status
+			}
+			health.Components = append(health.Components, component)
+		}
+	}
+
+	return health
+}
+
+func healthSeverity(status string) int {
+	switch status {
+	case entity.HealthOK:
+		return 0
+	case entity.HealthDegraded:
+		return 1
+	default:
+		return 2
+	}
+}
@@ -1,6 +1,7 @@
 package usecase
 
 import (
+	"context"
 	"time"
 
 	"github.com/n-r-w/log-server-v2/internal/domain/entity"
@@ -11,20 +12,107 @@ type (
 	// UserInterface Интерфейс работы с данными пользователей
 	UserInterface interface {
 		// Insert добавить нового пользователя. ID прописывается в модель
-		Insert(user entity.User) error
-		Remove(userID uint64) error
-		Update(user entity.User) error
-		ChangePassword(userID uint64, password string) error
+		Insert(ctx context.Context, user entity.User) error
+		Remove(ctx context.Context, userID uint64) error
+		Update(ctx context.Context, user entity.User) error
+		ChangePassword(ctx context.Context, userID uint64, password string) error
+		// UpdatePasswordHash заменить хэш пароля без проверки самого пароля
+		UpdatePasswordHash(ctx context.Context, userID uint64, encryptedPassword string) error
 
-		FindByID(userID uint64) (entity.User, error)
-		FindByLogin(login string) (entity.User, error)
-		GetUsers() ([]entity.User, error)
+		FindByID(ctx context.Context, userID uint64) (entity.User, error)
+		FindByLogin(ctx context.Context, login string) (entity.User, error)
+		GetUsers(ctx context.Context) ([]entity.User, error)
+	}
+
+	// SessionInterface Интерфейс хранилища сессий пользователей
+	SessionInterface interface {
+		Insert(ctx context.Context, session entity.Session) error
+		// FindByID поиск сессии. Если не найдена, то возвращается пустая сессия
+		FindByID(ctx context.Context, sessionID string) (entity.Session, error)
+		// FindByUser действующие на момент now сессии пользователя
+		FindByUser(ctx context.Context, userID uint64, now time.Time) ([]entity.Session, error)
+		Remove(ctx context.Context, sessionID string) error
+		RemoveByUser(ctx context.Context, userID uint64) error
+		// RemoveExpired удалить сессии, срок действия которых истек к моменту now
+		RemoveExpired(ctx context.Context, now time.Time) error
+	}
+
+	// LoginFailureInterface Интерфейс хранилища неудачных попыток входа
+	LoginFailureInterface interface {
+		// Find поиск по ключу. Если не найдено, то возвращается пустая запись
+		Find(ctx context.Context, key string) (entity.LoginFailure, error)
+		// AddFailure учесть неудачную попытку. Если предыдущая была раньше resetBefore, то счет начинается заново
+		AddFailure(ctx context.Context, key string, now time.Time, resetBefore time.Time) (entity.LoginFailure, error)
+		// SubtractFailure отменить попытку, учтенную AddFailure
+		SubtractFailure(ctx context.Context, key string) error
+		// Lock запретить вход до момента until
+		Lock(ctx context.Context, key string, until time.Time) error
+		Remove(ctx context.Context, key string) error
+		// RemoveExpired удалить записи, неудачи в которых были раньше before и блокировка которых снята
+		RemoveExpired(ctx context.Context, before time.Time) error
+	}
+
+	// TwoFactorInterface Интерфейс хранилища вторых факторов пользователей и правил их обязательности
+	TwoFactorInterface interface {
+		// Find поиск по пользователю. Если не найден, то возвращается пустая запись
+		Find(ctx context.Context, userID uint64) (entity.TOTP, error)
+		// Save добавить или заменить запись пользователя
+		Save(ctx context.Context, totp entity.TOTP) error
+		Remove(ctx context.Context, userID uint64) error
+		// UseStep принять код периода step. false - код этого или более позднего периода уже использовался
+		UseStep(ctx context.Context, userID uint64, step int64) (bool, error)
+		// UseRecoveryCode удалить резервный код по хэшу. false - такого кода нет
+		UseRecoveryCode(ctx context.Context, userID uint64, codeHash string) (bool, error)
+
+		GetPolicies(ctx context.Context) ([]entity.TwoFactorPolicy, error)
+		SetPolicy(ctx context.Context, policy entity.TwoFactorPolicy) error
+	}
+
+	// LoginChallengeInterface Интерфейс хранилища незавершенных входов, ожидающих второй фактор
+	LoginChallengeInterface interface {
+		Insert(ctx context.Context, challenge entity.LoginChallenge) error
+		// FindByID поиск. Если не найден, то возвращается пустая запись
+		FindByID(ctx context.Context, challengeID string) (entity.LoginChallenge, error)
+		// AddAttempt учесть неверный код. Возвращает количество неверных кодов
+		AddAttempt(ctx context.Context, challengeID string) (int, error)
+		Remove(ctx context.Context, challengeID string) error
+		// RemoveExpired удалить записи, срок действия которых истек к моменту now
+		RemoveExpired(ctx context.Context, now time.Time) error
+	}
+
+	// TokenVerifierInterface Проверка токенов, выданных внешним провайдером аутентификации (OIDC)
+	TokenVerifierInterface interface {
+		// Verify проверка токена. Возвращает пользователя, которому выдан токен
+		Verify(ctx context.Context, token string) (entity.Identity, error)
+	}
+
+	// PasswordVerifierInterface Проверка логина и пароля внешним провайдером аутентификации (LDAP)
+	PasswordVerifierInterface interface {
+		// Authenticate проверка пароля. Пустой Identity без ошибки - пользователь не найден или пароль не подошел.
+		// Ошибка возвращается только при недоступности провайдера
+		Authenticate(ctx context.Context, login string, password string) (entity.Identity, error)
+	}
+
+	// AuditInterface Интерфейс журнала аудита
+	AuditInterface interface {
+		Insert(ctx context.Context, event entity.AuditEvent) error
+		// Find поиск событий. Последние события в начале
+		Find(ctx context.Context, query entity.AuditQuery) ([]entity.AuditEvent, error)
 	}
 
 	// LogInterface Интерфейс работы с журналом
 	LogInterface interface {
-		Insert(records []entity.LogRecord) error
-		Find(dateFrom time.Time, dateTo time.Time, limit int) (records []entity.LogRecord, limited bool, err error)
+		Insert(ctx context.Context, records []entity.LogRecord) error
+		// Find поиск записей. limited - найдены не все записи, подходящие под условия, из-за ограничения query.Limit
+		Find(ctx context.Context, query entity.LogQuery) (records []entity.LogRecord, limited bool, err error)
+		// Count количество записей по группам entity.LogGroup*, упорядоченное по LogCount.Key (побайтно).
+		// query.Limit и query.Cursor не учитываются
+		Count(ctx context.Context, query entity.LogQuery, group string) ([]entity.LogCount, error)
 		PoolSize() int
 	}
+
+	// HealthInterface Состояние компонентов сервера: БД, буфера записи и т.п.
+	HealthInterface interface {
+		Health(ctx context.Context) []entity.ComponentHealth
+	}
 )
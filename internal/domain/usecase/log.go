@@ -3,11 +3,16 @@
 package usecase
 
 import (
-	"time"
+	"context"
 
 	"github.com/n-r-w/log-server-v2/internal/domain/entity"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 )
 
+var tracer = otel.Tracer("github.com/n-r-w/log-server-v2/internal/domain/usecase")
+
 type logUseCase struct {
 	repo LogInterface
 }
@@ -18,11 +23,61 @@ func NewLogCase(r LogInterface) *logUseCase {
 	}
 }
 
-func (l *logUseCase) Insert(logs []entity.LogRecord) error {
-	return l.repo.Insert(logs)
+func (l *logUseCase) Insert(ctx context.Context, logs []entity.LogRecord) (err error) {
+	ctx, span := tracer.Start(ctx, "log.Insert")
+	defer func() {
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	span.SetAttributes(attribute.Int("log.records", len(logs)))
+
+	for i := range logs {
+		if logs[i].Source == entity.ServerLogSource {
+			return errReservedSource
+		}
+	}
+
+	return l.repo.Insert(ctx, logs)
 }
 
-func (l *logUseCase) Find(dateFrom time.Time, dateTo time.Time, limit int) (records []entity.LogRecord, limited bool, err error) {
-	r, lim, e := l.repo.Find(dateFrom, dateTo, limit)
+func (l *logUseCase) Find(ctx context.Context, query entity.LogQuery) (records []entity.LogRecord, limited bool, err error) {
+	ctx, span := tracer.Start(ctx, "log.Find")
+	defer func() {
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	r, lim, e := l.repo.Find(ctx, query)
+	span.SetAttributes(attribute.Int("log.records", len(r)), attribute.Bool("log.limited", lim))
+
 	return r, lim, e
 }
+
+func (l *logUseCase) Count(ctx context.Context, query entity.LogQuery, group string) (counts []entity.LogCount, err error) {
+	ctx, span := tracer.Start(ctx, "log.Count")
+	defer func() {
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	span.SetAttributes(attribute.String("log.group", group))
+
+	if !entity.ValidLogGroup(group) {
+		return nil, errUnknownLogGroup
+	}
+
+	query.Limit = 0
+	query.Cursor = nil
+
+	counts, err = l.repo.Count(ctx, query, group)
+	span.SetAttributes(attribute.Int("log.groups", len(counts)))
+
+	return counts, err
+}
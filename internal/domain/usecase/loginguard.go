@@ -0,0 +1,282 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/n-r-w/log-server-v2/internal/domain/entity"
+)
+
+// Префиксы ключей в хранилище неудачных попыток входа
+const (
+	loginFailureKeyLogin   = "login:"
+	loginFailureKeyAddress = "address:"
+	// неверные коды второго фактора в настройках учетной записи
+	loginFailureKeyTwoFactor = "2fa:"
+)
+
+// LoginLimits Ограничения на попытки входа. Нулевые значения отключают соответствующее ограничение
+type LoginLimits struct {
+	// MaxLoginFailures количество неудачных попыток подряд для одного логина, после которого он блокируется
+	MaxLoginFailures int
+	// MaxAddressFailures количество неудачных попыток подряд с одного адреса, после которого он блокируется
+	MaxAddressFailures int
+	// Delay задержка после первой неудачной попытки. После каждой следующей удваивается, но не больше Lockout
+	Delay time.Duration
+	// Lockout время блокировки. Также через это время после последней неудачи счетчик попыток обнуляется
+	Lockout time.Duration
+}
+
+// loginThrottledError вход временно запрещен. Метод RetryAfter позволяет обработчику запроса
+// сообщить клиенту, когда можно повторить попытку, не завися от пакета usecase
+type loginThrottledError struct {
+	retryAfter time.Duration
+}
+
+func (e *loginThrottledError) Error() string {
+	return fmt.Sprintf("too many failed login attempts, try again in %d seconds", e.seconds())
+}
+
+// RetryAfter Через какое время можно повторить попытку
+func (e *loginThrottledError) RetryAfter() time.Duration {
+	return e.retryAfter
+}
+
+func (e *loginThrottledError) seconds() int {
+	return int((e.retryAfter + time.Second - 1) / time.Second)
+}
+
+// loginGuard Защита от подбора паролей: прогрессивная задержка между неудачными попытками
+// и временная блокировка логина и адреса клиента
+type loginGuard struct {
+	repo  LoginFailureInterface
+	audit *auditUseCase
+
+	mu     sync.RWMutex
+	limits LoginLimits
+}
+
+// NewLoginGuard Общая для входа по паролю и проверки кодов второго фактора защита от подбора
+func NewLoginGuard(r LoginFailureInterface, limits LoginLimits, audit *auditUseCase) *loginGuard {
+	return &loginGuard{
+		repo:   r,
+		audit:  audit,
+		limits: limits,
+	}
+}
+
+// getLimits Текущие ограничения. Могут быть изменены без перезапуска сервера
+func (g *loginGuard) getLimits() LoginLimits {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	return g.limits
+}
+
+func (g *loginGuard) setLimits(limits LoginLimits) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.limits = limits
+}
+
+func loginKey(login string) string {
+	return loginFailureKeyLogin + strings.ToLower(strings.TrimSpace(login))
+}
+
+func twoFactorKey(login string) string {
+	return loginFailureKeyTwoFactor + strings.ToLower(strings.TrimSpace(login))
+}
+
+func addressKey(address string) string {
+	return loginFailureKeyAddress + address
+}
+
+// loginAttempt Попытка входа, заранее учтенная в счетчиках неудач. После проверки пароля
+// должен быть вызван один из методов failed, succeeded или cancel
+type loginAttempt struct {
+	guard    *loginGuard
+	now      time.Time
+	login    string
+	req      entity.RequestInfo
+	limits   LoginLimits
+	failures []entity.LoginFailure
+}
+
+// begin Проверка, разрешена ли сейчас попытка входа, и ее учет. Попытка засчитывается как неудачная еще
+// до проверки пароля: проверка лимита и увеличение счетчика выполняются одним запросом к хранилищу,
+// поэтому параллельные попытки не могут превысить лимит. key - счетчик логина (loginKey, twoFactorKey)
+func (g *loginGuard) begin(ctx context.Context, now time.Time, key string, login string, req entity.RequestInfo) (*loginAttempt, error) {
+	keys := g.keys(key, req.Address)
+	limits := g.getLimits()
+
+	if err := g.check(ctx, now, limits, keys); err != nil {
+		return nil, err
+	}
+
+	a := &loginAttempt{
+		guard:    g,
+		now:      now,
+		login:    login,
+		req:      req,
+		limits:   limits,
+		failures: make([]entity.LoginFailure, 0, len(keys)),
+	}
+
+	for _, key := range keys {
+		f, err := g.repo.AddFailure(detach(ctx), key, now, now.Add(-limits.Lockout))
+		if err != nil {
+			a.cancel(ctx)
+
+			return nil, err
+		}
+		a.failures = append(a.failures, f)
+
+		// лимит уже исчерпан параллельными попытками, которые еще не завершились
+		if max := limits.max(key); max > 0 && f.Failures > max {
+			a.cancel(ctx)
+
+			retryAfter := limits.Lockout
+			if retryAfter < time.Second {
+				retryAfter = time.Second
+			}
+
+			return nil, &loginThrottledError{retryAfter: retryAfter}
+		}
+	}
+
+	return a, nil
+}
+
+// check Не истекли ли задержка после предыдущей неудачи и блокировка
+func (g *loginGuard) check(ctx context.Context, now time.Time, limits LoginLimits, keys []string) error {
+	var wait time.Duration
+
+	for _, key := range keys {
+		f, err := g.repo.Find(ctx, key)
+		if err != nil {
+			return err
+		}
+
+		if f.IsEmpty() || (f.LastFailure.Before(now.Add(-limits.Lockout)) && !f.IsLocked(now)) {
+			continue
+		}
+
+		next := f.LastFailure.Add(limits.delay(f.Failures))
+		if f.IsLocked(now) && f.LockedUntil.After(next) {
+			next = f.LockedUntil
+		}
+
+		if d := next.Sub(now); d > wait {
+			wait = d
+		}
+	}
+
+	if wait > 0 {
+		return &loginThrottledError{retryAfter: wait}
+	}
+
+	return nil
+}
+
+// failed Неудачная попытка. Она уже учтена в begin, остается при превышении лимита заблокировать логин или адрес
+func (a *loginAttempt) failed(ctx context.Context) error {
+	ctx = detach(ctx)
+	for _, f := range a.failures {
+		if max := a.limits.max(f.Key); max <= 0 || f.Failures < max {
+			continue
+		}
+
+		if err := a.guard.repo.Lock(ctx, f.Key, a.now.Add(a.limits.Lockout)); err != nil {
+			return err
+		}
+
+		a.guard.audit.logger.Warn("login lockout: %s locked for %v after %d failed attempts", f.Key, a.limits.Lockout, f.Failures)
+
+		event := newAuditEvent(entity.User{Login: strings.TrimSpace(a.login)}, entity.AuditLoginLockout, f.Key, a.req, nil)
+		event.Details = fmt.Sprintf("%d failed attempts, locked for %v", f.Failures, a.limits.Lockout)
+		a.guard.audit.write(ctx, event)
+	}
+
+	return nil
+}
+
+// succeeded Успешный вход обнуляет счетчик логина. Счетчик адреса не обнуляется, иначе перебор
+// с одного адреса можно было бы продолжать, периодически входя под своим логином. С него снимается
+// только сама эта попытка
+func (a *loginAttempt) succeeded(ctx context.Context) error {
+	ctx = detach(ctx)
+	for _, f := range a.failures {
+		var err error
+		if strings.HasPrefix(f.Key, loginFailureKeyAddress) {
+			err = a.guard.repo.SubtractFailure(ctx, f.Key)
+		} else {
+			err = a.guard.repo.Remove(ctx, f.Key)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	// заодно чистим хранилище от устаревших записей
+	return a.guard.repo.RemoveExpired(ctx, a.now.Add(-a.limits.Lockout))
+}
+
+// cancel Попытка не состоялась из-за ошибки, не связанной с паролем, и не должна учитываться
+func (a *loginAttempt) cancel(ctx context.Context) {
+	ctx = detach(ctx)
+	for _, f := range a.failures {
+		if err := a.guard.repo.SubtractFailure(ctx, f.Key); err != nil {
+			a.guard.audit.logger.Warn("login attempt cancel for %s: %v", f.Key, err)
+		}
+	}
+}
+
+// unlock Снятие блокировки логина, в том числе для кодов второго фактора
+func (g *loginGuard) unlock(ctx context.Context, login string) error {
+	if err := g.repo.Remove(ctx, loginKey(login)); err != nil {
+		return err
+	}
+
+	return g.repo.Remove(ctx, twoFactorKey(login)) //nolint:wrapcheck
+}
+
+func (g *loginGuard) keys(key string, address string) []string {
+	keys := []string{key}
+	if address != "" {
+		keys = append(keys, addressKey(address))
+	}
+
+	return keys
+}
+
+// max Количество неудачных попыток подряд, после которого ключ блокируется
+func (l LoginLimits) max(key string) int {
+	if strings.HasPrefix(key, loginFailureKeyAddress) {
+		return l.MaxAddressFailures
+	}
+
+	return l.MaxLoginFailures
+}
+
+// delay Задержка после failures неудачных попыток подряд
+func (l LoginLimits) delay(failures int) time.Duration {
+	if l.Delay <= 0 || failures <= 0 {
+		return 0
+	}
+
+	d := l.Delay
+	for i := 1; i < failures && d < l.Lockout; i++ {
+		d *= 2
+	}
+
+	if l.Lockout > 0 && d > l.Lockout {
+		d = l.Lockout
+	}
+
+	return d
+}
@@ -0,0 +1,202 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/n-r-w/log-server-v2/internal/domain/entity"
+	"github.com/n-r-w/log-server-v2/pkg/logger"
+)
+
+// memoryLoginFailures Хранилище неудачных попыток в памяти с теми же гарантиями атомарности, что и в БД
+type memoryLoginFailures struct {
+	mu       sync.Mutex
+	failures map[string]entity.LoginFailure
+}
+
+func (m *memoryLoginFailures) Find(_ context.Context, key string) (entity.LoginFailure, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.failures[key], nil
+}
+
+func (m *memoryLoginFailures) AddFailure(_ context.Context, key string, now time.Time, resetBefore time.Time) (entity.LoginFailure, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, ok := m.failures[key]
+	if !ok || f.LastFailure.Before(resetBefore) {
+		f = entity.LoginFailure{Key: key, Failures: 0, LastFailure: now, LockedUntil: f.LockedUntil}
+	}
+	f.Failures++
+	f.LastFailure = now
+	m.failures[key] = f
+
+	return f, nil
+}
+
+func (m *memoryLoginFailures) SubtractFailure(_ context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if f, ok := m.failures[key]; ok && f.Failures > 0 {
+		f.Failures--
+		m.failures[key] = f
+	}
+
+	return nil
+}
+
+func (m *memoryLoginFailures) Lock(_ context.Context, key string, until time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if f, ok := m.failures[key]; ok {
+		f.LockedUntil = until
+		m.failures[key] = f
+	}
+
+	return nil
+}
+
+func (m *memoryLoginFailures) Remove(_ context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.failures, key)
+
+	return nil
+}
+
+func (m *memoryLoginFailures) RemoveExpired(_ context.Context, before time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for key, f := range m.failures {
+		if f.LastFailure.Before(before) && f.LockedUntil.Before(before) {
+			delete(m.failures, key)
+		}
+	}
+
+	return nil
+}
+
+type discardAudit struct{}
+
+func (discardAudit) Insert(context.Context, entity.AuditEvent) error {
+	return nil
+}
+
+func (discardAudit) Find(context.Context, entity.AuditQuery) ([]entity.AuditEvent, error) {
+	return nil, nil
+}
+
+func newTestGuard(limits LoginLimits) (*loginGuard, *memoryLoginFailures) {
+	repo := &memoryLoginFailures{
+		mu:       sync.Mutex{},
+		failures: map[string]entity.LoginFailure{},
+	}
+
+	return NewLoginGuard(repo, limits, NewAuditCase(discardAudit{}, logger.New())), repo
+}
+
+// Параллельные попытки не должны превышать лимит, даже если ни одна из них еще не завершилась
+func TestLoginGuardParallelAttempts(t *testing.T) {
+	const max = 3
+	g, repo := newTestGuard(LoginLimits{MaxLoginFailures: max, MaxAddressFailures: 0, Delay: 0, Lockout: time.Minute})
+	ctx := context.Background()
+	now := time.Now().UTC()
+	req := entity.RequestInfo{Address: "10.0.0.1", RequestID: ""}
+
+	var (
+		mu       sync.Mutex
+		attempts []*loginAttempt
+		wg       sync.WaitGroup
+	)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			a, err := g.begin(ctx, now, loginKey("alice"), "alice", req)
+			if err != nil {
+				var throttled *loginThrottledError
+				if !errors.As(err, &throttled) {
+					t.Error(err)
+				}
+
+				return
+			}
+
+			mu.Lock()
+			attempts = append(attempts, a)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	if len(attempts) != max {
+		t.Fatalf("expected %d allowed attempts, got %d", max, len(attempts))
+	}
+
+	for _, a := range attempts {
+		if err := a.failed(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f, _ := repo.Find(ctx, loginKey("alice"))
+	if f.Failures != max || !f.IsLocked(now) {
+		t.Fatalf("expected %d failures and lock, got %+v", max, f)
+	}
+
+	if _, err := g.begin(ctx, now, loginKey("alice"), "alice", req); err == nil {
+		t.Fatal("expected locked login")
+	}
+}
+
+func TestLoginGuardSucceededAndCancel(t *testing.T) {
+	g, repo := newTestGuard(LoginLimits{MaxLoginFailures: 5, MaxAddressFailures: 5, Delay: 0, Lockout: time.Minute})
+	ctx := context.Background()
+	now := time.Now().UTC()
+	req := entity.RequestInfo{Address: "10.0.0.1", RequestID: ""}
+
+	a, err := g.begin(ctx, now, loginKey("alice"), "alice", req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.failed(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// отмененная попытка не учитывается
+	a, err = g.begin(ctx, now, loginKey("alice"), "alice", req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.cancel(ctx)
+
+	if f, _ := repo.Find(ctx, loginKey("alice")); f.Failures != 1 {
+		t.Fatalf("expected 1 login failure, got %d", f.Failures)
+	}
+
+	// успешный вход обнуляет счетчик логина, но не адреса
+	a, err = g.begin(ctx, now, loginKey("alice"), "alice", req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.succeeded(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if f, _ := repo.Find(ctx, loginKey("alice")); !f.IsEmpty() {
+		t.Fatalf("expected no login failures, got %d", f.Failures)
+	}
+	if f, _ := repo.Find(ctx, addressKey(req.Address)); f.Failures != 1 {
+		t.Fatalf("expected 1 address failure, got %d", f.Failures)
+	}
+}
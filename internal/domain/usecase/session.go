@@ -0,0 +1,167 @@
+// Package usecase Сценарии работы с сессиями пользователей. Сессии хранятся на сервере,
+// поэтому их можно завершить принудительно, в отличие от сессий, целиком хранящихся в куках
+package usecase
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/n-r-w/log-server-v2/internal/domain/entity"
+	"github.com/n-r-w/log-server-v2/pkg/tools"
+)
+
+// Размер случайного токена сессии в байтах
+const sessionTokenSize = 32
+
+type sessionUseCase struct {
+	repo  SessionInterface
+	users UserInterface
+	audit *auditUseCase
+}
+
+func NewSessionCase(r SessionInterface, users UserInterface, audit *auditUseCase) *sessionUseCase {
+	return &sessionUseCase{
+		repo:  r,
+		users: users,
+		audit: audit,
+	}
+}
+
+// Start Создать сессию. Возвращает токен, который надо передать клиенту
+func (s *sessionUseCase) Start(ctx context.Context, userID uint64, sessionAge int, address string, userAgent string) (token string, err error) {
+	token, err = tools.RandomToken(sessionTokenSize)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now().UTC()
+
+	// заодно чистим хранилище от устаревших сессий
+	if err = s.repo.RemoveExpired(ctx, now); err != nil {
+		return "", err
+	}
+
+	session := entity.Session{
+		ID:        tools.HashToken(token),
+		UserID:    userID,
+		CreatedAt: now,
+		ExpiresAt: now.Add(time.Duration(sessionAge) * time.Second),
+		Address:   address,
+		UserAgent: userAgent,
+	}
+
+	if err = s.repo.Insert(ctx, session); err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// Check Проверить токен сессии. Возвращает действующую сессию
+func (s *sessionUseCase) Check(ctx context.Context, token string) (entity.Session, error) {
+	session, err := s.repo.FindByID(ctx, tools.HashToken(token))
+	if err != nil {
+		return entity.Session{}, err
+	}
+
+	if session.IsEmpty() || session.IsExpired(time.Now().UTC()) {
+		return entity.Session{}, errUnauthorized
+	}
+
+	return session, nil
+}
+
+// Close Завершить сессию по токену (выход пользователя)
+func (s *sessionUseCase) Close(ctx context.Context, token string, req entity.RequestInfo) error {
+	sessionID := tools.HashToken(token)
+
+	session, err := s.repo.FindByID(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+
+	if session.IsEmpty() {
+		// сессия уже завершена, выходить не из чего
+		return nil
+	}
+
+	user, err := s.users.FindByID(ctx, session.UserID)
+	if err != nil {
+		return err
+	}
+
+	err = s.repo.Remove(ctx, sessionID)
+	s.audit.event(ctx, user, entity.AuditLogout, user.Login, req, err)
+
+	return err
+}
+
+// GetSessions Действующие сессии пользователя. Чужие сессии может смотреть только админ
+func (s *sessionUseCase) GetSessions(ctx context.Context, currentUser entity.User, login string) ([]entity.Session, error) {
+	userID, err := s.targetUser(ctx, currentUser, login)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.repo.FindByUser(ctx, userID, time.Now().UTC()) //nolint:wrapcheck
+}
+
+// CloseSession Завершить сессию по ее ID. Чужие сессии может завершать только админ
+func (s *sessionUseCase) CloseSession(ctx context.Context, currentUser entity.User, sessionID string, req entity.RequestInfo) (err error) {
+	defer func() { s.audit.event(ctx, currentUser, entity.AuditCloseSession, sessionID, req, err) }()
+
+	session, err := s.repo.FindByID(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+
+	if session.IsEmpty() {
+		return errSessionNotFound
+	}
+
+	if session.UserID != currentUser.ID && !currentUser.IsAdmin() {
+		return errNotAdmin
+	}
+
+	return s.repo.Remove(ctx, sessionID) //nolint:wrapcheck
+}
+
+// CloseUserSessions Завершить все сессии пользователя. Чужие сессии может завершать только админ
+func (s *sessionUseCase) CloseUserSessions(ctx context.Context, currentUser entity.User, login string, req entity.RequestInfo) (err error) {
+	target := strings.TrimSpace(login)
+	if target == "" {
+		target = currentUser.Login
+	}
+	defer func() { s.audit.event(ctx, currentUser, entity.AuditRevokeSessions, target, req, err) }()
+
+	userID, err := s.targetUser(ctx, currentUser, login)
+	if err != nil {
+		return err
+	}
+
+	return s.repo.RemoveByUser(ctx, userID) //nolint:wrapcheck
+}
+
+// targetUser ID пользователя, над сессиями которого выполняется действие. Пустой логин - текущий пользователь
+func (s *sessionUseCase) targetUser(ctx context.Context, currentUser entity.User, login string) (uint64, error) {
+	login = strings.TrimSpace(login)
+	if login == "" || login == currentUser.Login {
+		return currentUser.ID, nil
+	}
+
+	if !currentUser.IsAdmin() {
+		return 0, errNotAdmin
+	}
+
+	user, err := s.users.FindByLogin(ctx, login)
+	if err != nil {
+		return 0, err
+	}
+
+	if user.IsEmpty() {
+		return 0, errUserNotFound
+	}
+
+	return user.ID, nil
+}
@@ -0,0 +1,545 @@
+// Package usecase Сценарии работы со вторым фактором аутентификации (TOTP). Если второй фактор подключен
+// или обязателен для роли пользователя, то после проверки пароля вход не завершается, а выдается токен
+// незавершенного входа, который надо подтвердить кодом из приложения или резервным кодом
+package usecase
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/n-r-w/log-server-v2/internal/domain/entity"
+	"github.com/n-r-w/log-server-v2/pkg/tools"
+	"github.com/n-r-w/log-server-v2/pkg/totp"
+)
+
+const (
+	// Количество резервных кодов, выдаваемых за раз
+	recoveryCodeCount = 10
+	// Длина резервного кода без разделителя
+	recoveryCodeSize = 10
+	// Допустимое расхождение часов клиента в периодах TOTP
+	totpSkew = 1
+
+	recoveryCodeAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+)
+
+// TwoFactorSettings Параметры второго фактора
+type TwoFactorSettings struct {
+	// Issuer название сервиса в приложении-аутентификаторе
+	Issuer string
+	// ChallengeAge время, за которое надо ввести код после проверки пароля
+	ChallengeAge time.Duration
+	// MaxAttempts количество неверных кодов, после которого вход надо начинать заново
+	MaxAttempts int
+}
+
+type twoFactorUseCase struct {
+	repo       TwoFactorInterface
+	challenges LoginChallengeInterface
+	users      UserInterface
+	guard      *loginGuard
+	audit      *auditUseCase
+	settings   TwoFactorSettings
+}
+
+func NewTwoFactorCase(r TwoFactorInterface, challenges LoginChallengeInterface, users UserInterface, guard *loginGuard,
+	audit *auditUseCase, settings TwoFactorSettings) *twoFactorUseCase {
+	return &twoFactorUseCase{
+		repo:       r,
+		challenges: challenges,
+		users:      users,
+		guard:      guard,
+		audit:      audit,
+		settings:   settings,
+	}
+}
+
+// StartLogin Вызывается после успешной проверки пароля. Если второй фактор не нужен, то возвращается пустой
+// результат и вход можно завершать. Иначе возвращается токен незавершенного входа, а если второй фактор
+// обязателен, но не подключен, то и данные для его подключения
+func (t *twoFactorUseCase) StartLogin(ctx context.Context, userID uint64) (entity.LoginStep, error) {
+	user, err := t.users.FindByID(ctx, userID)
+	if err != nil {
+		return entity.LoginStep{}, err
+	}
+
+	factor, err := t.repo.Find(ctx, userID)
+	if err != nil {
+		return entity.LoginStep{}, err
+	}
+
+	var enrolment *entity.TOTPEnrolment
+
+	if !factor.Enabled {
+		required, err := t.isRequired(ctx, user.Role)
+		if err != nil || !required {
+			return entity.LoginStep{}, err
+		}
+
+		// секрет, выданный при прошлой незавершенной попытке, сохраняется, чтобы приложение, в которое
+		// его уже добавили, продолжало подходить
+		if factor.IsEmpty() {
+			if factor, err = t.newFactor(ctx, userID); err != nil {
+				return entity.LoginStep{}, err
+			}
+		}
+
+		enrolment = &entity.TOTPEnrolment{
+			Secret: factor.Secret,
+			URI:    totp.URI(t.settings.Issuer, user.Login, factor.Secret),
+		}
+	}
+
+	token, err := tools.RandomToken(sessionTokenSize)
+	if err != nil {
+		return entity.LoginStep{}, err
+	}
+
+	now := time.Now().UTC()
+
+	// заодно чистим хранилище от устаревших записей
+	if err = t.challenges.RemoveExpired(ctx, now); err != nil {
+		return entity.LoginStep{}, err
+	}
+
+	if err = t.challenges.Insert(ctx, entity.LoginChallenge{
+		ID:        tools.HashToken(token),
+		UserID:    userID,
+		ExpiresAt: now.Add(t.settings.ChallengeAge),
+		Attempts:  0,
+	}); err != nil {
+		return entity.LoginStep{}, err
+	}
+
+	return entity.LoginStep{
+		TwoFactorRequired: true,
+		Challenge:         token,
+		Enrolment:         enrolment,
+	}, nil
+}
+
+// CheckWithoutCode Проверка, может ли пользователь войти без кода второго фактора: по bearer токену
+// или сертификату клиента, где ввести код негде. Если второй фактор подключен или обязателен для роли
+// пользователя, то так входить нельзя
+func (t *twoFactorUseCase) CheckWithoutCode(ctx context.Context, user entity.User) error {
+	factor, err := t.repo.Find(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+
+	required := factor.Enabled
+	if !required {
+		if required, err = t.isRequired(ctx, user.Role); err != nil {
+			return err
+		}
+	}
+
+	if required {
+		return errTwoFactorRequired
+	}
+
+	return nil
+}
+
+// CompleteLogin Проверка кода второго фактора для незавершенного входа. Если второй фактор подключался
+// при этом входе, то он включается и в результате возвращаются резервные коды
+func (t *twoFactorUseCase) CompleteLogin(ctx context.Context, challenge string, code string, req entity.RequestInfo) (result entity.LoginResult, err error) {
+	challengeID := tools.HashToken(challenge)
+
+	c, err := t.challenges.FindByID(ctx, challengeID)
+	if err != nil {
+		return entity.LoginResult{}, err
+	}
+
+	if c.IsEmpty() || c.IsExpired(time.Now().UTC()) {
+		return entity.LoginResult{}, errUnauthorized
+	}
+
+	// неверных кодов уже слишком много, вход надо начинать заново. Проверяется до проверки кода,
+	// иначе параллельные запросы с одним токеном могли бы перебирать коды сверх лимита
+	if c.Attempts >= t.settings.MaxAttempts {
+		if err = t.challenges.Remove(detach(ctx), challengeID); err != nil {
+			return entity.LoginResult{}, err
+		}
+
+		return entity.LoginResult{}, errUnauthorized
+	}
+
+	user, err := t.users.FindByID(ctx, c.UserID)
+	if err != nil {
+		return entity.LoginResult{}, err
+	}
+
+	defer func() { t.audit.event(ctx, user, entity.AuditLoginTwoFactor, user.Login, req, err) }()
+
+	factor, err := t.repo.Find(ctx, c.UserID)
+	if err != nil {
+		return entity.LoginResult{}, err
+	}
+
+	if factor.IsEmpty() {
+		// второй фактор отключили, пока вводился код
+		return entity.LoginResult{}, errUnauthorized
+	}
+
+	// при подключении резервных кодов еще нет. Неверные коды учитываются не только для этого входа, но и для
+	// пользователя в целом: иначе, зная пароль, можно было бы перебирать коды, каждый раз начиная вход заново
+	if err = t.checkCode(ctx, user, &factor, code, factor.Enabled, req); err != nil {
+		if !errors.Is(err, errIncorrectCode) {
+			return entity.LoginResult{}, err
+		}
+
+		// неверный код учитывается и после отмены запроса, иначе коды можно было бы перебирать без ограничений
+		attemptCtx := detach(ctx)
+		attempts, err := t.challenges.AddAttempt(attemptCtx, challengeID)
+		if err != nil {
+			return entity.LoginResult{}, err
+		}
+
+		if attempts >= t.settings.MaxAttempts {
+			if err = t.challenges.Remove(attemptCtx, challengeID); err != nil {
+				return entity.LoginResult{}, err
+			}
+		}
+
+		return entity.LoginResult{}, errIncorrectCode
+	}
+
+	if err = t.challenges.Remove(ctx, challengeID); err != nil {
+		return entity.LoginResult{}, err
+	}
+
+	result = entity.LoginResult{
+		UserID:        c.UserID,
+		RecoveryCodes: nil,
+	}
+
+	if !factor.Enabled {
+		if result.RecoveryCodes, err = t.enable(ctx, factor); err != nil {
+			return entity.LoginResult{}, err
+		}
+	}
+
+	return result, nil
+}
+
+// Status Состояние второго фактора текущего пользователя
+func (t *twoFactorUseCase) Status(ctx context.Context, currentUser entity.User) (entity.TwoFactorStatus, error) {
+	factor, err := t.repo.Find(ctx, currentUser.ID)
+	if err != nil {
+		return entity.TwoFactorStatus{}, err
+	}
+
+	required, err := t.isRequired(ctx, currentUser.Role)
+	if err != nil {
+		return entity.TwoFactorStatus{}, err
+	}
+
+	status := entity.TwoFactorStatus{
+		Enabled:           factor.Enabled,
+		Required:          required,
+		RecoveryCodesLeft: 0,
+	}
+
+	if factor.Enabled {
+		status.RecoveryCodesLeft = len(factor.RecoveryCodes)
+	}
+
+	return status, nil
+}
+
+// Enrol Начать подключение второго фактора. Возвращает секрет для приложения-аутентификатора.
+// Второй фактор начинает действовать после подтверждения кодом из приложения (Confirm)
+func (t *twoFactorUseCase) Enrol(ctx context.Context, currentUser entity.User) (entity.TOTPEnrolment, error) {
+	factor, err := t.repo.Find(ctx, currentUser.ID)
+	if err != nil {
+		return entity.TOTPEnrolment{}, err
+	}
+
+	if factor.Enabled {
+		return entity.TOTPEnrolment{}, errTwoFactorEnabled
+	}
+
+	if factor, err = t.newFactor(ctx, currentUser.ID); err != nil {
+		return entity.TOTPEnrolment{}, err
+	}
+
+	return entity.TOTPEnrolment{
+		Secret: factor.Secret,
+		URI:    totp.URI(t.settings.Issuer, currentUser.Login, factor.Secret),
+	}, nil
+}
+
+// Confirm Подтвердить подключение второго фактора кодом из приложения. Возвращает резервные коды
+func (t *twoFactorUseCase) Confirm(ctx context.Context, currentUser entity.User, code string, req entity.RequestInfo) (codes []string, err error) {
+	defer func() { t.audit.event(ctx, currentUser, entity.AuditEnableTwoFactor, currentUser.Login, req, err) }()
+
+	factor, err := t.repo.Find(ctx, currentUser.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if factor.IsEmpty() {
+		return nil, errTwoFactorNotEnabled
+	}
+
+	if factor.Enabled {
+		return nil, errTwoFactorEnabled
+	}
+
+	if err = t.checkCode(ctx, currentUser, &factor, code, false, req); err != nil {
+		return nil, err
+	}
+
+	return t.enable(ctx, factor)
+}
+
+// RegenerateRecoveryCodes Выдать новые резервные коды взамен старых. Требует код из приложения
+func (t *twoFactorUseCase) RegenerateRecoveryCodes(ctx context.Context, currentUser entity.User, code string, req entity.RequestInfo) (codes []string, err error) {
+	defer func() { t.audit.event(ctx, currentUser, entity.AuditRecoveryCodes, currentUser.Login, req, err) }()
+
+	factor, err := t.repo.Find(ctx, currentUser.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !factor.Enabled {
+		return nil, errTwoFactorNotEnabled
+	}
+
+	if err = t.checkCode(ctx, currentUser, &factor, code, false, req); err != nil {
+		return nil, err
+	}
+
+	return t.enable(ctx, factor)
+}
+
+// Disable Отключить второй фактор. Свой - с подтверждением кодом из приложения или резервным кодом,
+// чужой (например, при потере телефона) - только админ. Пустой логин - текущий пользователь
+func (t *twoFactorUseCase) Disable(ctx context.Context, currentUser entity.User, login string, code string, req entity.RequestInfo) (err error) {
+	target := strings.TrimSpace(login)
+	if target == "" {
+		target = currentUser.Login
+	}
+	defer func() { t.audit.event(ctx, currentUser, entity.AuditDisableTwoFactor, target, req, err) }()
+
+	if target == currentUser.Login {
+		factor, err := t.repo.Find(ctx, currentUser.ID)
+		if err != nil {
+			return err
+		}
+
+		if !factor.Enabled {
+			return errTwoFactorNotEnabled
+		}
+
+		if err = t.checkCode(ctx, currentUser, &factor, code, true, req); err != nil {
+			return err
+		}
+
+		return t.repo.Remove(ctx, currentUser.ID) //nolint:wrapcheck
+	}
+
+	if !currentUser.IsAdmin() {
+		return errNotAdmin
+	}
+
+	user, err := t.users.FindByLogin(ctx, target)
+	if err != nil {
+		return err
+	}
+
+	if user.IsEmpty() {
+		return errUserNotFound
+	}
+
+	return t.repo.Remove(ctx, user.ID) //nolint:wrapcheck
+}
+
+// Policies Обязательность второго фактора для всех ролей. Только для админа
+func (t *twoFactorUseCase) Policies(ctx context.Context, currentUser entity.User) ([]entity.TwoFactorPolicy, error) {
+	if !currentUser.IsAdmin() {
+		return nil, errNotAdmin
+	}
+
+	stored, err := t.repo.GetPolicies(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	policies := make([]entity.TwoFactorPolicy, 0, len(entity.Roles))
+	for _, role := range entity.Roles {
+		policy := entity.TwoFactorPolicy{Role: role, Required: false}
+		for _, p := range stored {
+			if p.Role == role {
+				policy.Required = p.Required
+			}
+		}
+
+		policies = append(policies, policy)
+	}
+
+	return policies, nil
+}
+
+// SetPolicy Сделать второй фактор обязательным или необязательным для роли. Только для админа.
+// Пользователи роли без второго фактора подключают его при следующем входе
+func (t *twoFactorUseCase) SetPolicy(ctx context.Context, currentUser entity.User, policy entity.TwoFactorPolicy, req entity.RequestInfo) (err error) {
+	defer func() {
+		event := newAuditEvent(currentUser, entity.AuditTwoFactorPolicy, policy.Role, req, err)
+		if err == nil {
+			event.Details = fmt.Sprintf("required: %v", policy.Required)
+		}
+		t.audit.write(ctx, event)
+	}()
+
+	if !currentUser.IsAdmin() {
+		return errNotAdmin
+	}
+
+	if !entity.IsValidRole(policy.Role) {
+		return errUnknownRole
+	}
+
+	return t.repo.SetPolicy(ctx, policy) //nolint:wrapcheck
+}
+
+// isRequired Обязателен ли второй фактор для роли
+func (t *twoFactorUseCase) isRequired(ctx context.Context, role string) (bool, error) {
+	policies, err := t.repo.GetPolicies(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	for _, p := range policies {
+		if p.Role == role {
+			return p.Required, nil
+		}
+	}
+
+	return false, nil
+}
+
+// newFactor Новый секрет, еще не подтвержденный кодом из приложения
+func (t *twoFactorUseCase) newFactor(ctx context.Context, userID uint64) (entity.TOTP, error) {
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return entity.TOTP{}, err
+	}
+
+	factor := entity.TOTP{
+		UserID:        userID,
+		Secret:        secret,
+		Enabled:       false,
+		LastStep:      0,
+		RecoveryCodes: nil,
+	}
+
+	if err = t.repo.Save(ctx, factor); err != nil {
+		return entity.TOTP{}, err
+	}
+
+	return factor, nil
+}
+
+// enable Включить второй фактор с новыми резервными кодами. Возвращает коды, на сервере хранятся только их хэши
+func (t *twoFactorUseCase) enable(ctx context.Context, factor entity.TOTP) ([]string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+
+	for i := 0; i < recoveryCodeCount; i++ {
+		code, err := newRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+
+		codes = append(codes, code)
+		hashes = append(hashes, recoveryCodeHash(code))
+	}
+
+	factor.Enabled = true
+	factor.RecoveryCodes = hashes
+
+	if err := t.repo.Save(ctx, factor); err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// verifyCode Проверка кода из приложения, а если allowRecovery, то и резервного кода. Принятый код
+// повторно не принимается, номер его периода прописывается в factor
+func (t *twoFactorUseCase) verifyCode(ctx context.Context, factor *entity.TOTP, code string, allowRecovery bool) (bool, error) {
+	if step, ok := totp.Validate(factor.Secret, code, time.Now(), totpSkew); ok {
+		used, err := t.repo.UseStep(ctx, factor.UserID, step)
+		if used {
+			factor.LastStep = step
+		}
+
+		return used, err //nolint:wrapcheck
+	}
+
+	if !allowRecovery {
+		return false, nil
+	}
+
+	return t.repo.UseRecoveryCode(ctx, factor.UserID, recoveryCodeHash(code)) //nolint:wrapcheck
+}
+
+// checkCode Проверка кода пользователя при входе или при изменении его второго фактора. Число неудачных
+// попыток ограничено так же, как при входе по паролю, иначе код можно было бы подобрать
+func (t *twoFactorUseCase) checkCode(ctx context.Context, currentUser entity.User, factor *entity.TOTP, code string,
+	allowRecovery bool, req entity.RequestInfo) error {
+	attempt, err := t.guard.begin(ctx, time.Now().UTC(), twoFactorKey(currentUser.Login), currentUser.Login, req)
+	if err != nil {
+		return err
+	}
+
+	ok, err := t.verifyCode(ctx, factor, code, allowRecovery)
+	if err != nil {
+		attempt.cancel(ctx)
+
+		return err
+	}
+
+	if !ok {
+		if err = attempt.failed(ctx); err != nil {
+			return err
+		}
+
+		return errIncorrectCode
+	}
+
+	return attempt.succeeded(ctx)
+}
+
+// newRecoveryCode Случайный резервный код вида "xxxxx-xxxxx" из символов, которые трудно перепутать
+func newRecoveryCode() (string, error) {
+	b := make([]byte, recoveryCodeSize)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	for i, v := range b {
+		if i == recoveryCodeSize/2 {
+			sb.WriteByte('-')
+		}
+		// небольшое смещение распределения не влияет на стойкость кода
+		sb.WriteByte(recoveryCodeAlphabet[int(v)%len(recoveryCodeAlphabet)])
+	}
+
+	return sb.String(), nil
+}
+
+// recoveryCodeHash Хэш резервного кода без учета регистра и разделителей
+func recoveryCodeHash(code string) string {
+	code = strings.ToLower(code)
+	code = strings.NewReplacer("-", "", " ", "").Replace(code)
+
+	return tools.HashToken(code)
+}
@@ -0,0 +1,318 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/n-r-w/log-server-v2/internal/domain/entity"
+	"github.com/n-r-w/log-server-v2/pkg/tools"
+	"github.com/n-r-w/log-server-v2/pkg/totp"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// memoryUsers Хранилище пользователей в памяти. Поддерживает только поиск
+type memoryUsers struct {
+	users []entity.User
+}
+
+func (m *memoryUsers) Insert(context.Context, entity.User) error            { return nil }
+func (m *memoryUsers) Remove(context.Context, uint64) error                 { return nil }
+func (m *memoryUsers) Update(context.Context, entity.User) error            { return nil }
+func (m *memoryUsers) ChangePassword(context.Context, uint64, string) error { return nil }
+func (m *memoryUsers) UpdatePasswordHash(context.Context, uint64, string) error {
+	return nil
+}
+
+func (m *memoryUsers) FindByID(_ context.Context, userID uint64) (entity.User, error) {
+	for _, u := range m.users {
+		if u.ID == userID {
+			return u, nil
+		}
+	}
+
+	return entity.User{}, nil
+}
+
+func (m *memoryUsers) FindByLogin(_ context.Context, login string) (entity.User, error) {
+	for _, u := range m.users {
+		if u.Login == login {
+			return u, nil
+		}
+	}
+
+	return entity.User{}, nil
+}
+
+func (m *memoryUsers) GetUsers(context.Context) ([]entity.User, error) {
+	return m.users, nil
+}
+
+// memoryTwoFactor Вторые факторы в памяти
+type memoryTwoFactor struct {
+	mu      sync.Mutex
+	factors map[uint64]entity.TOTP
+}
+
+func (m *memoryTwoFactor) Find(_ context.Context, userID uint64) (entity.TOTP, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.factors[userID], nil
+}
+
+func (m *memoryTwoFactor) Save(_ context.Context, factor entity.TOTP) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.factors[factor.UserID] = factor
+
+	return nil
+}
+
+func (m *memoryTwoFactor) Remove(_ context.Context, userID uint64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.factors, userID)
+
+	return nil
+}
+
+func (m *memoryTwoFactor) UseStep(_ context.Context, userID uint64, step int64) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f := m.factors[userID]
+	if step <= f.LastStep {
+		return false, nil
+	}
+	f.LastStep = step
+	m.factors[userID] = f
+
+	return true, nil
+}
+
+func (m *memoryTwoFactor) UseRecoveryCode(context.Context, uint64, string) (bool, error) {
+	return false, nil
+}
+
+func (m *memoryTwoFactor) GetPolicies(context.Context) ([]entity.TwoFactorPolicy, error) {
+	return nil, nil
+}
+
+func (m *memoryTwoFactor) SetPolicy(context.Context, entity.TwoFactorPolicy) error {
+	return nil
+}
+
+// memoryChallenges Незавершенные входы в памяти
+type memoryChallenges struct {
+	mu         sync.Mutex
+	challenges map[string]entity.LoginChallenge
+}
+
+func (m *memoryChallenges) Insert(_ context.Context, c entity.LoginChallenge) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.challenges[c.ID] = c
+
+	return nil
+}
+
+func (m *memoryChallenges) FindByID(_ context.Context, challengeID string) (entity.LoginChallenge, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.challenges[challengeID], nil
+}
+
+func (m *memoryChallenges) AddAttempt(_ context.Context, challengeID string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c, ok := m.challenges[challengeID]
+	if !ok {
+		return 0, nil
+	}
+	c.Attempts++
+	m.challenges[challengeID] = c
+
+	return c.Attempts, nil
+}
+
+func (m *memoryChallenges) Remove(_ context.Context, challengeID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.challenges, challengeID)
+
+	return nil
+}
+
+func (m *memoryChallenges) RemoveExpired(_ context.Context, now time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id, c := range m.challenges {
+		if c.IsExpired(now) {
+			delete(m.challenges, id)
+		}
+	}
+
+	return nil
+}
+
+type twoFactorTest struct {
+	users     *userUseCase
+	twoFactor *twoFactorUseCase
+	secret    string
+}
+
+func newTwoFactorTest(t *testing.T, limits LoginLimits, maxAttempts int) *twoFactorTest {
+	t.Helper()
+
+	hasher, err := tools.NewPasswordHasher(tools.PasswordBcrypt, tools.BcryptCost(bcrypt.MinCost))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hash, err := hasher.Hash("alice-password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	users := &memoryUsers{users: []entity.User{{
+		ID:                1,
+		Login:             "alice",
+		Name:              "Alice",
+		Role:              entity.RoleUser,
+		AuthProvider:      "",
+		Password:          "",
+		EncryptedPassword: hash,
+	}}}
+	factors := &memoryTwoFactor{
+		mu: sync.Mutex{},
+		factors: map[uint64]entity.TOTP{1: {
+			UserID:        1,
+			Secret:        secret,
+			Enabled:       true,
+			LastStep:      0,
+			RecoveryCodes: nil,
+		}},
+	}
+	challenges := &memoryChallenges{
+		mu:         sync.Mutex{},
+		challenges: map[string]entity.LoginChallenge{},
+	}
+
+	guard, _ := newTestGuard(limits)
+
+	userCase, err := NewUserCase(users, nil, guard, guard.audit, hasher, ExternalAuth{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &twoFactorTest{
+		users: userCase,
+		twoFactor: NewTwoFactorCase(factors, challenges, users, guard, guard.audit, TwoFactorSettings{
+			Issuer:       "test",
+			ChallengeAge: time.Minute,
+			MaxAttempts:  maxAttempts,
+		}),
+		secret: secret,
+	}
+}
+
+// startLogin Вход с верным паролем до запроса кода второго фактора
+func (tt *twoFactorTest) startLogin(t *testing.T, req entity.RequestInfo) string {
+	t.Helper()
+
+	ctx := context.Background()
+
+	id, err := tt.users.CheckPassword(ctx, "alice", "alice-password", req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	step, err := tt.twoFactor.StartLogin(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !step.TwoFactorRequired {
+		t.Fatal("expected two-factor step")
+	}
+
+	return step.Challenge
+}
+
+// Зная пароль, нельзя перебирать коды, каждый раз начиная вход заново
+func TestCompleteLoginLockout(t *testing.T) {
+	const maxFailures = 3
+	tt := newTwoFactorTest(t, LoginLimits{MaxLoginFailures: maxFailures, MaxAddressFailures: 0, Delay: 0, Lockout: time.Minute}, 5)
+	ctx := context.Background()
+	req := entity.RequestInfo{Address: "10.0.0.1", RequestID: ""}
+
+	var throttled *loginThrottledError
+	for i := 0; ; i++ {
+		if i > maxFailures {
+			t.Fatalf("no lockout after %d wrong codes", i)
+		}
+
+		_, err := tt.twoFactor.CompleteLogin(ctx, tt.startLogin(t, req), "wrong", req)
+		if errors.As(err, &throttled) {
+			break
+		}
+		if !errors.Is(err, errIncorrectCode) {
+			t.Fatalf("expected %v, got %v", errIncorrectCode, err)
+		}
+	}
+
+	// пока действует блокировка, не принимается и верный код
+	code, err := totp.Code(tt.secret, totp.Step(time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tt.twoFactor.CompleteLogin(ctx, tt.startLogin(t, req), code, req); !errors.As(err, &throttled) {
+		t.Fatalf("expected lockout, got %v", err)
+	}
+}
+
+// После MaxAttempts неверных кодов токен входа больше не принимается, даже с верным кодом
+func TestCompleteLoginMaxAttempts(t *testing.T) {
+	const maxAttempts = 2
+	tt := newTwoFactorTest(t, LoginLimits{MaxLoginFailures: 0, MaxAddressFailures: 0, Delay: 0, Lockout: time.Minute}, maxAttempts)
+	ctx := context.Background()
+	req := entity.RequestInfo{Address: "10.0.0.1", RequestID: ""}
+
+	challenge := tt.startLogin(t, req)
+	for i := 0; i < maxAttempts; i++ {
+		if _, err := tt.twoFactor.CompleteLogin(ctx, challenge, "wrong", req); !errors.Is(err, errIncorrectCode) {
+			t.Fatalf("expected %v, got %v", errIncorrectCode, err)
+		}
+	}
+
+	code, err := totp.Code(tt.secret, totp.Step(time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tt.twoFactor.CompleteLogin(ctx, challenge, code, req); !errors.Is(err, errUnauthorized) {
+		t.Fatalf("expected %v, got %v", errUnauthorized, err)
+	}
+
+	// новый вход с верным кодом проходит
+	result, err := tt.twoFactor.CompleteLogin(ctx, tt.startLogin(t, req), code, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.UserID != 1 {
+		t.Fatalf("expected user 1, got %d", result.UserID)
+	}
+}
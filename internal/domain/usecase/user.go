@@ -5,41 +5,326 @@
 package usecase
 
 import (
-	"errors"
+	"context"
 	"strings"
+	"time"
 
 	"github.com/n-r-w/log-server-v2/internal/domain/entity"
+	"github.com/n-r-w/log-server-v2/pkg/tools"
 )
 
+// ExternalAuth Аутентификация через внешних провайдеров. Нулевые значения отключают соответствующий способ входа
+type ExternalAuth struct {
+	// Tokens проверка bearer токенов
+	Tokens TokenVerifierInterface
+	// TokensAutoCreate создавать пользователя при первом входе по токену
+	TokensAutoCreate bool
+	// Passwords проверка паролей пользователей, которых нет среди локальных
+	Passwords PasswordVerifierInterface
+	// PasswordsAutoCreate создавать пользователя при первом входе по паролю внешнего провайдера
+	PasswordsAutoCreate bool
+}
+
 type userUseCase struct {
-	repo         UserInterface
-	superAdminID uint64
+	repo     UserInterface
+	sessions SessionInterface
+	guard    *loginGuard
+	audit    *auditUseCase
+	hasher   *tools.PasswordHasher
+	external ExternalAuth
+	// хэш, с которым сравнивается пароль несуществующего пользователя. Так время ответа
+	// не зависит от того, существует ли логин
+	dummyPassword string
 }
 
-func NewUserCase(r UserInterface, superAdminID uint64) *userUseCase {
-	return &userUseCase{
-		repo:         r,
-		superAdminID: superAdminID,
+func NewUserCase(r UserInterface, sessions SessionInterface, guard *loginGuard, audit *auditUseCase,
+	hasher *tools.PasswordHasher, external ExternalAuth) (*userUseCase, error) {
+	dummy, err := tools.RandomToken(sessionTokenSize)
+	if err != nil {
+		return nil, err
 	}
+
+	dummyPassword, err := hasher.Hash(dummy)
+	if err != nil {
+		return nil, err
+	}
+
+	return &userUseCase{
+		repo:          r,
+		sessions:      sessions,
+		guard:         guard,
+		audit:         audit,
+		hasher:        hasher,
+		external:      external,
+		dummyPassword: dummyPassword,
+	}, nil
 }
 
-// CheckPassword Проверить пароль
-func (u *userUseCase) CheckPassword(login string, password string) (ID uint64, err error) {
+// CheckPassword Проверить пароль. Пароль локального пользователя проверяется по его хэшу, остальных - внешним
+// провайдером, если он задан. Слишком частые неудачные попытки для логина или адреса клиента временно запрещают вход
+func (u *userUseCase) CheckPassword(ctx context.Context, login string, password string, req entity.RequestInfo) (ID uint64, err error) {
+	now := time.Now().UTC()
+
+	// попытки, отклоненные без проверки пароля, в аудит не пишутся, иначе при переборе паролей
+	// журнал аудита будет переполнен. Сама блокировка в аудите отражается
+	attempt, err := u.guard.begin(ctx, now, loginKey(login), login, req)
+	if err != nil {
+		return 0, err
+	}
+
+	// пользователь до проверки пароля неизвестен, поэтому в аудит попадает логин, под которым пытались войти
+	actor := entity.User{Login: strings.TrimSpace(login)}
+	defer func() { u.audit.event(ctx, actor, entity.AuditLogin, login, req, err) }()
+
 	// ищем в БД по логину
-	user, err := u.repo.FindByLogin(login)
+	user, err := u.repo.FindByLogin(ctx, login)
 	if err != nil {
+		attempt.cancel(ctx)
+
+		return 0, err
+	}
+
+	// проверяем наличие пользователя в БД и пароль. Для несуществующего пользователя пароль
+	// все равно проверяется, чтобы время ответа было тем же
+	// пользователи внешних провайдеров по локальному паролю не входят
+	var ok bool
+	switch {
+	case !user.IsEmpty() && user.AuthProvider == "":
+		ok = user.ComparePassword(u.hasher, password)
+		actor = user
+	case u.external.Passwords != nil:
+		if user, ok, err = u.checkExternalPassword(ctx, login, password, req); err != nil {
+			attempt.cancel(ctx)
+
+			return 0, err
+		}
+		if ok {
+			actor = user
+		}
+	default:
+		u.hasher.Compare(u.dummyPassword, password)
+	}
+
+	if !ok {
+		if err = attempt.failed(ctx); err != nil {
+			return 0, err
+		}
+
+		return 0, errIncorrectPassword
+	}
+
+	if err = attempt.succeeded(ctx); err != nil {
 		return 0, err
 	}
-	// проверяем наличие пользователя в БД и пароль
-	if u == nil || !user.ComparePassword(password) {
-		return 0, errors.New("incorrect email or password")
+
+	if user.AuthProvider == "" {
+		u.rehashPassword(ctx, user, password)
 	}
 
 	return user.ID, nil
 }
 
-// ChangePassword Проверить пароль
-func (u *userUseCase) ChangePassword(currentUser entity.User, login string, password string) (ID uint64, err error) {
+// checkExternalPassword Проверка пароля внешним провайдером. ok = false - пользователь не найден или пароль не подошел
+func (u *userUseCase) checkExternalPassword(ctx context.Context, login string, password string, req entity.RequestInfo) (user entity.User, ok bool, err error) {
+	identity, err := u.external.Passwords.Authenticate(ctx, login, password)
+	if err != nil {
+		// подробности ошибки провайдера клиенту не передаются
+		u.audit.logger.Error("external authentication for %s: %v", login, err)
+
+		return entity.User{}, false, errProviderFailed
+	}
+
+	if identity.Login == "" {
+		return entity.User{}, false, nil
+	}
+
+	user, err = u.externalUser(ctx, identity, u.external.PasswordsAutoCreate, req)
+	if err != nil {
+		return entity.User{}, false, err
+	}
+
+	return user, true, nil
+}
+
+// CheckToken Проверить bearer токен внешнего провайдера. Возвращает пользователя, которому выдан токен
+func (u *userUseCase) CheckToken(ctx context.Context, token string, req entity.RequestInfo) (entity.User, error) {
+	if u.external.Tokens == nil {
+		return entity.User{}, errTokenAuthDisabled
+	}
+
+	identity, err := u.external.Tokens.Verify(ctx, token)
+	if err != nil {
+		return entity.User{}, err
+	}
+
+	return u.externalUser(ctx, identity, u.external.TokensAutoCreate, req)
+}
+
+// CheckCertificate Пользователь по логину из проверенного сертификата клиента (mTLS).
+// Сертификат выдается админом, поэтому пользователь должен быть заранее добавлен. Как и при входе по паролю,
+// пользователи внешних провайдеров (LDAP, OIDC) по сертификату не входят: их логин задает провайдер,
+// а не админ этого сервера
+func (u *userUseCase) CheckCertificate(ctx context.Context, login string) (entity.User, error) {
+	user, err := u.repo.FindByLogin(ctx, login)
+	if err != nil {
+		return entity.User{}, err
+	}
+
+	if user.IsEmpty() {
+		return entity.User{}, errUserNotFound
+	}
+
+	if user.AuthProvider != "" {
+		return entity.User{}, errForeignUser
+	}
+
+	return user, nil
+}
+
+// externalUser Пользователь, подтвержденный внешним провайдером. При первом входе пользователь создается,
+// при последующих его имя и роль обновляются по данным провайдера
+func (u *userUseCase) externalUser(ctx context.Context, identity entity.Identity, autoCreate bool, req entity.RequestInfo) (entity.User, error) {
+	user, err := u.repo.FindByLogin(ctx, identity.Login)
+	if err != nil {
+		return entity.User{}, err
+	}
+
+	name := identity.Name
+	if name == "" {
+		name = identity.Login
+	}
+
+	if user.IsEmpty() {
+		if !autoCreate {
+			return entity.User{}, errUserNotFound
+		}
+
+		return u.createExternalUser(ctx, identity, name, req)
+	}
+
+	// логин локального пользователя или пользователя другого провайдера занять нельзя
+	if user.AuthProvider != identity.Provider {
+		return entity.User{}, errForeignUser
+	}
+
+	if user.Name != name || user.Role != identity.Role {
+		user.Name = name
+		user.Role = identity.Role
+
+		if err = u.repo.Update(ctx, user); err != nil {
+			return entity.User{}, err
+		}
+	}
+
+	return user, nil
+}
+
+func (u *userUseCase) createExternalUser(ctx context.Context, identity entity.Identity, name string, req entity.RequestInfo) (user entity.User, err error) {
+	user = entity.User{
+		ID:           0,
+		Login:        identity.Login,
+		Name:         name,
+		Role:         identity.Role,
+		AuthProvider: identity.Provider,
+		Password:     "",
+		// пароль не используется, но хэш обязателен
+		EncryptedPassword: u.dummyPassword,
+	}
+
+	defer func() {
+		event := newAuditEvent(user, entity.AuditAddUser, identity.Login, req, err)
+		event.Details = "created on first login via " + identity.Provider
+		if err != nil {
+			event.Details += ": " + err.Error()
+		}
+		u.audit.write(ctx, event)
+	}()
+
+	if err = u.repo.Insert(ctx, user); err != nil {
+		return entity.User{}, err
+	}
+
+	// ID присваивается при добавлении в БД
+	return u.repo.FindByLogin(ctx, identity.Login) //nolint:wrapcheck
+}
+
+// rehashPassword Пересоздание хэша пароля, если он создан по устаревшим правилам (другой алгоритм или параметры).
+// Это возможно только при входе, т.к. только тогда известен пароль. Ошибка не мешает входу
+func (u *userUseCase) rehashPassword(ctx context.Context, user entity.User, password string) {
+	if !u.hasher.NeedsRehash(user.EncryptedPassword) {
+		return
+	}
+
+	hash, err := u.hasher.Hash(password)
+	if err == nil {
+		err = u.repo.UpdatePasswordHash(ctx, user.ID, hash)
+	}
+
+	if err != nil {
+		u.audit.logger.Warn("password rehash for %s: %v", user.Login, err)
+	}
+}
+
+// UnlockUser Снять блокировку входа, возникшую из-за неудачных попыток. Только для админа
+func (u *userUseCase) UnlockUser(ctx context.Context, currentUser entity.User, login string, req entity.RequestInfo) (err error) {
+	defer func() { u.audit.event(ctx, currentUser, entity.AuditUnlockUser, login, req, err) }()
+
+	if !currentUser.IsAdmin() {
+		return errNotAdmin
+	}
+
+	return u.guard.unlock(ctx, login)
+}
+
+// SetLoginLimits Изменить ограничения на попытки входа и ввода кодов второго фактора без перезапуска сервера
+func (u *userUseCase) SetLoginLimits(limits LoginLimits) {
+	u.guard.setLimits(limits)
+}
+
+// AddUser Добавить пользователя. Только для админа
+func (u *userUseCase) AddUser(ctx context.Context, currentUser entity.User, user entity.User, req entity.RequestInfo) (err error) {
+	defer func() { u.audit.event(ctx, currentUser, entity.AuditAddUser, user.Login, req, err) }()
+
+	if !currentUser.IsAdmin() {
+		return errNotAdmin
+	}
+
+	return u.repo.Insert(ctx, user) //nolint:wrapcheck
+}
+
+// CreateAdmin Создание админа при первом запуске. Если пользователь с таким логином уже есть, то ничего не делается.
+// Пароль из конфигурации должен соответствовать тем же правилам, что и пароли остальных пользователей,
+// иначе админ не создается и сервер не запускается
+func (u *userUseCase) CreateAdmin(ctx context.Context, login string, password string) (created bool, err error) {
+	user, err := u.repo.FindByLogin(ctx, login)
+	if err != nil {
+		return false, err
+	}
+
+	if !user.IsEmpty() {
+		return false, nil
+	}
+
+	admin := entity.User{
+		ID:                0,
+		Login:             login,
+		Name:              login,
+		Role:              entity.RoleAdmin,
+		Password:          password,
+		EncryptedPassword: "",
+	}
+
+	if err = u.repo.Insert(ctx, admin); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// ChangePassword Сменить пароль. Все сессии пользователя при этом завершаются
+func (u *userUseCase) ChangePassword(ctx context.Context, currentUser entity.User, login string, password string, req entity.RequestInfo) (ID uint64, err error) {
+	defer func() { u.audit.event(ctx, currentUser, entity.AuditChangePassword, login, req, err) }()
+
 	login = strings.TrimSpace(login)
 	password = strings.TrimSpace(password)
 	changeSelf := currentUser.Login == login
@@ -47,12 +332,12 @@ func (u *userUseCase) ChangePassword(currentUser entity.User, login string, pass
 	var id uint64
 
 	if !changeSelf {
-		if currentUser.ID != u.superAdminID {
+		if !currentUser.IsAdmin() {
 			// если не админ, то менять можно только себе
 			return 0, errNotAdmin
 		}
 
-		user, err := u.FindByLogin(login)
+		user, err := u.FindByLogin(ctx, login)
 		if err != nil {
 			return 0, err
 		}
@@ -66,29 +351,33 @@ func (u *userUseCase) ChangePassword(currentUser entity.User, login string, pass
 		id = currentUser.ID
 	}
 
-	return id, u.repo.ChangePassword(id, password)
+	if err := u.repo.ChangePassword(ctx, id, password); err != nil {
+		return 0, err
+	}
+
+	return id, u.sessions.RemoveByUser(ctx, id)
 }
 
-func (u *userUseCase) Insert(user entity.User) error {
-	return u.repo.Insert(user) //nolint:wrapcheck
+func (u *userUseCase) Insert(ctx context.Context, user entity.User) error {
+	return u.repo.Insert(ctx, user) //nolint:wrapcheck
 }
 
-func (u *userUseCase) Remove(id uint64) error {
-	return u.repo.Remove(id) //nolint:wrapcheck
+func (u *userUseCase) Remove(ctx context.Context, id uint64) error {
+	return u.repo.Remove(ctx, id) //nolint:wrapcheck
 }
 
-func (u *userUseCase) Update(user entity.User) error {
-	return u.repo.Update(user) //nolint:wrapcheck
+func (u *userUseCase) Update(ctx context.Context, user entity.User) error {
+	return u.repo.Update(ctx, user) //nolint:wrapcheck
 }
 
-func (u *userUseCase) FindByID(id uint64) (entity.User, error) {
-	return u.repo.FindByID(id) //nolint:wrapcheck
+func (u *userUseCase) FindByID(ctx context.Context, id uint64) (entity.User, error) {
+	return u.repo.FindByID(ctx, id) //nolint:wrapcheck
 }
 
-func (u *userUseCase) FindByLogin(login string) (entity.User, error) {
-	return u.repo.FindByLogin(login) //nolint:wrapcheck
+func (u *userUseCase) FindByLogin(ctx context.Context, login string) (entity.User, error) {
+	return u.repo.FindByLogin(ctx, login) //nolint:wrapcheck
 }
 
-func (u *userUseCase) GetUsers() ([]entity.User, error) {
-	return u.repo.GetUsers() //nolint:wrapcheck
+func (u *userUseCase) GetUsers(ctx context.Context) ([]entity.User, error) {
+	return u.repo.GetUsers(ctx) //nolint:wrapcheck
 }
@@ -2,20 +2,56 @@
 package handler
 
 import (
+	"context"
+	"errors"
+	"io"
 	"net/http"
 	"time"
 
 	"github.com/n-r-w/log-server-v2/internal/domain/entity"
+	"github.com/n-r-w/log-server-v2/pkg/logger"
 )
 
+// ErrRequestTooLarge тело запроса превышает допустимый размер
+var ErrRequestTooLarge = errors.New("request body too large")
+
 type CompressionType int
 
 const (
 	CompressionNo = CompressionType(iota)
 	CompressionGzip
 	CompressionDeflate
+	CompressionBrotli
+	CompressionZstd
 )
 
+// StreamWriter функция, которая пишет ответ частями. Позволяет не формировать весь ответ в памяти
+type StreamWriter func(w io.Writer) error
+
+// RetryAfterError ошибка, после которой запрос можно повторить через указанное время
+type RetryAfterError interface {
+	error
+	RetryAfter() time.Duration
+}
+
+// OverloadError ошибка из-за превышения допустимой нагрузки. Запрос можно повторить позже (429)
+type OverloadError interface {
+	error
+	Overloaded() bool
+}
+
+// UnavailableError ошибка из-за временной недоступности хранилища. Запрос можно повторить позже (503)
+type UnavailableError interface {
+	error
+	Unavailable() bool
+}
+
+// InvalidRequestError ошибка в данных запроса. Повторять такой запрос бессмысленно (400)
+type InvalidRequestError interface {
+	error
+	InvalidRequest() bool
+}
+
 type MiddlewareFunc func(next http.Handler) http.Handler
 
 // RouterInterface - интерфейс http роутера
@@ -25,9 +61,10 @@ type RouterInterface interface {
 	// data содержит []byte или указатель на объект. Во втором случае этот объект преобразуется в JSON */
 	RespondData(w http.ResponseWriter, code int, data interface{})
 	// RespondCompressed - ответ на запрос
-	// data содержит []byte или указатель на объект. Во втором случае этот объект преобразуется в JSON.
-	// Дополнительно проверяет заголовок запроса на "Accept-Encoding" и решает сжимать ли ответ на самом деле,
-	// т.е. в итоге ответ может быть и без сжатия
+	// data содержит []byte, StreamWriter или указатель на объект. В последнем случае объект преобразуется в JSON,
+	// срезы преобразуются поэлементно. Ответ кодируется и сжимается потоково, без формирования его целиком в памяти.
+	// Алгоритм сжатия выбирается по заголовку запроса "Accept-Encoding" с учетом q-значений, ctype задает
+	// предпочтительный алгоритм, CompressionNo отключает сжатие. В итоге ответ может быть и без сжатия
 	RespondCompressed(w http.ResponseWriter, r *http.Request, code int, ctype CompressionType, data interface{})
 	// RespondError - возврат ошибки
 	RespondError(w http.ResponseWriter, code int, err error)
@@ -43,30 +80,102 @@ type RouterInterface interface {
 	CheckSession(*http.Request) (userID uint64, err error)
 	// CloseSession - закрыть сессию
 	CloseSession(w http.ResponseWriter, r *http.Request)
+
+	// RequestInfo - информация о запросе для аудита: адрес клиента и ID запроса
+	RequestInfo(r *http.Request) entity.RequestInfo
+	// Logger - журнал, который добавляет к сообщениям поля запроса: ID запроса, адрес клиента, маршрут и пользователя
+	Logger(r *http.Request) logger.Interface
+	// SetRequestUser - запомнить пользователя, выполняющего запрос, для журнала. Возвращает запрос, который
+	// надо передавать дальше по цепочке обработчиков
+	SetRequestUser(w http.ResponseWriter, r *http.Request, userID uint64) *http.Request
+
+	// ClientCertificateLogin - логин пользователя из проверенного сертификата клиента (mTLS).
+	// Пустая строка, если сертификата нет или аутентификация по сертификату выключена
+	ClientCertificateLogin(r *http.Request) string
+
+	// CSRFToken - CSRF токен для текущей сессии. Пустая строка, если защита от CSRF выключена
+	CSRFToken(r *http.Request) (string, error)
+	// CheckCSRF - проверить CSRF токен запроса. Если защита от CSRF выключена, то всегда nil
+	CheckCSRF(r *http.Request) error
 }
 
 // Интерфейсы по работе с доменом (юскейсами). Реализуются в каталоге domain/usecase
 type (
 	// UserInterface интерфейс, реализуемый юскейсом работы с пользователями
 	UserInterface interface {
-		// CheckPassword Проверить пароль
-		CheckPassword(login string, password string) (ID uint64, err error)
+		// CheckPassword Проверить пароль. Если вход временно запрещен из-за неудачных попыток,
+		// то ошибка реализует интерфейс RetryAfterError
+		CheckPassword(ctx context.Context, login string, password string, req entity.RequestInfo) (ID uint64, err error)
+		// CheckToken Проверить bearer токен внешнего провайдера (OIDC). Возвращает пользователя, которому выдан токен
+		CheckToken(ctx context.Context, token string, req entity.RequestInfo) (entity.User, error)
+		// CheckCertificate Пользователь, которому выдан сертификат клиента
+		CheckCertificate(ctx context.Context, login string) (entity.User, error)
+		// UnlockUser Снять блокировку входа, возникшую из-за неудачных попыток
+		UnlockUser(ctx context.Context, currentUser entity.User, login string, req entity.RequestInfo) error
 		// ChangePassword Сменить пароль
-		ChangePassword(currentUser entity.User, login string, password string) (ID uint64, err error)
+		ChangePassword(ctx context.Context, currentUser entity.User, login string, password string, req entity.RequestInfo) (ID uint64, err error)
+		// AddUser Добавить пользователя
+		AddUser(ctx context.Context, currentUser entity.User, user entity.User, req entity.RequestInfo) error
+
+		Remove(ctx context.Context, id uint64) error
+		Update(ctx context.Context, user entity.User) error
+
+		FindByID(ctx context.Context, id uint64) (entity.User, error)
+		FindByLogin(ctx context.Context, login string) (entity.User, error)
+		GetUsers(ctx context.Context) ([]entity.User, error)
+	}
+
+	// SessionInterface интерфейс, реализуемый юскейсом работы с сессиями
+	SessionInterface interface {
+		// Start Создать сессию. Возвращает токен, который надо передать клиенту
+		Start(ctx context.Context, userID uint64, sessionAge int, address string, userAgent string) (token string, err error)
+		// Check Проверить токен сессии
+		Check(ctx context.Context, token string) (entity.Session, error)
+		// Close Завершить сессию по токену
+		Close(ctx context.Context, token string, req entity.RequestInfo) error
+
+		GetSessions(ctx context.Context, currentUser entity.User, login string) ([]entity.Session, error)
+		CloseSession(ctx context.Context, currentUser entity.User, sessionID string, req entity.RequestInfo) error
+		CloseUserSessions(ctx context.Context, currentUser entity.User, login string, req entity.RequestInfo) error
+	}
+
+	// TwoFactorInterface интерфейс, реализуемый юскейсом работы со вторым фактором
+	TwoFactorInterface interface {
+		// StartLogin Вызывается после проверки пароля. Если в результате TwoFactorRequired, то сессию создавать
+		// нельзя, пока вход не будет подтвержден через CompleteLogin
+		StartLogin(ctx context.Context, userID uint64) (entity.LoginStep, error)
+		// CheckWithoutCode Может ли пользователь войти без кода второго фактора (bearer токен, сертификат клиента)
+		CheckWithoutCode(ctx context.Context, user entity.User) error
+		// CompleteLogin Проверить код второго фактора для незавершенного входа
+		CompleteLogin(ctx context.Context, challenge string, code string, req entity.RequestInfo) (entity.LoginResult, error)
+
+		Status(ctx context.Context, currentUser entity.User) (entity.TwoFactorStatus, error)
+		Enrol(ctx context.Context, currentUser entity.User) (entity.TOTPEnrolment, error)
+		// CompleteLogin, Confirm, RegenerateRecoveryCodes, Disable: при превышении числа неверных кодов ошибка реализует RetryAfterError
+		Confirm(ctx context.Context, currentUser entity.User, code string, req entity.RequestInfo) (recoveryCodes []string, err error)
+		RegenerateRecoveryCodes(ctx context.Context, currentUser entity.User, code string, req entity.RequestInfo) (recoveryCodes []string, err error)
+		Disable(ctx context.Context, currentUser entity.User, login string, code string, req entity.RequestInfo) error
 
-		Insert(user entity.User) error
-		Remove(id uint64) error
-		Update(user entity.User) error
+		Policies(ctx context.Context, currentUser entity.User) ([]entity.TwoFactorPolicy, error)
+		SetPolicy(ctx context.Context, currentUser entity.User, policy entity.TwoFactorPolicy, req entity.RequestInfo) error
+	}
 
-		FindByID(id uint64) (entity.User, error)
-		FindByLogin(login string) (entity.User, error)
-		GetUsers() ([]entity.User, error)
+	// AuditInterface интерфейс, реализуемый юскейсом работы с журналом аудита
+	AuditInterface interface {
+		Find(ctx context.Context, currentUser entity.User, query entity.AuditQuery) ([]entity.AuditEvent, error)
 	}
 
 	// LogInterface интерфейс, реализуемый юскейсом работы с логами
 	LogInterface interface {
-		Insert(logs []entity.LogRecord) error
+		Insert(ctx context.Context, logs []entity.LogRecord) error
+
+		Find(ctx context.Context, query entity.LogQuery) (records []entity.LogRecord, limited bool, err error)
+		// Count количество записей по группам entity.LogGroup*
+		Count(ctx context.Context, query entity.LogQuery, group string) ([]entity.LogCount, error)
+	}
 
-		Find(dateFrom time.Time, dateTo time.Time, limit int) (records []entity.LogRecord, limited bool, err error)
+	// HealthInterface интерфейс, реализуемый юскейсом проверки состояния сервера
+	HealthInterface interface {
+		Health(ctx context.Context) entity.Health
 	}
 )
@@ -0,0 +1,84 @@
+package rest
+
+import (
+	"net/http"
+
+	"github.com/n-r-w/log-server-v2/internal/domain/entity"
+	"github.com/n-r-w/log-server-v2/internal/presentation/http/handler"
+)
+
+// Имена параметров запроса журнала аудита в URL
+const (
+	paramActor  = "actor"
+	paramAction = "action"
+	paramTarget = "target"
+)
+
+// Журнал аудита. Параметры в URL: timeFrom, timeTo, actor, action, target, limit
+func (info *restInfo) getAuditEvents() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cu := currentUser(r)
+		if cu == nil {
+			info.controller.RespondError(w, http.StatusInternalServerError, errNotAuthenticated)
+
+			return
+		}
+
+		query, err := parseAuditQuery(r, info.maxLogRecordsResult)
+		if err != nil {
+			info.controller.RespondError(w, http.StatusBadRequest, err)
+
+			return
+		}
+
+		events, err := info.audit.Find(r.Context(), *cu, query)
+		if err != nil {
+			info.controller.RespondError(w, http.StatusForbidden, err)
+
+			return
+		}
+
+		info.controller.RespondCompressed(w, r, http.StatusOK, handler.CompressionGzip, &events)
+	}
+}
+
+// parseAuditQuery Разбор параметров запроса журнала аудита
+func parseAuditQuery(r *http.Request, maxLimit int) (entity.AuditQuery, error) {
+	var q entity.AuditQuery
+
+	for name, vals := range r.URL.Query() {
+		var err error
+
+		switch name {
+		case paramTimeFrom:
+			q.TimeFrom, err = parseTimeParam(name, vals)
+		case paramTimeTo:
+			q.TimeTo, err = parseTimeParam(name, vals)
+		case paramActor:
+			q.Actor, err = singleParam(name, vals)
+		case paramAction:
+			q.Action, err = singleParam(name, vals)
+		case paramTarget:
+			q.Target, err = singleParam(name, vals)
+		case paramLimit:
+			q.Limit, err = parseIntParam(name, vals)
+		default:
+			err = newParamError(name, "unknown parameter")
+		}
+
+		if err != nil {
+			return q, err
+		}
+	}
+
+	switch {
+	case q.Limit < 0:
+		return q, newParamError(paramLimit, "must not be negative")
+	case q.Limit > maxLimit:
+		return q, newParamError(paramLimit, "must not exceed %d", maxLimit)
+	case q.Limit == 0:
+		q.Limit = maxLimit
+	}
+
+	return q, nil
+}
@@ -3,9 +3,15 @@ package rest
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"mime"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/n-r-w/log-server-v2/internal/domain/entity"
+	"github.com/n-r-w/log-server-v2/internal/presentation/http/handler"
 )
 
 // Логин (создание сессии)
@@ -27,9 +33,21 @@ func (info *restInfo) handleSessionsCreate() http.HandlerFunc {
 			return
 		}
 		// ищем в БД по логину
-		ID, err := info.user.CheckPassword(loginData.Login, loginData.Password)
+		ID, err := info.user.CheckPassword(r.Context(), loginData.Login, loginData.Password, info.controller.RequestInfo(r))
 		if err != nil {
-			info.controller.RespondError(w, http.StatusForbidden, err)
+			info.respondAuthError(w, err)
+
+			return
+		}
+		// если нужен второй фактор, то сессия создается только после проверки кода
+		step, err := info.twoFactor.StartLogin(r.Context(), ID)
+		if err != nil {
+			info.controller.RespondError(w, http.StatusInternalServerError, err)
+
+			return
+		}
+		if step.TwoFactorRequired {
+			info.controller.RespondData(w, http.StatusAccepted, &step)
 
 			return
 		}
@@ -44,33 +62,160 @@ func (info *restInfo) handleSessionsCreate() http.HandlerFunc {
 	}
 }
 
-// Аутентификация пользователя на основании ранее прошедшего логина
+// Ответ на неверный пароль или код второго фактора. Если попытки временно запрещены,
+// то клиенту сообщается, когда можно повторить
+func (info *restInfo) respondAuthError(w http.ResponseWriter, err error) {
+	var throttled handler.RetryAfterError
+	if errors.As(err, &throttled) {
+		seconds := int((throttled.RetryAfter() + time.Second - 1) / time.Second)
+		w.Header().Set("Retry-After", strconv.Itoa(seconds))
+		info.controller.RespondError(w, http.StatusTooManyRequests, err)
+
+		return
+	}
+
+	info.controller.RespondError(w, http.StatusForbidden, err)
+}
+
+// Второй шаг логина: проверка кода второго фактора (из приложения или резервного) и создание сессии
+func (info *restInfo) handleLoginVerify() http.HandlerFunc {
+	type request struct {
+		Challenge string `json:"challenge"`
+		Code      string `json:"code"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		req := request{
+			Challenge: "",
+			Code:      "",
+		}
+		// парсим входящий json
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			info.controller.RespondError(w, http.StatusBadRequest, err)
+
+			return
+		}
+
+		result, err := info.twoFactor.CompleteLogin(r.Context(), req.Challenge, req.Code, info.controller.RequestInfo(r))
+		if err != nil {
+			info.respondAuthError(w, err)
+
+			return
+		}
+
+		if err = info.controller.StartSession(w, r, result.UserID, info.sessionAge); err != nil {
+			info.controller.RespondError(w, http.StatusForbidden, err)
+
+			return
+		}
+
+		// если второй фактор подключался при этом входе, то в ответе резервные коды
+		info.controller.RespondData(w, http.StatusOK, &result)
+	}
+}
+
+// Аутентификация пользователя на основании ранее прошедшего логина, bearer токена внешнего провайдера
+// или сертификата клиента (mTLS)
 func (info *restInfo) authenticateUser(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		ID, err := info.controller.CheckSession(r)
+		user, method, code, err := info.identifyUser(r)
 		if err != nil {
-			info.controller.RespondError(w, http.StatusUnauthorized, err)
+			info.controller.RespondError(w, code, err)
 
 			return
 		}
 
-		// берем инфу о пользователе из БД
-		var user entity.User
-		user, err = info.user.FindByID(ID)
-		if err != nil {
-			info.controller.RespondError(w, http.StatusInternalServerError, err)
+		// пользователь мог быть удален после входа
+		if user.IsEmpty() {
+			info.controller.RespondError(w, http.StatusUnauthorized, errNotAuthenticated)
 
 			return
 		}
 
-		// добавляем модель пользователя в контекст запроса
-		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), ctxKeyUser, &user)))
+		// добавляем модель пользователя и способ аутентификации в контекст запроса
+		r = info.controller.SetRequestUser(w, r, user.ID)
+		ctx := context.WithValue(r.Context(), ctxKeyUser, &user)
+		ctx = context.WithValue(ctx, ctxKeyAuthMethod, method)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// identifyUser Пользователь, выполняющий запрос, и способ его аутентификации. code - HTTP код ответа при ошибке
+func (info *restInfo) identifyUser(r *http.Request) (user entity.User, method authMethod, code int, err error) {
+	if token := bearerToken(r); token != "" {
+		// токен проверяется при каждом запросе, сессия не создается
+		if user, err = info.user.CheckToken(r.Context(), token, info.controller.RequestInfo(r)); err != nil {
+			return entity.User{}, "", http.StatusUnauthorized, err
+		}
+
+		if err = info.twoFactor.CheckWithoutCode(r.Context(), user); err != nil {
+			return entity.User{}, "", http.StatusForbidden, err
+		}
+
+		return user, authBearer, 0, nil
+	}
+
+	ID, err := info.controller.CheckSession(r)
+	if err != nil {
+		// без сессии пользователь может быть определен по проверенному сертификату клиента
+		login := info.controller.ClientCertificateLogin(r)
+		if login == "" {
+			return entity.User{}, "", http.StatusUnauthorized, err
+		}
+
+		if user, err = info.user.CheckCertificate(r.Context(), login); err != nil {
+			return entity.User{}, "", http.StatusUnauthorized, err
+		}
+
+		if err = info.twoFactor.CheckWithoutCode(r.Context(), user); err != nil {
+			return entity.User{}, "", http.StatusForbidden, err
+		}
+
+		return user, authCertificate, 0, nil
+	}
+
+	// берем инфу о пользователе из БД
+	if user, err = info.user.FindByID(r.Context(), ID); err != nil {
+		return entity.User{}, "", http.StatusInternalServerError, err
+	}
+
+	return user, authCookie, 0, nil
+}
+
+// Проверка CSRF токена для запросов, изменяющих данные, аутентифицированных через куки сессии.
+// Запросы с bearer токеном не проверяются, т.к. браузер не добавляет такой токен к запросу автоматически.
+// Сертификат клиента браузер передает сам, как и куки, а CSRF токена без сессии нет. Поэтому запрос
+// с сертификатом пропускается, только если другой сайт не может отправить его без предварительного
+// CORS запроса (preflight): его Content-Type не может быть задан HTML формой. Агенты, отправляющие логи,
+// указывают Content-Type сами
+func (info *restInfo) checkCSRF(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method := currentAuthMethod(r)
+
+		switch {
+		case method == authBearer:
+		case method == authCertificate && requiresPreflight(r):
+		case r.Method == http.MethodGet, r.Method == http.MethodHead, r.Method == http.MethodOptions:
+		default:
+			if err := info.controller.CheckCSRF(r); err != nil {
+				info.controller.RespondError(w, http.StatusForbidden, err)
+
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
 	})
 }
 
 // Обработчик запроса с информацией о текущей сессии
 func (info *restInfo) handleWhoami() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		// клиент может получить CSRF токен текущей сессии
+		if token, err := info.controller.CSRFToken(r); err == nil && token != "" {
+			w.Header().Set(csrfHeaderName, token)
+		}
+
 		info.controller.RespondData(w, http.StatusOK,
 			// объект "пользователь" кладется в контекст при логине
 			currentUser(r))
@@ -84,3 +229,41 @@ func (info *restInfo) closeSession() http.HandlerFunc {
 		info.controller.RespondData(w, http.StatusOK, nil)
 	}
 }
+
+// requiresPreflight Браузер отправляет такой запрос с другого сайта только после CORS запроса, а значит
+// только на разрешенные в CORS_ALLOWED_ORIGINS домены. Без preflight браузер отправляет POST без Content-Type
+// или с типами, которые может задать HTML форма
+func requiresPreflight(r *http.Request) bool {
+	if r.Method != http.MethodPost {
+		return true
+	}
+
+	contentType := r.Header.Get("Content-Type")
+	if contentType == "" {
+		return false
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	switch mediaType {
+	case "application/x-www-form-urlencoded", "multipart/form-data", "text/plain":
+		return false
+	default:
+		return true
+	}
+}
+
+// Bearer токен из хедера Authorization. Пустая строка, если его нет
+func bearerToken(r *http.Request) string {
+	const prefix = "bearer "
+
+	auth := r.Header.Get("Authorization")
+	if len(auth) <= len(prefix) || !strings.EqualFold(auth[:len(prefix)], prefix) {
+		return ""
+	}
+
+	return strings.TrimSpace(auth[len(prefix):])
+}
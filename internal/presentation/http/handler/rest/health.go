@@ -0,0 +1,22 @@
+package rest
+
+import (
+	"net/http"
+
+	"github.com/n-r-w/log-server-v2/internal/domain/entity"
+)
+
+// Состояние сервера и его компонентов. Если сервер не может обслуживать запросы, то код ответа 503,
+// чтобы балансировщик мог вывести его из работы без разбора тела ответа
+func (info *restInfo) getHealth() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		health := info.health.Health(r.Context())
+
+		code := http.StatusOK
+		if health.Status == entity.HealthUnavailable {
+			code = http.StatusServiceUnavailable
+		}
+
+		info.controller.RespondData(w, code, &health)
+	}
+}
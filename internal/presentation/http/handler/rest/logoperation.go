@@ -2,29 +2,52 @@ package rest
 
 import (
 	"encoding/json"
+	"io"
+	"mime"
 	"net/http"
-	"time"
 
 	"github.com/n-r-w/log-server-v2/internal/domain/entity"
 	"github.com/n-r-w/log-server-v2/internal/presentation/http/handler"
 	schema_log "github.com/n-r-w/log-server-v2/internal/schema/schema.log"
+	"google.golang.org/protobuf/encoding/protowire"
 	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
-// Добавить в лог
+// Добавить в лог. Тело запроса - JSON или protobuf (schema.LogRecords), если это указано
+// в заголовке binary-format или Content-Type
 func (info *restInfo) addLogRecord() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var req []entity.LogRecord
-		// парсим входящий json
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			info.controller.RespondError(w, http.StatusBadRequest, err)
+
+		if isProtobufRequest(r) {
+			data, err := io.ReadAll(r.Body)
+			if err != nil {
+				info.respondBodyError(w, err)
+
+				return
+			}
+
+			mRecords := &schema_log.LogRecords{}
+			if err := proto.Unmarshal(data, mRecords); err != nil {
+				info.controller.RespondError(w, http.StatusBadRequest, err)
+
+				return
+			}
+
+			req = make([]entity.LogRecord, 0, len(mRecords.GetRecords()))
+			for _, mRecord := range mRecords.GetRecords() {
+				req = append(req, logRecordFromProto(mRecord))
+			}
+		} else if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			// парсим входящий json
+			info.respondBodyError(w, err)
 
 			return
 		}
 
-		if err := info.log.Insert(req); err != nil {
-			info.controller.RespondError(w, http.StatusForbidden, err)
+		if err := info.log.Insert(r.Context(), req); err != nil {
+			info.respondInsertError(w, err)
 
 			return
 		}
@@ -33,71 +56,235 @@ func (info *restInfo) addLogRecord() http.HandlerFunc {
 	}
 }
 
-// Получить записи из лога
+// Получить записи из лога. Параметры запроса передаются в URL
 func (info *restInfo) getLogRecords() http.HandlerFunc {
-	type requestParams struct {
-		TimeFrom time.Time `json:"timeFrom"`
-		TimeTo   time.Time `json:"timeTo"`
+	return func(w http.ResponseWriter, r *http.Request) {
+		var (
+			req *logSearchRequest
+			err error
+		)
+
+		if r.URL.RawQuery == "" && r.ContentLength != 0 {
+			// поддержка старых клиентов, передающих параметры в JSON теле GET запроса
+			req, err = decodeLogSearchBody(r)
+		} else {
+			req, err = parseLogSearchURL(r.URL.Query())
+		}
+
+		if err != nil {
+			info.respondBodyError(w, err)
+
+			return
+		}
+
+		info.respondLogRecords(w, r, req)
 	}
+}
 
+// Получить записи из лога. Параметры запроса передаются в JSON теле запроса, что удобно для сложных фильтров
+func (info *restInfo) searchLogRecords() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		req := &requestParams{
-			TimeFrom: time.Time{},
-			TimeTo:   time.Time{},
+		req, err := decodeLogSearchBody(r)
+		if err != nil {
+			info.respondBodyError(w, err)
+
+			return
 		}
 
-		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		info.respondLogRecords(w, r, req)
+	}
+}
+
+// Количество записей лога по группам. Параметр group: level, host, source, hour или day.
+// Остальные параметры - те же фильтры, что и для получения записей, кроме limit, cursor и format
+func (info *restInfo) getLogStats() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		values := r.URL.Query()
+
+		group, err := singleParam(paramGroup, values[paramGroup])
+		if err != nil {
 			info.controller.RespondError(w, http.StatusBadRequest, err)
 
 			return
 		}
+		if !entity.ValidLogGroup(group) {
+			info.controller.RespondError(w, http.StatusBadRequest, newParamError(paramGroup, "must be %s, %s, %s, %s or %s",
+				entity.LogGroupLevel, entity.LogGroupHost, entity.LogGroupSource, entity.LogGroupHour, entity.LogGroupDay))
+
+			return
+		}
+		values.Del(paramGroup)
+
+		for _, name := range []string{paramLimit, paramCursor, paramFormat} {
+			if values.Has(name) {
+				info.controller.RespondError(w, http.StatusBadRequest, newParamError(name, "not supported for counting"))
+
+				return
+			}
+		}
 
-		records, _, err := info.log.Find(req.TimeFrom, req.TimeTo, info.maxLogRecordsResult)
+		req, err := parseLogSearchURL(values)
 		if err != nil {
-			info.controller.RespondError(w, http.StatusInternalServerError, err)
+			info.controller.RespondError(w, http.StatusBadRequest, err)
 
 			return
 		}
 
-		if len(records) == 0 {
-			info.controller.RespondData(w, http.StatusOK, nil)
+		query, err := req.query(info.maxLogRecordsResult)
+		if err != nil {
+			info.controller.RespondError(w, http.StatusBadRequest, err)
 
 			return
 		}
 
-		if r.Header.Get(binaryFormatHeaderName) == binaryFormatHeaderProtobuf {
-			// клиент хочет Protobuf
-			mRecords := &schema_log.LogRecords{
-				Records: nil,
-			}
+		counts, err := info.log.Count(r.Context(), query, group)
+		if err != nil {
+			if r.Context().Err() != nil {
+				info.controller.RespondError(w, statusClientClosedRequest, err)
 
-			for _, r := range records {
-				mRecord := &schema_log.LogRecord{
-					Id:       r.ID,
-					LogTime:  timestamppb.New(r.LogTime),
-					RealTime: timestamppb.New(r.RealTime),
-					Level:    uint32(r.Level),
-					Message1: r.Message1,
-					Message2: r.Message2,
-					Message3: r.Message3,
-				}
-				mRecords.Records = append(mRecords.Records, mRecord)
+				return
 			}
 
-			out, err := proto.Marshal(mRecords)
-			if err != nil {
-				info.controller.RespondError(w, http.StatusInternalServerError, err)
+			info.controller.RespondError(w, http.StatusInternalServerError, err)
 
-				return
-			}
+			return
+		}
+
+		if counts == nil {
+			counts = []entity.LogCount{}
+		}
+
+		info.controller.RespondData(w, http.StatusOK, &counts)
+	}
+}
+
+func decodeLogSearchBody(r *http.Request) (*logSearchRequest, error) {
+	req := &logSearchRequest{}
 
-			w.Header().Add(binaryFormatHeaderName, binaryFormatHeaderProtobuf)
-			info.controller.RespondCompressed(w, r, http.StatusOK, handler.CompressionGzip, out)
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(req); err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
+// Поиск записей и ответ на запрос. Если найдены не все записи, то в заголовке ответа
+// передается курсор для получения следующей порции
+func (info *restInfo) respondLogRecords(w http.ResponseWriter, r *http.Request, req *logSearchRequest) {
+	query, err := req.query(info.maxLogRecordsResult)
+	if err != nil {
+		info.controller.RespondError(w, http.StatusBadRequest, err)
+
+		return
+	}
+
+	// при разрыве соединения клиентом контекст запроса отменяется, и вместе с ним прерывается запрос к БД
+	records, limited, err := info.log.Find(r.Context(), query)
+	if err != nil {
+		if r.Context().Err() != nil {
+			// отвечать уже некому, ответ нужен только для журнала запросов
+			info.controller.RespondError(w, statusClientClosedRequest, err)
 
 			return
 		}
 
-		// отдаем с gzip сжатием если клиент это желает
-		info.controller.RespondCompressed(w, r, http.StatusOK, handler.CompressionGzip, &records)
+		info.controller.RespondError(w, http.StatusInternalServerError, err)
+
+		return
+	}
+
+	if limited && len(records) > 0 {
+		w.Header().Set(NextCursorHeaderName, encodeCursor(entity.NewLogCursor(records[len(records)-1])))
+	}
+
+	if len(records) == 0 {
+		info.controller.RespondData(w, http.StatusOK, nil)
+
+		return
+	}
+
+	if req.Format == formatProtobuf || r.Header.Get(BinaryFormatHeaderName) == binaryFormatHeaderProtobuf {
+		// клиент хочет Protobuf
+		w.Header().Add(BinaryFormatHeaderName, binaryFormatHeaderProtobuf)
+		info.controller.RespondCompressed(w, r, http.StatusOK, handler.CompressionGzip, protobufRecordsWriter(records))
+
+		return
+	}
+
+	// отдаем с gzip сжатием если клиент это желает
+	info.controller.RespondCompressed(w, r, http.StatusOK, handler.CompressionGzip, &records)
+}
+
+// Запрос в формате protobuf
+func isProtobufRequest(r *http.Request) bool {
+	if r.Header.Get(BinaryFormatHeaderName) == binaryFormatHeaderProtobuf {
+		return true
+	}
+
+	contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	return contentType == contentTypeProtobuf
+}
+
+func logRecordToProto(r entity.LogRecord) *schema_log.LogRecord {
+	return &schema_log.LogRecord{
+		Id:       r.ID,
+		LogTime:  timestamppb.New(r.LogTime),
+		RealTime: timestamppb.New(r.RealTime),
+		Level:    uint32(r.Level),
+		Message1: r.Message1,
+		Message2: r.Message2,
+		Message3: r.Message3,
+		Host:     r.Host,
+		Source:   r.Source,
+	}
+}
+
+func logRecordFromProto(r *schema_log.LogRecord) entity.LogRecord {
+	rec := entity.LogRecord{
+		ID:       r.GetId(),
+		Level:    int(r.GetLevel()),
+		Host:     r.GetHost(),
+		Source:   r.GetSource(),
+		Message1: r.GetMessage1(),
+		Message2: r.GetMessage2(),
+		Message3: r.GetMessage3(),
+	}
+
+	// отсутствующее время должно остаться нулевым, чтобы его отсекла валидация
+	if r.GetLogTime() != nil {
+		rec.LogTime = r.GetLogTime().AsTime()
+	}
+	if r.GetRealTime() != nil {
+		rec.RealTime = r.GetRealTime().AsTime()
+	}
+
+	return rec
+}
+
+// Потоковая запись записей журнала в формате schema.LogRecords. Повторяющееся поле в protobuf
+// кодируется как последовательность отдельных сообщений, поэтому записи можно сериализовать по одной
+func protobufRecordsWriter(records []entity.LogRecord) handler.StreamWriter {
+	return func(w io.Writer) error {
+		fieldNumber := (&schema_log.LogRecords{}).ProtoReflect().Descriptor().Fields().ByName("records").Number()
+
+		var buf []byte
+		for _, r := range records {
+			data, err := proto.Marshal(logRecordToProto(r))
+			if err != nil {
+				return err
+			}
+
+			buf = protowire.AppendTag(buf[:0], fieldNumber, protowire.BytesType)
+			buf = protowire.AppendBytes(buf, data)
+
+			if _, err = w.Write(buf); err != nil {
+				return err
+			}
+		}
+
+		return nil
 	}
 }
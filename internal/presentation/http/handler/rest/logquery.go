@@ -0,0 +1,258 @@
+package rest
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/n-r-w/log-server-v2/internal/domain/entity"
+)
+
+// Имена параметров запроса записей журнала в URL
+const (
+	paramTimeFrom = "timeFrom"
+	paramTimeTo   = "timeTo"
+	paramLevel    = "level"
+	paramMinLevel = "minLevel"
+	paramMaxLevel = "maxLevel"
+	paramHost     = "host"
+	paramSource   = "source"
+	paramMessage  = "message"
+	paramLimit    = "limit"
+	paramCursor   = "cursor"
+	paramFormat   = "format"
+	paramGroup    = "group"
+)
+
+// Значения параметра format
+const (
+	formatJSON     = "json"
+	formatProtobuf = "protobuf"
+)
+
+// paramError ошибка в параметре запроса. Сообщает клиенту, какой именно параметр неверен
+type paramError struct {
+	name string
+	err  error
+}
+
+func (e *paramError) Error() string {
+	return fmt.Sprintf("invalid parameter %q: %v", e.name, e.err)
+}
+
+func (e *paramError) Unwrap() error {
+	return e.err
+}
+
+func newParamError(name string, format string, args ...interface{}) error {
+	return &paramError{
+		name: name,
+		err:  fmt.Errorf(format, args...),
+	}
+}
+
+// logSearchRequest параметры запроса записей журнала. Заполняются из параметров URL или из JSON тела запроса
+type logSearchRequest struct {
+	TimeFrom time.Time `json:"timeFrom"`
+	TimeTo   time.Time `json:"timeTo"`
+	Levels   []int     `json:"levels"`
+	MinLevel int       `json:"minLevel"`
+	MaxLevel int       `json:"maxLevel"`
+	Hosts    []string  `json:"hosts"`
+	Sources  []string  `json:"sources"`
+	Message  string    `json:"message"`
+	Limit    int       `json:"limit"`
+	Cursor   string    `json:"cursor"`
+	Format   string    `json:"format"`
+}
+
+// parseLogSearchURL Разбор параметров запроса из URL. Параметры level, host и source могут повторяться,
+// level также допускает перечисление через запятую
+func parseLogSearchURL(values url.Values) (*logSearchRequest, error) {
+	req := &logSearchRequest{}
+
+	for name, vals := range values {
+		var err error
+
+		switch name {
+		case paramTimeFrom:
+			req.TimeFrom, err = parseTimeParam(name, vals)
+		case paramTimeTo:
+			req.TimeTo, err = parseTimeParam(name, vals)
+		case paramLevel:
+			for _, v := range vals {
+				for _, item := range strings.Split(v, ",") {
+					level, e := strconv.Atoi(strings.TrimSpace(item))
+					if e != nil {
+						return nil, newParamError(name, "%q is not an integer", item)
+					}
+					req.Levels = append(req.Levels, level)
+				}
+			}
+		case paramMinLevel:
+			req.MinLevel, err = parseIntParam(name, vals)
+		case paramMaxLevel:
+			req.MaxLevel, err = parseIntParam(name, vals)
+		case paramHost:
+			req.Hosts = vals
+		case paramSource:
+			req.Sources = vals
+		case paramMessage:
+			req.Message, err = singleParam(name, vals)
+		case paramLimit:
+			req.Limit, err = parseIntParam(name, vals)
+		case paramCursor:
+			req.Cursor, err = singleParam(name, vals)
+		case paramFormat:
+			req.Format, err = singleParam(name, vals)
+		default:
+			err = newParamError(name, "unknown parameter")
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return req, nil
+}
+
+// query Проверка параметров и преобразование в запрос к журналу
+func (req *logSearchRequest) query(maxLimit int) (entity.LogQuery, error) {
+	q := entity.LogQuery{
+		TimeFrom: req.TimeFrom,
+		TimeTo:   req.TimeTo,
+		Levels:   req.Levels,
+		MinLevel: req.MinLevel,
+		MaxLevel: req.MaxLevel,
+		Hosts:    req.Hosts,
+		Sources:  req.Sources,
+		Message:  req.Message,
+		Limit:    req.Limit,
+		Cursor:   nil,
+	}
+
+	if !q.TimeFrom.IsZero() && !q.TimeTo.IsZero() && q.TimeFrom.After(q.TimeTo) {
+		return q, newParamError(paramTimeTo, "must not be earlier than %s", paramTimeFrom)
+	}
+
+	for _, level := range q.Levels {
+		if !validLevel(level) {
+			return q, newParamError(paramLevel, "%d is out of range %d..%d", level, entity.LevelDebug, entity.LevelFatal)
+		}
+	}
+
+	if q.MinLevel != 0 && !validLevel(q.MinLevel) {
+		return q, newParamError(paramMinLevel, "%d is out of range %d..%d", q.MinLevel, entity.LevelDebug, entity.LevelFatal)
+	}
+
+	if q.MaxLevel != 0 && !validLevel(q.MaxLevel) {
+		return q, newParamError(paramMaxLevel, "%d is out of range %d..%d", q.MaxLevel, entity.LevelDebug, entity.LevelFatal)
+	}
+
+	if q.MinLevel != 0 && q.MaxLevel != 0 && q.MinLevel > q.MaxLevel {
+		return q, newParamError(paramMaxLevel, "must not be less than %s", paramMinLevel)
+	}
+
+	switch {
+	case q.Limit < 0:
+		return q, newParamError(paramLimit, "must not be negative")
+	case q.Limit > maxLimit:
+		return q, newParamError(paramLimit, "must not exceed %d", maxLimit)
+	case q.Limit == 0:
+		q.Limit = maxLimit
+	}
+
+	if req.Cursor != "" {
+		cursor, err := decodeCursor(req.Cursor)
+		if err != nil {
+			return q, &paramError{name: paramCursor, err: err}
+		}
+		q.Cursor = cursor
+	}
+
+	if req.Format != "" && req.Format != formatJSON && req.Format != formatProtobuf {
+		return q, newParamError(paramFormat, "must be %q or %q", formatJSON, formatProtobuf)
+	}
+
+	return q, nil
+}
+
+func validLevel(level int) bool {
+	return level >= entity.LevelDebug && level <= entity.LevelFatal
+}
+
+// encodeCursor Курсор передается клиенту в виде непрозрачной строки
+func encodeCursor(cursor *entity.LogCursor) string {
+	return base64.RawURLEncoding.EncodeToString(
+		[]byte(strconv.FormatInt(cursor.LogTime.UnixNano(), 10) + "." + strconv.FormatUint(cursor.ID, 10)))
+}
+
+func decodeCursor(s string) (*entity.LogCursor, error) {
+	errMalformed := errors.New("malformed cursor")
+
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errMalformed
+	}
+
+	parts := strings.Split(string(data), ".")
+	if len(parts) != 2 {
+		return nil, errMalformed
+	}
+
+	nano, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return nil, errMalformed
+	}
+
+	id, err := strconv.ParseUint(parts[1], 10, 64)
+	if err != nil {
+		return nil, errMalformed
+	}
+
+	return &entity.LogCursor{
+		LogTime: time.Unix(0, nano).UTC(),
+		ID:      id,
+	}, nil
+}
+
+func singleParam(name string, vals []string) (string, error) {
+	if len(vals) != 1 {
+		return "", newParamError(name, "must be specified once")
+	}
+
+	return vals[0], nil
+}
+
+func parseIntParam(name string, vals []string) (int, error) {
+	v, err := singleParam(name, vals)
+	if err != nil {
+		return 0, err
+	}
+
+	i, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, newParamError(name, "%q is not an integer", v)
+	}
+
+	return i, nil
+}
+
+func parseTimeParam(name string, vals []string) (time.Time, error) {
+	v, err := singleParam(name, vals)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, v)
+	if err != nil {
+		return time.Time{}, newParamError(name, "%q is not a RFC 3339 time", v)
+	}
+
+	return t, nil
+}
@@ -0,0 +1,244 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/n-r-w/log-server-v2/internal/domain/entity"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	contentTypeProtobuf = "application/x-protobuf"
+	contentTypeJSON     = "application/json"
+
+	// Атрибуты ресурса OpenTelemetry, которые переносятся в отдельные поля записи журнала
+	otlpAttrHostName    = "host.name"
+	otlpAttrServiceName = "service.name"
+)
+
+var errUnsupportedContentType = errors.New("unsupported content type")
+
+// Прием журналов в формате OTLP/HTTP (protobuf или JSON)
+func (info *restInfo) exportOtlpLogs() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if contentType != contentTypeProtobuf && contentType != contentTypeJSON {
+			info.controller.RespondError(w, http.StatusUnsupportedMediaType, errUnsupportedContentType)
+
+			return
+		}
+
+		// сжатое тело запроса распаковывается на уровне роутера
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			info.respondBodyError(w, err)
+
+			return
+		}
+
+		req := &collogspb.ExportLogsServiceRequest{}
+		if contentType == contentTypeProtobuf {
+			err = proto.Unmarshal(body, req)
+		} else {
+			err = protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal(body, req)
+		}
+
+		if err != nil {
+			info.controller.RespondError(w, http.StatusBadRequest, err)
+
+			return
+		}
+
+		records, rejected := otlpToLogRecords(req, time.Now())
+		if len(records) > 0 {
+			if err := info.log.Insert(r.Context(), records); err != nil {
+				info.respondInsertError(w, err)
+
+				return
+			}
+		}
+
+		resp := &collogspb.ExportLogsServiceResponse{}
+		if rejected > 0 {
+			resp.PartialSuccess = &collogspb.ExportLogsPartialSuccess{
+				RejectedLogRecords: rejected,
+				ErrorMessage:       "log records without body were rejected",
+			}
+		}
+
+		var out []byte
+		if contentType == contentTypeProtobuf {
+			out, err = proto.Marshal(resp)
+		} else {
+			out, err = protojson.Marshal(resp)
+		}
+
+		if err != nil {
+			info.controller.RespondError(w, http.StatusInternalServerError, err)
+
+			return
+		}
+
+		w.Header().Set("Content-Type", contentType)
+		info.controller.RespondData(w, http.StatusOK, out)
+	}
+}
+
+// Преобразование запроса OTLP в записи журнала. Записи без тела не принимаются и учитываются в rejected
+func otlpToLogRecords(req *collogspb.ExportLogsServiceRequest, receiveTime time.Time) (records []entity.LogRecord, rejected int64) {
+	for _, rl := range req.GetResourceLogs() {
+		resourceAttrs := otlpAttributes(rl.GetResource().GetAttributes())
+
+		host, _ := resourceAttrs[otlpAttrHostName].(string)
+		service, _ := resourceAttrs[otlpAttrServiceName].(string)
+		delete(resourceAttrs, otlpAttrHostName)
+		delete(resourceAttrs, otlpAttrServiceName)
+
+		resourceText := otlpJSON(resourceAttrs)
+
+		for _, sl := range rl.GetScopeLogs() {
+			source := service
+			if source == "" {
+				source = sl.GetScope().GetName()
+			}
+
+			for _, lr := range sl.GetLogRecords() {
+				body := otlpValueText(lr.GetBody())
+				if body == "" {
+					rejected++
+
+					continue
+				}
+
+				records = append(records, entity.LogRecord{
+					LogTime:  otlpTime(lr, receiveTime),
+					Level:    otlpLevel(lr.GetSeverityNumber(), lr.GetSeverityText()),
+					Host:     host,
+					Source:   source,
+					Message1: body,
+					Message2: otlpJSON(otlpAttributes(lr.GetAttributes())),
+					Message3: resourceText,
+				})
+			}
+		}
+	}
+
+	return records, rejected
+}
+
+// Время события. Если оно не задано, то время получения события коллектором или время приема
+func otlpTime(lr *logspb.LogRecord, receiveTime time.Time) time.Time {
+	switch {
+	case lr.GetTimeUnixNano() > 0:
+		return time.Unix(0, int64(lr.GetTimeUnixNano())).UTC()
+	case lr.GetObservedTimeUnixNano() > 0:
+		return time.Unix(0, int64(lr.GetObservedTimeUnixNano())).UTC()
+	default:
+		return receiveTime
+	}
+}
+
+// Преобразование уровня OTLP в уровень журнала. Если числовой уровень не задан, то используется текстовый
+func otlpLevel(severity logspb.SeverityNumber, severityText string) int {
+	switch {
+	case severity >= logspb.SeverityNumber_SEVERITY_NUMBER_FATAL:
+		return entity.LevelFatal
+	case severity >= logspb.SeverityNumber_SEVERITY_NUMBER_ERROR:
+		return entity.LevelError
+	case severity >= logspb.SeverityNumber_SEVERITY_NUMBER_WARN:
+		return entity.LevelWarn
+	case severity >= logspb.SeverityNumber_SEVERITY_NUMBER_INFO:
+		return entity.LevelInfo
+	case severity >= logspb.SeverityNumber_SEVERITY_NUMBER_TRACE:
+		return entity.LevelDebug
+	}
+
+	switch strings.ToLower(severityText) {
+	case "trace", "debug":
+		return entity.LevelDebug
+	case "warn", "warning":
+		return entity.LevelWarn
+	case "error":
+		return entity.LevelError
+	case "fatal", "critical", "panic":
+		return entity.LevelFatal
+	default:
+		return entity.LevelInfo
+	}
+}
+
+// Текстовое представление значения. Строки передаются как есть, остальное в виде JSON
+func otlpValueText(v *commonpb.AnyValue) string {
+	if v == nil {
+		return ""
+	}
+
+	if s, ok := v.GetValue().(*commonpb.AnyValue_StringValue); ok {
+		return s.StringValue
+	}
+
+	return otlpJSON(otlpValue(v))
+}
+
+func otlpValue(v *commonpb.AnyValue) interface{} {
+	switch val := v.GetValue().(type) {
+	case *commonpb.AnyValue_StringValue:
+		return val.StringValue
+	case *commonpb.AnyValue_BoolValue:
+		return val.BoolValue
+	case *commonpb.AnyValue_IntValue:
+		return val.IntValue
+	case *commonpb.AnyValue_DoubleValue:
+		return val.DoubleValue
+	case *commonpb.AnyValue_BytesValue:
+		return val.BytesValue
+	case *commonpb.AnyValue_ArrayValue:
+		values := make([]interface{}, 0, len(val.ArrayValue.GetValues()))
+		for _, item := range val.ArrayValue.GetValues() {
+			values = append(values, otlpValue(item))
+		}
+
+		return values
+	case *commonpb.AnyValue_KvlistValue:
+		return otlpAttributes(val.KvlistValue.GetValues())
+	default:
+		return nil
+	}
+}
+
+func otlpAttributes(attrs []*commonpb.KeyValue) map[string]interface{} {
+	res := make(map[string]interface{}, len(attrs))
+	for _, kv := range attrs {
+		res[kv.GetKey()] = otlpValue(kv.GetValue())
+	}
+
+	return res
+}
+
+// JSON представление. Для пустых значений пустая строка
+func otlpJSON(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+
+	if m, ok := v.(map[string]interface{}); ok && len(m) == 0 {
+		return ""
+	}
+
+	out, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+
+	return string(out)
+}
@@ -14,46 +14,81 @@ var (
 	errNotAdmin         = errors.New("not admin")
 )
 
+const (
+	// BinaryFormatHeaderName Имя хедера REST запроса, в котором клиент указывает в каком виде он желает получить ответ
+	BinaryFormatHeaderName = "binary-format"
+	// NextCursorHeaderName Имя хедера ответа, в котором передается курсор для получения следующей порции записей журнала
+	NextCursorHeaderName = "X-Next-Cursor"
+
+	// Имя хедера, в котором передается CSRF токен
+	csrfHeaderName = "X-CSRF-Token"
+
+	// Код ответа, если клиент разорвал соединение до ответа (как в nginx). Клиент его не получит,
+	// он нужен для журнала запросов
+	statusClientClosedRequest = 499
+)
+
 // задаем свой тип, чтобы была возможность отличить что лежит в переменной any
 type ctxKey string
 
 const (
 	// Ключ для хранения модели пользователя в контексте запроса после успешной аунтетификации
 	ctxKeyUser = ctxKey("rest-user")
+	// Ключ для хранения способа аутентификации
+	ctxKeyAuthMethod = ctxKey("rest-auth-method")
 
-	// Имя хедера REST запроса, в котором клиент указывает в каком виде он желает получить ответ
-	binaryFormatHeaderName = "binary-format"
 	// Требуется ответ в формате protobuf
 	binaryFormatHeaderProtobuf = "protobuf"
 )
 
+// Способ аутентификации запроса
+type authMethod string
+
+const (
+	authCookie      = authMethod("cookie")
+	authBearer      = authMethod("bearer")
+	authCertificate = authMethod("certificate")
+)
+
 type restInfo struct {
 	controller          handler.RouterInterface
 	user                handler.UserInterface
+	session             handler.SessionInterface
 	log                 handler.LogInterface
-	superAdminID        uint64
+	audit               handler.AuditInterface
+	twoFactor           handler.TwoFactorInterface
+	health              handler.HealthInterface
 	sessionAge          int
 	maxLogRecordsResult int
 }
 
 // InitRoutes Инициализация маршрутов
-func InitRoutes(controller handler.RouterInterface, user handler.UserInterface, log handler.LogInterface, superAdminID uint64, sessionAge int, maxLogRecordsResult int) {
+func InitRoutes(controller handler.RouterInterface, user handler.UserInterface, session handler.SessionInterface, log handler.LogInterface, audit handler.AuditInterface,
+	twoFactor handler.TwoFactorInterface, health handler.HealthInterface, sessionAge int, maxLogRecordsResult int) {
 	i := &restInfo{
 		controller:          controller,
 		user:                user,
+		session:             session,
 		log:                 log,
-		superAdminID:        superAdminID,
+		audit:               audit,
+		twoFactor:           twoFactor,
+		health:              health,
 		sessionAge:          sessionAge,
 		maxLogRecordsResult: maxLogRecordsResult,
 	}
 
+	// состояние сервера для балансировщиков и мониторинга, без аутентификации
+	controller.AddRoute("", "/api/health", i.getHealth(), "GET")
+
 	// логин
 	controller.AddRoute("/api/auth", "/login", i.handleSessionsCreate(), "POST")
+	// второй шаг логина: код второго фактора
+	controller.AddRoute("/api/auth", "/login/verify", i.handleLoginVerify(), "POST")
 	// закрытие сессии
 	controller.AddRoute("/api/auth", "/close", i.closeSession(), "DELETE")
 
-	// устанавливаем middleware для проверки валидности сессии
-	controller.AddMiddleware("/api/private", i.authenticateUser)
+	// устанавливаем middleware для проверки валидности сессии и CSRF токена
+	controller.AddMiddleware("/api/private", i.authenticateUser, i.checkCSRF)
 
 	// запрос с информацией о текущей сессии
 	controller.AddRoute("/api/private", "/whoami", i.handleWhoami(), "GET")
@@ -61,12 +96,42 @@ func InitRoutes(controller handler.RouterInterface, user handler.UserInterface,
 	controller.AddRoute("/api/private", "/add-user", i.addUser(), "POST")
 	// сменить пароль
 	controller.AddRoute("/api/private", "/change", i.changePassword(), "PUT")
+	// снять блокировку входа пользователя после неудачных попыток
+	controller.AddRoute("/api/private", "/unlock", i.unlockUser(), "PUT")
 	// получить список пользователей
 	controller.AddRoute("/api/private", "/users", i.getUsers(), "GET")
+	// список действующих сессий пользователя
+	controller.AddRoute("/api/private", "/sessions", i.getSessions(), "GET")
+	// завершить сессию по ее ID
+	controller.AddRoute("/api/private", "/sessions", i.closeSessionByID(), "DELETE")
+	// завершить все сессии пользователя
+	controller.AddRoute("/api/private", "/revoke-sessions", i.revokeSessions(), "PUT")
+	// состояние второго фактора текущего пользователя
+	controller.AddRoute("/api/private", "/2fa", i.getTwoFactorStatus(), "GET")
+	// начать подключение второго фактора
+	controller.AddRoute("/api/private", "/2fa/enrol", i.enrolTwoFactor(), "POST")
+	// подтвердить подключение второго фактора кодом из приложения
+	controller.AddRoute("/api/private", "/2fa/confirm", i.confirmTwoFactor(), "POST")
+	// выдать новые резервные коды
+	controller.AddRoute("/api/private", "/2fa/recovery-codes", i.regenerateRecoveryCodes(), "POST")
+	// отключить второй фактор
+	controller.AddRoute("/api/private", "/2fa/disable", i.disableTwoFactor(), "PUT")
+	// обязательность второго фактора для ролей (только админ)
+	controller.AddRoute("/api/private", "/2fa/policy", i.getTwoFactorPolicies(), "GET")
+	controller.AddRoute("/api/private", "/2fa/policy", i.setTwoFactorPolicy(), "PUT")
+	// журнал аудита (только админ)
+	controller.AddRoute("/api/private", "/audit", i.getAuditEvents(), "GET")
 	// добавить запись в лог
 	controller.AddRoute("/api/private", "/add-log", i.addLogRecord(), "POST")
-	// получить список записей из лога. Ответ в gzip формате
+	// получить список записей из лога. Параметры в URL, ответ в gzip формате
 	controller.AddRoute("/api/private", "/records", i.getLogRecords(), "GET")
+	// получить список записей из лога. Параметры в JSON теле запроса
+	controller.AddRoute("/api/private", "/records/search", i.searchLogRecords(), "POST")
+	// количество записей лога по уровню, хосту, источнику, часам или суткам. Фильтры в URL, как для /records
+	controller.AddRoute("/api/private", "/records/stats", i.getLogStats(), "GET")
+	// добавить записи в лог в формате OTLP/HTTP (OpenTelemetry). Путь соответствует спецификации OTLP,
+	// поэтому в экспортере достаточно указать endpoint http://host:port/api/private/otlp
+	controller.AddRoute("/api/private", "/otlp/v1/logs", i.exportOtlpLogs(), "POST")
 }
 
 // Текущий пользователь. Он помещается в контекст в методе authenticateUser
@@ -78,3 +143,39 @@ func currentUser(r *http.Request) *entity.User {
 
 	return nil
 }
+
+// Способ аутентификации текущего запроса. Он помещается в контекст в методе authenticateUser
+func currentAuthMethod(r *http.Request) authMethod {
+	method, _ := r.Context().Value(ctxKeyAuthMethod).(authMethod)
+
+	return method
+}
+
+// Ответ на ошибку чтения тела запроса
+func (info *restInfo) respondBodyError(w http.ResponseWriter, err error) {
+	if errors.Is(err, handler.ErrRequestTooLarge) {
+		info.controller.RespondError(w, http.StatusRequestEntityTooLarge, err)
+	} else {
+		info.controller.RespondError(w, http.StatusBadRequest, err)
+	}
+}
+
+// Ответ на ошибку записи в журнал. 429 и 503 - запись можно повторить позже, 400 - ошибка в самих записях
+func (info *restInfo) respondInsertError(w http.ResponseWriter, err error) {
+	var (
+		overload    handler.OverloadError
+		unavailable handler.UnavailableError
+		invalid     handler.InvalidRequestError
+	)
+
+	switch {
+	case errors.As(err, &overload) && overload.Overloaded():
+		info.controller.RespondError(w, http.StatusTooManyRequests, err)
+	case errors.As(err, &unavailable) && unavailable.Unavailable():
+		info.controller.RespondError(w, http.StatusServiceUnavailable, err)
+	case errors.As(err, &invalid) && invalid.InvalidRequest():
+		info.controller.RespondError(w, http.StatusBadRequest, err)
+	default:
+		info.controller.RespondError(w, http.StatusInternalServerError, err)
+	}
+}
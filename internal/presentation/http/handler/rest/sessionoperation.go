@@ -0,0 +1,89 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// Список действующих сессий. Админ может указать логин другого пользователя в параметре login
+func (info *restInfo) getSessions() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cu := currentUser(r)
+		if cu == nil {
+			info.controller.RespondError(w, http.StatusInternalServerError, errNotAuthenticated)
+
+			return
+		}
+
+		sessions, err := info.session.GetSessions(r.Context(), *cu, r.URL.Query().Get("login"))
+		if err != nil {
+			info.controller.RespondError(w, http.StatusForbidden, err)
+
+			return
+		}
+
+		info.controller.RespondData(w, http.StatusOK, &sessions)
+	}
+}
+
+// Завершить сессию по ее ID, переданному в параметре id
+func (info *restInfo) closeSessionByID() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cu := currentUser(r)
+		if cu == nil {
+			info.controller.RespondError(w, http.StatusInternalServerError, errNotAuthenticated)
+
+			return
+		}
+
+		id := r.URL.Query().Get("id")
+		if id == "" {
+			info.controller.RespondError(w, http.StatusBadRequest, errors.New("session id undefined"))
+
+			return
+		}
+
+		if err := info.session.CloseSession(r.Context(), *cu, id, info.controller.RequestInfo(r)); err != nil {
+			info.controller.RespondError(w, http.StatusForbidden, err)
+
+			return
+		}
+
+		info.controller.RespondData(w, http.StatusOK, nil)
+	}
+}
+
+// Завершить все сессии пользователя. Без логина - свои сессии, чужие может завершать только админ
+func (info *restInfo) revokeSessions() http.HandlerFunc {
+	type request struct {
+		Login string `json:"login"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		req := request{
+			Login: "",
+		}
+		// парсим входящий json
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			info.controller.RespondError(w, http.StatusBadRequest, err)
+
+			return
+		}
+
+		cu := currentUser(r)
+		if cu == nil {
+			info.controller.RespondError(w, http.StatusInternalServerError, errNotAuthenticated)
+
+			return
+		}
+
+		if err := info.session.CloseUserSessions(r.Context(), *cu, req.Login, info.controller.RequestInfo(r)); err != nil {
+			info.controller.RespondError(w, http.StatusForbidden, err)
+
+			return
+		}
+
+		info.controller.RespondData(w, http.StatusOK, nil)
+	}
+}
@@ -0,0 +1,192 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/n-r-w/log-server-v2/internal/domain/entity"
+)
+
+// Ответ с резервными кодами второго фактора. Коды показываются только один раз
+type recoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+// Состояние второго фактора текущего пользователя
+func (info *restInfo) getTwoFactorStatus() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cu := currentUser(r)
+		if cu == nil {
+			info.controller.RespondError(w, http.StatusInternalServerError, errNotAuthenticated)
+
+			return
+		}
+
+		status, err := info.twoFactor.Status(r.Context(), *cu)
+		if err != nil {
+			info.controller.RespondError(w, http.StatusInternalServerError, err)
+
+			return
+		}
+
+		info.controller.RespondData(w, http.StatusOK, &status)
+	}
+}
+
+// Начать подключение второго фактора. В ответе секрет и ссылка otpauth:// для приложения-аутентификатора
+func (info *restInfo) enrolTwoFactor() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cu := currentUser(r)
+		if cu == nil {
+			info.controller.RespondError(w, http.StatusInternalServerError, errNotAuthenticated)
+
+			return
+		}
+
+		enrolment, err := info.twoFactor.Enrol(r.Context(), *cu)
+		if err != nil {
+			info.controller.RespondError(w, http.StatusForbidden, err)
+
+			return
+		}
+
+		info.controller.RespondData(w, http.StatusOK, &enrolment)
+	}
+}
+
+// Подтвердить подключение второго фактора кодом из приложения. В ответе резервные коды
+func (info *restInfo) confirmTwoFactor() http.HandlerFunc {
+	return info.handleTwoFactorCode(func(cu entity.User, code string, r *http.Request) ([]string, error) {
+		return info.twoFactor.Confirm(r.Context(), cu, code, info.controller.RequestInfo(r)) //nolint:wrapcheck
+	})
+}
+
+// Выдать новые резервные коды взамен старых
+func (info *restInfo) regenerateRecoveryCodes() http.HandlerFunc {
+	return info.handleTwoFactorCode(func(cu entity.User, code string, r *http.Request) ([]string, error) {
+		return info.twoFactor.RegenerateRecoveryCodes(r.Context(), cu, code, info.controller.RequestInfo(r)) //nolint:wrapcheck
+	})
+}
+
+// Общая часть запросов, которые подтверждаются кодом из приложения и возвращают резервные коды
+func (info *restInfo) handleTwoFactorCode(f func(cu entity.User, code string, r *http.Request) ([]string, error)) http.HandlerFunc {
+	type request struct {
+		Code string `json:"code"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		req := request{
+			Code: "",
+		}
+		// парсим входящий json
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			info.controller.RespondError(w, http.StatusBadRequest, err)
+
+			return
+		}
+
+		cu := currentUser(r)
+		if cu == nil {
+			info.controller.RespondError(w, http.StatusInternalServerError, errNotAuthenticated)
+
+			return
+		}
+
+		codes, err := f(*cu, req.Code, r)
+		if err != nil {
+			info.respondAuthError(w, err)
+
+			return
+		}
+
+		info.controller.RespondData(w, http.StatusOK, &recoveryCodesResponse{RecoveryCodes: codes})
+	}
+}
+
+// Отключить второй фактор. Свой - с кодом из приложения или резервным кодом, чужой (логин в поле login) - только админ
+func (info *restInfo) disableTwoFactor() http.HandlerFunc {
+	type request struct {
+		Login string `json:"login"`
+		Code  string `json:"code"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		req := request{
+			Login: "",
+			Code:  "",
+		}
+		// парсим входящий json
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			info.controller.RespondError(w, http.StatusBadRequest, err)
+
+			return
+		}
+
+		cu := currentUser(r)
+		if cu == nil {
+			info.controller.RespondError(w, http.StatusInternalServerError, errNotAuthenticated)
+
+			return
+		}
+
+		if err := info.twoFactor.Disable(r.Context(), *cu, req.Login, req.Code, info.controller.RequestInfo(r)); err != nil {
+			info.respondAuthError(w, err)
+
+			return
+		}
+
+		info.controller.RespondData(w, http.StatusOK, nil)
+	}
+}
+
+// Обязательность второго фактора для ролей
+func (info *restInfo) getTwoFactorPolicies() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cu := currentUser(r)
+		if cu == nil {
+			info.controller.RespondError(w, http.StatusInternalServerError, errNotAuthenticated)
+
+			return
+		}
+
+		policies, err := info.twoFactor.Policies(r.Context(), *cu)
+		if err != nil {
+			info.controller.RespondError(w, http.StatusForbidden, err)
+
+			return
+		}
+
+		info.controller.RespondData(w, http.StatusOK, &policies)
+	}
+}
+
+// Сделать второй фактор обязательным или необязательным для роли
+func (info *restInfo) setTwoFactorPolicy() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		policy := entity.TwoFactorPolicy{
+			Role:     "",
+			Required: false,
+		}
+		// парсим входящий json
+		if err := json.NewDecoder(r.Body).Decode(&policy); err != nil {
+			info.controller.RespondError(w, http.StatusBadRequest, err)
+
+			return
+		}
+
+		cu := currentUser(r)
+		if cu == nil {
+			info.controller.RespondError(w, http.StatusInternalServerError, errNotAuthenticated)
+
+			return
+		}
+
+		if err := info.twoFactor.SetPolicy(r.Context(), *cu, policy, info.controller.RequestInfo(r)); err != nil {
+			info.respondAuthError(w, err)
+
+			return
+		}
+
+		info.controller.RespondData(w, http.StatusOK, nil)
+	}
+}
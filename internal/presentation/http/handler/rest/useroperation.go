@@ -17,11 +17,6 @@ func (info *restInfo) addUser() http.HandlerFunc {
 
 			return
 		}
-		if cu.ID != info.superAdminID {
-			info.controller.RespondError(w, http.StatusForbidden, errNotAdmin)
-
-			return
-		}
 
 		u := entity.User{
 			ID:                0,
@@ -37,8 +32,10 @@ func (info *restInfo) addUser() http.HandlerFunc {
 			return
 		}
 
-		if err := info.user.Insert(u); err != nil {
+		if err := info.user.AddUser(r.Context(), *cu, u, info.controller.RequestInfo(r)); err != nil {
 			info.controller.RespondError(w, http.StatusForbidden, err)
+
+			return
 		}
 
 		info.controller.RespondData(w, http.StatusCreated, nil)
@@ -54,13 +51,13 @@ func (info *restInfo) getUsers() http.HandlerFunc {
 
 			return
 		}
-		if cu.ID != info.superAdminID {
+		if !cu.IsAdmin() {
 			info.controller.RespondError(w, http.StatusForbidden, errNotAdmin)
 
 			return
 		}
 
-		users, err := info.user.GetUsers()
+		users, err := info.user.GetUsers(r.Context())
 		if err != nil {
 			info.controller.RespondError(w, http.StatusInternalServerError, err)
 
@@ -97,9 +94,55 @@ func (info *restInfo) changePassword() http.HandlerFunc {
 			return
 		}
 
-		_, err := info.user.ChangePassword(*currentUser, req.Login, req.Password)
+		id, err := info.user.ChangePassword(r.Context(), *currentUser, req.Login, req.Password, info.controller.RequestInfo(r))
 		if err != nil {
 			info.controller.RespondError(w, http.StatusForbidden, err)
+
+			return
+		}
+
+		// при смене пароля все сессии пользователя завершаются. Если пароль менялся себе,
+		// то вместо текущей сессии сразу открываем новую
+		if id == currentUser.ID && currentAuthMethod(r) == authCookie {
+			if err = info.controller.StartSession(w, r, id, info.sessionAge); err != nil {
+				info.controller.RespondError(w, http.StatusInternalServerError, err)
+
+				return
+			}
+		}
+
+		info.controller.RespondData(w, http.StatusOK, nil)
+	}
+}
+
+// Снять блокировку входа для пользователя
+func (info *restInfo) unlockUser() http.HandlerFunc {
+	type request struct {
+		Login string `json:"login"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		req := request{
+			Login: "",
+		}
+		// парсим входящий json
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			info.controller.RespondError(w, http.StatusBadRequest, err)
+
+			return
+		}
+
+		cu := currentUser(r)
+		if cu == nil {
+			info.controller.RespondError(w, http.StatusInternalServerError, errNotAuthenticated)
+
+			return
+		}
+
+		if err := info.user.UnlockUser(r.Context(), *cu, req.Login, info.controller.RequestInfo(r)); err != nil {
+			info.controller.RespondError(w, http.StatusForbidden, err)
+
+			return
 		}
 
 		info.controller.RespondData(w, http.StatusOK, nil)
@@ -0,0 +1,209 @@
+package router
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+	"github.com/n-r-w/log-server-v2/internal/presentation/http/handler"
+)
+
+// Размер буфера, через который ответ передается в сжатие
+const streamBufferSize = 32 * 1024
+
+// Поддерживаемые алгоритмы сжатия в порядке предпочтения сервера
+var supportedEncodings = []struct {
+	name  string
+	ctype handler.CompressionType
+}{
+	{"zstd", handler.CompressionZstd},
+	{"br", handler.CompressionBrotli},
+	{"gzip", handler.CompressionGzip},
+	{"deflate", handler.CompressionDeflate},
+}
+
+// negotiateEncoding Выбор алгоритма сжатия по заголовку Accept-Encoding с учетом q-значений (RFC 7231, 5.3.4).
+// Из допустимых для клиента алгоритмов выбирается алгоритм с максимальным q. При равенстве q
+// предпочтение отдается алгоритму preferred, затем порядку supportedEncodings
+func negotiateEncoding(acceptEncoding string, preferred handler.CompressionType) (handler.CompressionType, string) {
+	if preferred == handler.CompressionNo || strings.TrimSpace(acceptEncoding) == "" {
+		return handler.CompressionNo, ""
+	}
+
+	weights := make(map[string]float64)
+	wildcard := -1.0
+
+	for _, item := range strings.Split(acceptEncoding, ",") {
+		params := strings.Split(item, ";")
+		name := strings.ToLower(strings.TrimSpace(params[0]))
+		if name == "" {
+			continue
+		}
+
+		q := 1.0
+		for _, p := range params[1:] {
+			p = strings.TrimSpace(p)
+			if !strings.HasPrefix(p, "q=") && !strings.HasPrefix(p, "Q=") {
+				continue
+			}
+
+			v, err := strconv.ParseFloat(strings.TrimSpace(p[2:]), 64)
+			if err != nil || v < 0 || v > 1 {
+				v = 0
+			}
+			q = v
+		}
+
+		if name == "*" {
+			wildcard = q
+		} else {
+			weights[name] = q
+		}
+	}
+
+	type candidate struct {
+		name  string
+		ctype handler.CompressionType
+		q     float64
+		order int
+	}
+
+	var candidates []candidate
+	for i, enc := range supportedEncodings {
+		q, ok := weights[enc.name]
+		if !ok {
+			// старые клиенты могут присылать x-gzip
+			if enc.ctype == handler.CompressionGzip {
+				q, ok = weights["x-gzip"]
+			}
+			if !ok {
+				q = wildcard
+			}
+		}
+
+		if q <= 0 {
+			continue
+		}
+
+		order := i + 1
+		if enc.ctype == preferred {
+			order = 0
+		}
+
+		candidates = append(candidates, candidate{name: enc.name, ctype: enc.ctype, q: q, order: order})
+	}
+
+	if len(candidates) == 0 {
+		return handler.CompressionNo, ""
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].q != candidates[j].q {
+			return candidates[i].q > candidates[j].q
+		}
+
+		return candidates[i].order < candidates[j].order
+	})
+
+	return candidates[0].ctype, candidates[0].name
+}
+
+// newCompressor Создание потокового компрессора, пишущего в w
+func newCompressor(ctype handler.CompressionType, w io.Writer) (io.WriteCloser, error) {
+	switch ctype {
+	case handler.CompressionGzip:
+		return gzip.NewWriterLevel(w, gzip.BestSpeed)
+	case handler.CompressionDeflate:
+		return flate.NewWriter(w, flate.BestSpeed)
+	case handler.CompressionBrotli:
+		return brotli.NewWriterLevel(w, brotli.BestSpeed), nil
+	case handler.CompressionZstd:
+		return zstd.NewWriter(w, zstd.WithEncoderLevel(zstd.SpeedFastest))
+	default:
+		return nopWriteCloser{w}, nil
+	}
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// writeStream Потоковая запись данных ответа. Срезы преобразуются в JSON поэлементно,
+// чтобы не держать в памяти весь результат целиком
+func writeStream(w io.Writer, data interface{}) error {
+	bw := bufio.NewWriterSize(w, streamBufferSize)
+
+	var err error
+	switch d := data.(type) {
+	case handler.StreamWriter:
+		err = d(bw)
+	case []byte:
+		_, err = bw.Write(d)
+	case string:
+		_, err = bw.WriteString(d)
+	default:
+		err = writeJSON(bw, data)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return bw.Flush()
+}
+
+// contentType Тип содержимого для данных ответа. Пустая строка - неизвестен
+func contentType(data interface{}) string {
+	switch data.(type) {
+	case handler.StreamWriter, []byte, string:
+		return ""
+	default:
+		return "application/json"
+	}
+}
+
+func writeJSON(w io.Writer, data interface{}) error {
+	v := reflect.ValueOf(data)
+	for v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+
+	if v.Kind() != reflect.Slice || v.IsNil() {
+		return json.NewEncoder(w).Encode(data)
+	}
+
+	if _, err := io.WriteString(w, "["); err != nil {
+		return err
+	}
+
+	for i := 0; i < v.Len(); i++ {
+		if i > 0 {
+			if _, err := io.WriteString(w, ","); err != nil {
+				return err
+			}
+		}
+
+		item, err := json.Marshal(v.Index(i).Interface())
+		if err != nil {
+			return err
+		}
+
+		if _, err = w.Write(item); err != nil {
+			return err
+		}
+	}
+
+	_, err := io.WriteString(w, "]\n")
+
+	return err
+}
@@ -0,0 +1,58 @@
+package router
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+)
+
+// Имя хедера, в котором клиент передает CSRF токен, а сервер сообщает его после логина
+const csrfHeaderName = "X-CSRF-Token"
+
+var errCSRFTokenInvalid = errors.New("csrf token missing or invalid")
+
+// CSRFToken CSRF токен для текущей сессии. Пустая строка, если защита от CSRF выключена
+func (router *Router) CSRFToken(r *http.Request) (string, error) {
+	if !router.csrfProtection {
+		return "", nil
+	}
+
+	token, err := router.sessionToken(r)
+	if err != nil {
+		return "", err
+	}
+
+	return router.csrfTokenFor(router.sessionKeys[0], token), nil
+}
+
+// CheckCSRF Проверка CSRF токена в хедере запроса. Токен привязан к сессии, поэтому хранить его на сервере не надо:
+// он вычисляется как HMAC токена сессии, который злоумышленник на другом сайте прочитать не может
+func (router *Router) CheckCSRF(r *http.Request) error {
+	if !router.csrfProtection {
+		return nil
+	}
+
+	token, err := router.sessionToken(r)
+	if err != nil {
+		return err
+	}
+
+	// токены, выданные до смены ключа, тоже действительны
+	header := []byte(r.Header.Get(csrfHeaderName))
+	for _, key := range router.sessionKeys {
+		if hmac.Equal(header, []byte(router.csrfTokenFor(key, token))) {
+			return nil
+		}
+	}
+
+	return errCSRFTokenInvalid
+}
+
+func (router *Router) csrfTokenFor(key []byte, sessionToken string) string {
+	mac := hmac.New(sha256.New, key)
+	_, _ = mac.Write([]byte("csrf:" + sessionToken))
+
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -1,21 +1,42 @@
 package router
 
 import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
 	"context"
+	"errors"
+	"io"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/klauspost/compress/zstd"
+	"github.com/n-r-w/log-server-v2/internal/presentation/http/handler"
 	"github.com/n-r-w/log-server-v2/pkg/logger"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
+var tracer = otel.Tracer("github.com/n-r-w/log-server-v2/internal/presentation/http/router")
+
+var errUnsupportedContentEncoding = errors.New("unsupported content encoding")
+
 // Реализует интерфейс http.ResponseWriter
 // Подменяет собой стандартный http.ResponseWriter и позволяет дополнительно сохранить в нем ошибку
 type responseWriterEx struct {
 	http.ResponseWriter
 	code int
 	err  error
+	// ID пользователя, выполняющего запрос. Заполняется после аутентификации для журнала запросов
+	userID uint64
 }
 
 func (w *responseWriterEx) WriteHeader(statusCode int) {
@@ -23,16 +44,43 @@ func (w *responseWriterEx) WriteHeader(statusCode int) {
 	w.ResponseWriter.WriteHeader(statusCode)
 }
 
-// Добавляем к контексту уникальный ID сесии с ключом ctxKeyRequestID
+// Максимальная длина X-Request-ID, принимаемого от клиента
+const maxRequestIDLength = 128
+
+// Добавляем к контексту уникальный ID сесии с ключом ctxKeyRequestID. Если ID передан клиентом или прокси
+// в заголовке X-Request-ID, то используется он, чтобы запрос можно было найти в журналах всей цепочки
 func (router *Router) setRequestID(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		id := uuid.New().String()
+		id := r.Header.Get("X-Request-ID")
+		if !validRequestID(id) {
+			id = uuid.New().String()
+		}
 		w.Header().Set("X-Request-ID", id)
 		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), ctxKeyRequestID, id)))
 	})
 }
 
-// Выводим все запросы в журнал
+// validRequestID ID запроса от клиента попадает в журнал и заголовок ответа, поэтому допускаются только
+// короткие строки из безопасных символов
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+// Выводим все запросы в журнал и создаем для них трассировку. Трассировка продолжает ту, что передана
+// клиентом в заголовке traceparent
 func (router *Router) logRequest(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		/*
@@ -44,14 +92,55 @@ func (router *Router) logRequest(next http.Handler) http.Handler {
 				r.RequestURI)*/
 
 		start := time.Now()
+
+		// маршрут в виде шаблона, чтобы по нему можно было группировать запросы
+		route := r.URL.Path
+		if current := mux.CurrentRoute(r); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+
+		requestID, _ := r.Context().Value(ctxKeyRequestID).(string)
+
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracer.Start(ctx, r.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(semconv.HTTPServerAttributesFromHTTPRequest("", route, r)...),
+			trace.WithAttributes(attribute.String("http.request_id", requestID)))
+		defer span.End()
+
+		// журнал с полями запроса доступен обработчикам через Logger
+		requestFields := logger.Fields{
+			"request_id":  requestID,
+			"remote_addr": r.RemoteAddr,
+			"method":      r.Method,
+			"route":       route,
+		}
+		if spanContext := span.SpanContext(); spanContext.IsValid() {
+			requestFields["trace_id"] = spanContext.TraceID().String()
+		}
+		requestLogger := router.logger.WithFields(requestFields)
+
 		rw := &responseWriterEx{
 			ResponseWriter: w,
 			code:           http.StatusOK,
 			err:            nil,
+			userID:         0,
 		}
 
 		// вызываем обработчик нижнего уровня
-		next.ServeHTTP(rw, r)
+		next.ServeHTTP(rw, r.WithContext(logger.NewContext(ctx, requestLogger)))
+
+		span.SetAttributes(semconv.HTTPStatusCodeKey.Int(rw.code))
+		if rw.userID != 0 {
+			span.SetAttributes(semconv.EnduserIDKey.String(strconv.FormatUint(rw.userID, 10)))
+		}
+		spanStatus, spanMessage := semconv.SpanStatusFromHTTPStatusCodeAndSpanKind(rw.code, trace.SpanKindServer)
+		if rw.err != nil {
+			spanMessage = rw.err.Error()
+		}
+		span.SetStatus(spanStatus, spanMessage)
 
 		// выводим в журнал результат
 		var level logger.MessageLevel
@@ -64,22 +153,153 @@ func (router *Router) logRequest(next http.Handler) http.Handler {
 			level = logger.InfoLevel
 		}
 
-		var errorText string
-		if rw.err != nil {
-			errorText = rw.err.Error()
-			errorText = strings.ReplaceAll(errorText, `"`, "")
-		} else {
-			errorText = "-"
+		if level == logger.ErrorLevel || level == logger.WarnLevel {
+			fields := logger.Fields{
+				"status":     rw.code,
+				"latency_ms": float64(time.Since(start).Microseconds()) / 1000,
+			}
+			if rw.userID != 0 {
+				fields["user_id"] = rw.userID
+			}
+			if rw.err != nil {
+				fields["error"] = rw.err.Error()
+			}
+
+			requestLogger.WithFields(fields).Level(level, "completed with %d %s", rw.code, http.StatusText(rw.code))
 		}
+	})
+}
 
-		if level == logger.ErrorLevel || level == logger.WarnLevel {
-			router.logger.Level(level, "addr: %s, completed with %d %s in %v, info: %s",
-				r.RemoteAddr,
-				// r.Context().Value(ctxKeyRequestID),
-				rw.code,
-				http.StatusText(rw.code),
-				time.Since(start),
-				errorText)
+// Распаковка тела запроса в соответствии с заголовком Content-Encoding и ограничение его размера.
+// Ограничивается как размер тела в том виде, в котором оно пришло, так и размер после распаковки
+func (router *Router) decodeRequestBody(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Body == nil || r.Body == http.NoBody {
+			next.ServeHTTP(w, r)
+
+			return
+		}
+
+		body := &limitedReadCloser{
+			ReadCloser: r.Body,
+			left:       router.maxRequestSize,
 		}
+
+		encoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding")))
+		if encoding == "" || encoding == "identity" {
+			r.Body = body
+			next.ServeHTTP(w, r)
+
+			return
+		}
+
+		decoded, err := decompressReader(encoding, body, router.maxDecompressedRequestSize)
+		if err != nil {
+			switch {
+			case errors.Is(err, errUnsupportedContentEncoding):
+				router.RespondError(w, http.StatusUnsupportedMediaType, err)
+			case errors.Is(err, handler.ErrRequestTooLarge):
+				router.RespondError(w, http.StatusRequestEntityTooLarge, err)
+			default:
+				router.RespondError(w, http.StatusBadRequest, err)
+			}
+
+			return
+		}
+
+		r.Body = &limitedReadCloser{
+			ReadCloser: decoded,
+			left:       router.maxDecompressedRequestSize,
+		}
+		// обработчики получают уже распакованные данные
+		r.Header.Del("Content-Encoding")
+		r.ContentLength = -1
+
+		next.ServeHTTP(w, r)
 	})
 }
+
+// Создание распаковщика для заданного Content-Encoding. maxSize - ограничение размера после распаковки
+func decompressReader(encoding string, body io.ReadCloser, maxSize int64) (io.ReadCloser, error) {
+	switch encoding {
+	case "gzip", "x-gzip":
+		return gzip.NewReader(body)
+	case "deflate":
+		// по стандарту deflate в HTTP - это поток zlib, но многие клиенты присылают "сырой" deflate
+		br := bufio.NewReader(body)
+		header, err := br.Peek(2)
+		if err != nil {
+			return nil, err
+		}
+
+		if header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+			return zlib.NewReader(br)
+		}
+
+		return flate.NewReader(br), nil
+	case "zstd":
+		// окно zstd задается отправителем, и без ограничения распаковщик выделит под него до 512 МБ еще до того,
+		// как сработает ограничение размера. Поэтому и память, и окно ограничиваются размером после распаковки
+		window := uint64(maxSize)
+		if window < zstd.MinWindowSize {
+			window = zstd.MinWindowSize
+		}
+		if window > zstd.MaxWindowSize {
+			window = zstd.MaxWindowSize
+		}
+
+		dec, err := zstd.NewReader(body,
+			zstd.WithDecoderConcurrency(1),
+			zstd.WithDecoderMaxMemory(uint64(maxSize)),
+			zstd.WithDecoderMaxWindow(window),
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		return &zstdReadCloser{ReadCloser: dec.IOReadCloser()}, nil
+	default:
+		return nil, errUnsupportedContentEncoding
+	}
+}
+
+// Распаковщик zstd, превышение ограничений которого считается слишком большим запросом
+type zstdReadCloser struct {
+	io.ReadCloser
+}
+
+func (z *zstdReadCloser) Read(p []byte) (int, error) {
+	n, err := z.ReadCloser.Read(p)
+	if errors.Is(err, zstd.ErrDecoderSizeExceeded) || errors.Is(err, zstd.ErrWindowSizeExceeded) {
+		return n, handler.ErrRequestTooLarge
+	}
+
+	return n, err
+}
+
+// Реализует io.ReadCloser с ограничением на общий объем прочитанных данных
+type limitedReadCloser struct {
+	io.ReadCloser
+	left int64
+}
+
+func (l *limitedReadCloser) Read(p []byte) (int, error) {
+	if l.left <= 0 {
+		// проверяем, что данные действительно закончились, а не ровно совпали с ограничением
+		var b [1]byte
+		if n, _ := l.ReadCloser.Read(b[:]); n > 0 {
+			return 0, handler.ErrRequestTooLarge
+		}
+
+		return 0, io.EOF
+	}
+
+	if int64(len(p)) > l.left {
+		p = p[:l.left]
+	}
+
+	n, err := l.ReadCloser.Read(p)
+	l.left -= int64(n)
+
+	return n, err
+}
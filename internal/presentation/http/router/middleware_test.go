@@ -0,0 +1,64 @@
+package router
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/n-r-w/log-server-v2/internal/presentation/http/handler"
+)
+
+func zstdCompress(t *testing.T, data []byte, window int) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	enc, err := zstd.NewWriter(&buf, zstd.WithWindowSize(window))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = enc.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err = enc.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestDecompressZstd(t *testing.T) {
+	const maxSize = 64 << 10
+
+	data := bytes.Repeat([]byte("log record\n"), 1000)
+	r, err := decompressReader("zstd", io.NopCloser(bytes.NewReader(zstdCompress(t, data, 1<<20))), maxSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	decoded, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decoded, data) {
+		t.Fatal("decoded data differs")
+	}
+}
+
+// Окно и размер после распаковки больше ограничения: распаковщик не должен выделять под них память
+func TestDecompressZstdTooLarge(t *testing.T) {
+	const maxSize = 64 << 10
+
+	data := make([]byte, 8<<20)
+	r, err := decompressReader("zstd", io.NopCloser(bytes.NewReader(zstdCompress(t, data, 8<<20))), maxSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	if _, err = io.ReadAll(r); !errors.Is(err, handler.ErrRequestTooLarge) {
+		t.Fatalf("expected %v, got %v", handler.ErrRequestTooLarge, err)
+	}
+}
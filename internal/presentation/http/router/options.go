@@ -0,0 +1,77 @@
+package router
+
+import (
+	"net/http"
+	"strings"
+)
+
+type Option func(*Router)
+
+// CookieSecure Передавать куки сессии только по HTTPS
+func CookieSecure(secure bool) Option {
+	return func(r *Router) {
+		r.cookieSecure = secure
+	}
+}
+
+// CookieHTTPOnly Запретить доступ к кукам сессии из JavaScript
+func CookieHTTPOnly(httpOnly bool) Option {
+	return func(r *Router) {
+		r.cookieHTTPOnly = httpOnly
+	}
+}
+
+// CookieSameSite Режим SameSite для кук сессии: lax, strict, none. Пустая строка - не задавать
+func CookieSameSite(mode string) Option {
+	return func(r *Router) {
+		switch strings.ToLower(mode) {
+		case "lax":
+			r.cookieSameSite = http.SameSiteLaxMode
+		case "strict":
+			r.cookieSameSite = http.SameSiteStrictMode
+		case "none":
+			r.cookieSameSite = http.SameSiteNoneMode
+		default:
+			r.cookieSameSite = http.SameSiteDefaultMode
+		}
+	}
+}
+
+// PreviousSessionKeys Предыдущие ключи кук сессии. Куки и CSRF токены, подписанные ими, продолжают приниматься,
+// поэтому ключ можно сменить, не завершая сессии пользователей. Новые куки подписываются только текущим ключом
+func PreviousSessionKeys(keys []string) Option {
+	return func(r *Router) {
+		for _, key := range keys {
+			r.sessionKeys = append(r.sessionKeys, []byte(key))
+		}
+	}
+}
+
+// CSRFProtection Требовать CSRF токен для изменяющих запросов, аутентифицированных через куки сессии
+func CSRFProtection(enabled bool) Option {
+	return func(r *Router) {
+		r.csrfProtection = enabled
+	}
+}
+
+// CORSAllowedOrigins Домены, с которых разрешены запросы к серверу. "*" - с любых доменов
+func CORSAllowedOrigins(origins []string) Option {
+	return func(r *Router) {
+		r.corsAllowedOrigins = origins
+	}
+}
+
+// CORSAllowCredentials Разрешить браузеру передавать куки в запросах с других доменов
+func CORSAllowCredentials(allow bool) Option {
+	return func(r *Router) {
+		r.corsAllowCredentials = allow
+	}
+}
+
+// ClientCertificateLogin Поле проверенного сертификата клиента, которое используется как логин пользователя:
+// cn, email, dns или subject. Пустая строка - аутентификация по сертификату выключена
+func ClientCertificateLogin(field string) Option {
+	return func(r *Router) {
+		r.clientCertField = strings.ToLower(field)
+	}
+}
@@ -5,17 +5,16 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
-	"strings"
 
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
 	"github.com/gorilla/sessions"
+	"github.com/n-r-w/log-server-v2/internal/domain/entity"
 	"github.com/n-r-w/log-server-v2/internal/presentation/http/handler"
 	"github.com/n-r-w/log-server-v2/internal/presentation/http/handler/rest"
 	"github.com/n-r-w/log-server-v2/pkg/logger"
-	"github.com/n-r-w/log-server-v2/pkg/tools"
-	"golang.org/x/exp/slices"
 )
 
 // Тип для описания ключевых значений параметров, добавляемых в контекст запроса
@@ -25,8 +24,8 @@ type contextKey string
 const (
 	// Ключ для хранения информации о сессии со стороны пользователя
 	sessionName = "logserver"
-	// Ключ для хранения id пользователя в сессии (в куках)
-	userIDKeyName = "user_id"
+	// Ключ для хранения токена сессии в куках. Сама сессия хранится на сервере
+	sessionTokenKeyName = "session_token"
 	// Ключ для хранения номера сессии в контексте запроса
 	ctxKeyRequestID = contextKey("request-id")
 )
@@ -37,37 +36,111 @@ type Router struct {
 	sessionStore sessions.Store // Управление сессиями пользователей
 	logger       logger.Interface
 	user         handler.UserInterface
+	session      handler.SessionInterface
 	log          handler.LogInterface
+	audit        handler.AuditInterface
+	twoFactor    handler.TwoFactorInterface
+	health       handler.HealthInterface
 
+	// Максимальный размер тела запроса в том виде, в котором он пришел от клиента
+	maxRequestSize int64
+	// Максимальный размер тела запроса после распаковки
+	maxDecompressedRequestSize int64
+
+	// Атрибуты кук сессии
+	cookieSecure   bool
+	cookieHTTPOnly bool
+	cookieSameSite http.SameSite
+
+	// Ключи подписи кук сессии. Первый - текущий, остальные - предыдущие, которые еще принимаются
+	// после смены ключа. CSRF токены вычисляются на тех же ключах
+	sessionKeys [][]byte
+
+	// Защита от CSRF
+	csrfProtection bool
+
+	corsAllowedOrigins   []string
+	corsAllowCredentials bool
+
+	// Поле сертификата клиента с логином пользователя. Пустая строка - аутентификация по сертификату выключена
+	clientCertField string
+
+	handler    http.Handler
 	subrouters map[string]*mux.Router
 }
 
-func NewRouter(logger logger.Interface, user handler.UserInterface, log handler.LogInterface, sessionEncriptionKey string, superAdminID uint64, sessionAge int, maxLogRecordsResult int) *Router {
+func NewRouter(logger logger.Interface, user handler.UserInterface, session handler.SessionInterface, log handler.LogInterface, audit handler.AuditInterface,
+	twoFactor handler.TwoFactorInterface, health handler.HealthInterface, sessionEncriptionKey string, sessionAge int, maxLogRecordsResult int,
+	maxRequestSize int, maxDecompressedRequestSize int, opts ...Option) *Router {
 	r := &Router{
-		mux:          mux.NewRouter(),
-		sessionStore: sessions.NewCookieStore([]byte(sessionEncriptionKey)),
-		logger:       logger,
-		user:         user,
-		log:          log,
-		subrouters:   make(map[string]*mux.Router),
+		mux:                        mux.NewRouter(),
+		sessionStore:               nil,
+		logger:                     logger,
+		user:                       user,
+		session:                    session,
+		log:                        log,
+		audit:                      audit,
+		twoFactor:                  twoFactor,
+		health:                     health,
+		maxRequestSize:             int64(maxRequestSize),
+		maxDecompressedRequestSize: int64(maxDecompressedRequestSize),
+		cookieSecure:               false,
+		cookieHTTPOnly:             true,
+		cookieSameSite:             http.SameSiteLaxMode,
+		sessionKeys:                [][]byte{[]byte(sessionEncriptionKey)},
+		csrfProtection:             false,
+		corsAllowedOrigins:         []string{"*"},
+		corsAllowCredentials:       false,
+		clientCertField:            "",
+		handler:                    nil,
+		subrouters:                 make(map[string]*mux.Router),
+	}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	// куки подписываются текущим ключом, а проверяются всеми по очереди
+	keyPairs := make([][]byte, 0, len(r.sessionKeys)*2)
+	for _, key := range r.sessionKeys {
+		keyPairs = append(keyPairs, key, nil)
 	}
+	r.sessionStore = sessions.NewCookieStore(keyPairs...)
 
 	// подмешивание номера сессии
 	r.mux.Use(r.setRequestID)
-	// журналирование запросов
+	// журналирование и трассировка запросов
 	r.mux.Use(r.logRequest)
-
-	// разрешаем запросы к серверу c любых доменов (cross-origin resource sharing)
-	r.mux.Use(handlers.CORS(handlers.AllowedOrigins([]string{"*"})))
+	// распаковка тела запроса
+	r.mux.Use(r.decodeRequestBody)
 
 	// создаем маршруты для rest
-	rest.InitRoutes(r, user, log, superAdminID, sessionAge, maxLogRecordsResult)
+	rest.InitRoutes(r, user, session, log, audit, twoFactor, health, sessionAge, maxLogRecordsResult)
+
+	// разрешаем запросы к серверу c заданных доменов (cross-origin resource sharing).
+	// CORS оборачивает весь роутер, т.к. middleware роутера не вызываются для предварительных OPTIONS запросов
+	r.handler = handlers.CORS(r.corsOptions()...)(r.mux)
 
 	return r
 }
 
 func (router *Router) Handler() http.Handler {
-	return router.mux
+	return router.handler
+}
+
+func (router *Router) corsOptions() []handlers.CORSOption {
+	opts := []handlers.CORSOption{
+		handlers.AllowedOrigins(router.corsAllowedOrigins),
+		handlers.AllowedMethods([]string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodDelete}),
+		handlers.AllowedHeaders([]string{"Authorization", "Content-Type", "Content-Encoding", csrfHeaderName, rest.BinaryFormatHeaderName}),
+		handlers.ExposedHeaders([]string{"X-Request-ID", csrfHeaderName, rest.BinaryFormatHeaderName, rest.NextCursorHeaderName}),
+	}
+
+	if router.corsAllowCredentials {
+		opts = append(opts, handlers.AllowCredentials())
+	}
+
+	return opts
 }
 
 // RespondError Ответ с ошибкой
@@ -98,6 +171,8 @@ func (router *Router) RespondData(w http.ResponseWriter, code int, data interfac
 			_, _ = rw.Write([]byte(d))
 
 			rw.Header().Add("Content-Type", "application/octet-stream")
+		case []byte:
+			_, _ = rw.Write(d)
 		default:
 			if err := json.NewEncoder(rw).Encode(data); err != nil {
 				rw.WriteHeader(http.StatusInternalServerError)
@@ -121,55 +196,38 @@ func (router *Router) RespondCompressed(w http.ResponseWriter, r *http.Request,
 		return
 	}
 
-	// проверяем хочет ли клиент сжатие
-	compressionType := handler.CompressionNo
+	// проверяем хочет ли клиент сжатие и какое
+	compressionType, encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"), ctype)
 
-	accepted := strings.Split(r.Header.Get("Accept-Encoding"), ",")
-	if slices.Contains(accepted, "gzip") && ctype == handler.CompressionGzip {
-		compressionType = handler.CompressionGzip
-	} else if slices.Contains(accepted, "deflate") && ctype == handler.CompressionDeflate {
-		compressionType = handler.CompressionDeflate
+	if ct := contentType(data); ct != "" {
+		w.Header().Set("Content-Type", ct)
+	}
+	w.Header().Add("Vary", "Accept-Encoding")
+	if compressionType != handler.CompressionNo {
+		w.Header().Set("Content-Encoding", encoding)
 	}
 
-	if compressionType == handler.CompressionNo {
-		router.RespondData(w, code, data)
+	compressor, err := newCompressor(compressionType, w)
+	if err != nil {
+		w.Header().Del("Content-Encoding")
+		router.RespondError(w, http.StatusInternalServerError, err)
 
 		return
 	}
 
-	// заполняем буфер для сжатия
-	var sourceData []byte
-	switch d := data.(type) {
-	case string:
-	case []byte:
-		sourceData = []byte(d)
-	default:
-		var errJSON error
-		sourceData, errJSON = json.Marshal(data)
-
-		if errJSON != nil {
-			router.RespondError(w, http.StatusInternalServerError, errJSON)
-		}
-
-		w.Header().Set("Content-Type", "application/json")
-	}
+	w.WriteHeader(code)
 
-	if compressionType == handler.CompressionGzip {
-		w.Header().Set("Content-Encoding", "gzip")
-	} else {
-		w.Header().Set("Content-Encoding", "deflate")
+	// после начала передачи код ответа изменить уже нельзя, поэтому ошибки только журналируются
+	if err = writeStream(compressor, data); err == nil {
+		err = compressor.Close()
 	}
 
-	compressedData, err := tools.CompressData(compressionType == handler.CompressionDeflate, sourceData)
-
 	if err != nil {
-		router.RespondError(w, http.StatusInternalServerError, err)
-
-		return
+		if rw, ok := w.(*responseWriterEx); ok {
+			rw.err = err
+		}
+		router.Logger(r).Error("response stream error: %v", err)
 	}
-
-	w.WriteHeader(code)
-	_, _ = w.Write(compressedData)
 }
 
 // AddRoute ...
@@ -188,6 +246,7 @@ func (router *Router) AddRoute(subroute string, route string, handler http.Handl
 func (router *Router) AddMiddleware(subroute string, mwf ...handler.MiddlewareFunc) {
 	funcs := make([]mux.MiddlewareFunc, len(mwf))
 	for i, f := range mwf {
+		f := f // иначе все замыкания получат последний элемент mwf
 		funcs[i] = func(h http.Handler) http.Handler { return f(h) }
 	}
 
@@ -200,48 +259,57 @@ func (router *Router) AddMiddleware(subroute string, mwf ...handler.MiddlewareFu
 
 // StartSession ...
 func (router *Router) StartSession(w http.ResponseWriter, r *http.Request, userID uint64, sessionAge int) error {
+	// создаем сессию на сервере
+	token, err := router.session.Start(r.Context(), userID, sessionAge, router.RequestInfo(r).Address, r.UserAgent())
+	if err != nil {
+		return err
+	}
+
 	// получаем сесиию
 	session, err := router.sessionStore.New(r, sessionName)
 	if err != nil {
 		return err
 	}
 
-	// записываем информацию о том, что пользователь с таким ID залогинился
-	session.Values[userIDKeyName] = userID
+	// в куках хранится только токен сессии
+	session.Values[sessionTokenKeyName] = token
 	session.Options = &sessions.Options{
-		Path:   "/",
-		Domain: "",
-		MaxAge: int(sessionAge),
-		Secure: false,
-		// HttpOnly: true, // прячем содержимое сессии от доступа через JavaSript в браузере
-		HttpOnly: false,
-		SameSite: 0,
+		Path:     "/",
+		Domain:   "",
+		MaxAge:   int(sessionAge),
+		Secure:   router.cookieSecure,
+		HttpOnly: router.cookieHTTPOnly, // прячем содержимое сессии от доступа через JavaSript в браузере
+		SameSite: router.cookieSameSite,
+	}
+
+	// CSRF токен для новой сессии
+	if router.csrfProtection {
+		w.Header().Set(csrfHeaderName, router.csrfTokenFor(router.sessionKeys[0], token))
 	}
 
 	return router.sessionStore.Save(r, w, session)
 }
 
 func (router *Router) CheckSession(r *http.Request) (userID uint64, err error) {
-	// извлекаем из запроса пользователя куки с информацией о сессии
-	session, err := router.sessionStore.Get(r, sessionName)
+	token, err := router.sessionToken(r)
 	if err != nil {
 		return 0, err
 	}
 
-	// ищем в информацию о пользователе в сессиях
-	ID, ok := session.Values[userIDKeyName]
-	if !ok || session.Options.MaxAge < 0 {
-		return 0, errors.New("unauthorized")
+	// проверяем, что сессия есть на сервере и она не истекла
+	session, err := router.session.Check(r.Context(), token)
+	if err != nil {
+		return 0, err
 	}
 
-	return ID.(uint64), nil
+	return session.UserID, nil
 }
 
 func (router *Router) CloseSession(w http.ResponseWriter, r *http.Request) {
 	// получаем сесиию
 	session, err := router.sessionStore.Get(r, sessionName)
 	if err != nil {
-		router.logger.Error("session store get error %v", err)
+		router.Logger(r).Error("session store get error %v", err)
 
 		return
 	}
@@ -249,12 +317,35 @@ func (router *Router) CloseSession(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// удаляем из нее данные о логине
-	delete(session.Values, userIDKeyName)
-	// сохраняем
+	// завершаем сессию на сервере
+	if token, ok := session.Values[sessionTokenKeyName].(string); ok {
+		if err := router.session.Close(r.Context(), token, router.RequestInfo(r)); err != nil {
+			router.Logger(r).Error("session close error %v", err)
+		}
+	}
+
+	// удаляем куки
+	delete(session.Values, sessionTokenKeyName)
+	session.Options.MaxAge = -1
 	if err := router.sessionStore.Save(r, w, session); err != nil {
-		router.logger.Error("session save error")
+		router.Logger(r).Error("session save error: %v", err)
+	}
+}
+
+// sessionToken Токен сессии из куков запроса
+func (router *Router) sessionToken(r *http.Request) (string, error) {
+	// извлекаем из запроса пользователя куки с информацией о сессии
+	session, err := router.sessionStore.Get(r, sessionName)
+	if err != nil {
+		return "", err
+	}
+
+	token, ok := session.Values[sessionTokenKeyName].(string)
+	if !ok || token == "" {
+		return "", errors.New("unauthorized")
 	}
+
+	return token, nil
 }
 
 func (router *Router) getSubrouter(path string) *mux.Router {
@@ -266,3 +357,60 @@ func (router *Router) getSubrouter(path string) *mux.Router {
 
 	return sr
 }
+
+// RequestInfo ...
+func (router *Router) RequestInfo(r *http.Request) entity.RequestInfo {
+	address, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		address = r.RemoteAddr
+	}
+
+	requestID, _ := r.Context().Value(ctxKeyRequestID).(string)
+
+	return entity.RequestInfo{
+		Address:   address,
+		RequestID: requestID,
+	}
+}
+
+// Logger Журнал с полями запроса: request_id, remote_addr, method, route, а после аутентификации и user_id
+func (router *Router) Logger(r *http.Request) logger.Interface {
+	return logger.FromContext(r.Context(), router.logger)
+}
+
+// SetRequestUser Запомнить пользователя, выполняющего запрос, для журнала. Возвращает запрос,
+// журнал которого содержит поле user_id
+func (router *Router) SetRequestUser(w http.ResponseWriter, r *http.Request, userID uint64) *http.Request {
+	if rw, ok := w.(*responseWriterEx); ok {
+		rw.userID = userID
+	}
+
+	return r.WithContext(logger.NewContext(r.Context(), router.Logger(r).WithFields(logger.Fields{"user_id": userID})))
+}
+
+// ClientCertificateLogin Логин пользователя из сертификата клиента. Учитываются только сертификаты,
+// проверенные http сервером по CA
+func (router *Router) ClientCertificateLogin(r *http.Request) string {
+	if router.clientCertField == "" || r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.PeerCertificates) == 0 {
+		return ""
+	}
+
+	cert := r.TLS.PeerCertificates[0]
+
+	switch router.clientCertField {
+	case "cn":
+		return cert.Subject.CommonName
+	case "email":
+		if len(cert.EmailAddresses) > 0 {
+			return cert.EmailAddresses[0]
+		}
+	case "dns":
+		if len(cert.DNSNames) > 0 {
+			return cert.DNSNames[0]
+		}
+	case "subject":
+		return cert.Subject.String()
+	}
+
+	return ""
+}
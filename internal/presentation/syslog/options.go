@@ -0,0 +1,44 @@
+package syslog
+
+import "time"
+
+type Option func(*Server)
+
+// UDPAddress Адрес для приема сообщений по UDP. Пустая строка - не принимать
+func UDPAddress(address string) Option {
+	return func(s *Server) {
+		s.udpAddress = address
+	}
+}
+
+// TCPAddress Адрес для приема сообщений по TCP. Пустая строка - не принимать
+func TCPAddress(address string) Option {
+	return func(s *Server) {
+		s.tcpAddress = address
+	}
+}
+
+func MaxMessageSize(size int) Option {
+	return func(s *Server) {
+		s.maxMessageSize = size
+	}
+}
+
+func BatchSize(size int) Option {
+	return func(s *Server) {
+		s.batchSize = size
+	}
+}
+
+func FlushInterval(interval time.Duration) Option {
+	return func(s *Server) {
+		s.flushInterval = interval
+	}
+}
+
+// IdleTimeout Время, после которого закрывается TCP соединение без сообщений. 0 - не закрывать
+func IdleTimeout(timeout time.Duration) Option {
+	return func(s *Server) {
+		s.idleTimeout = timeout
+	}
+}
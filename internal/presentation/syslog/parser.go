@@ -0,0 +1,282 @@
+package syslog
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/n-r-w/log-server-v2/internal/domain/entity"
+)
+
+const (
+	// Значение NILVALUE из RFC 5424
+	nilValue = "-"
+	// Максимальное значение PRI (facility 23, severity 7)
+	maxPriority = 191
+)
+
+var (
+	errEmptyMessage    = errors.New("empty syslog message")
+	errInvalidPriority = errors.New("invalid syslog priority")
+	errInvalidHeader   = errors.New("invalid syslog header")
+)
+
+// message Разобранное сообщение syslog. Facility и PROCID в журнале не хранятся и не разбираются
+type message struct {
+	severity       int
+	timestamp      time.Time
+	hostname       string
+	appName        string
+	msgID          string
+	structuredData string
+	text           string
+}
+
+// parse Разбор сообщения в формате RFC 5424 или RFC 3164. Формат определяется автоматически.
+// now нужно для определения года во времени RFC 3164, где год не указывается
+func parse(data []byte, now time.Time) (*message, error) {
+	s := strings.TrimRight(string(data), "\r\n\x00")
+	if len(s) == 0 {
+		return nil, errEmptyMessage
+	}
+
+	priority, rest, err := parsePriority(s)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &message{
+		severity:       priority % 8,
+		timestamp:      time.Time{},
+		hostname:       "",
+		appName:        "",
+		msgID:          "",
+		structuredData: "",
+		text:           "",
+	}
+
+	// RFC 5424 сразу после PRI содержит версию протокола
+	if strings.HasPrefix(rest, "1 ") {
+		err = m.parse5424(rest[2:])
+	} else {
+		m.parse3164(rest, now)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// parsePriority Разбор PRI части: <N>
+func parsePriority(s string) (priority int, rest string, err error) {
+	if s[0] != '<' {
+		return 0, "", errInvalidPriority
+	}
+
+	end := strings.IndexByte(s, '>')
+	if end < 2 || end > 4 {
+		return 0, "", errInvalidPriority
+	}
+
+	priority, err = strconv.Atoi(s[1:end])
+	if err != nil || priority < 0 || priority > maxPriority {
+		return 0, "", errInvalidPriority
+	}
+
+	return priority, s[end+1:], nil
+}
+
+// parse5424 Разбор заголовка RFC 5424: TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA [MSG]
+func (m *message) parse5424(s string) error {
+	fields := make([]string, 0, 5)
+	for i := 0; i < 5; i++ {
+		var field string
+		field, s = nextField(s)
+		if field == "" {
+			return errInvalidHeader
+		}
+		fields = append(fields, field)
+	}
+
+	if fields[0] != nilValue {
+		t, err := time.Parse(time.RFC3339Nano, fields[0])
+		if err != nil {
+			return errInvalidHeader
+		}
+		m.timestamp = t
+	}
+
+	m.hostname = nilToEmpty(fields[1])
+	m.appName = nilToEmpty(fields[2])
+	m.msgID = nilToEmpty(fields[4])
+
+	if strings.HasPrefix(s, nilValue) {
+		s = s[len(nilValue):]
+	} else {
+		sd, rest, err := splitStructuredData(s)
+		if err != nil {
+			return err
+		}
+		m.structuredData = sd
+		s = rest
+	}
+
+	s = strings.TrimPrefix(s, " ")
+	// MSG может начинаться с BOM, если он в UTF-8
+	m.text = strings.TrimPrefix(s, "\ufeff")
+
+	return nil
+}
+
+// parse3164 Разбор заголовка RFC 3164: Mmm dd hh:mm:ss HOSTNAME TAG[PID]: MSG
+// Формат не строгий, поэтому все, что не удалось разобрать, попадает в текст сообщения
+func (m *message) parse3164(s string, now time.Time) {
+	const stampLen = len(time.Stamp)
+
+	if len(s) > stampLen && s[stampLen] == ' ' {
+		if t, err := time.Parse(time.Stamp, s[:stampLen]); err == nil {
+			m.timestamp = time.Date(now.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.Local)
+			// сообщение, отправленное в конце декабря, может прийти уже в январе
+			if m.timestamp.After(now.Add(24 * time.Hour)) {
+				m.timestamp = m.timestamp.AddDate(-1, 0, 0)
+			}
+			s = s[stampLen+1:]
+
+			// после времени идет имя хоста
+			host, rest := nextField(s)
+			if host != "" && !strings.ContainsAny(host, ":[") {
+				m.hostname = host
+				s = rest
+			}
+		}
+	}
+
+	// TAG - последовательность алфавитно-цифровых символов, за которой может идти [PID] и двоеточие
+	tagEnd := strings.IndexAny(s, ":[ ")
+	if tagEnd > 0 && tagEnd <= 48 {
+		tag := s[:tagEnd]
+		rest := s[tagEnd:]
+
+		if rest[0] == '[' {
+			if pidEnd := strings.IndexByte(rest, ']'); pidEnd > 0 {
+				rest = rest[pidEnd+1:]
+			}
+		}
+
+		if strings.HasPrefix(rest, ":") {
+			m.appName = tag
+			s = strings.TrimPrefix(rest[1:], " ")
+		}
+	}
+
+	m.text = s
+}
+
+// record Преобразование в запись журнала. Если в сообщении нет времени, используется время получения
+func (m *message) record(receiveTime time.Time, remoteHost string) entity.LogRecord {
+	logTime := m.timestamp
+	if logTime.IsZero() {
+		logTime = receiveTime
+	}
+
+	host := m.hostname
+	if host == "" {
+		host = remoteHost
+	}
+
+	text := m.text
+	if text == "" {
+		// пустой текст запрещен валидацией записи
+		text = nilValue
+	}
+
+	return entity.LogRecord{
+		LogTime:  logTime,
+		Level:    severityToLevel(m.severity),
+		Host:     host,
+		Source:   m.appName,
+		Message1: text,
+		Message2: m.msgID,
+		Message3: m.structuredData,
+	}
+}
+
+// severityToLevel Преобразование уровня syslog (0 - emergency ... 7 - debug) в уровень журнала
+func severityToLevel(severity int) int {
+	switch {
+	case severity <= 2: // emergency, alert, critical
+		return entity.LevelFatal
+	case severity == 3: // error
+		return entity.LevelError
+	case severity == 4: // warning
+		return entity.LevelWarn
+	case severity <= 6: // notice, informational
+		return entity.LevelInfo
+	default: // debug
+		return entity.LevelDebug
+	}
+}
+
+// nextField Выделение очередного поля до пробела
+func nextField(s string) (field string, rest string) {
+	s = strings.TrimLeft(s, " ")
+	if i := strings.IndexByte(s, ' '); i >= 0 {
+		return s[:i], s[i+1:]
+	}
+
+	return s, ""
+}
+
+// splitStructuredData Выделение блока STRUCTURED-DATA: один или несколько элементов [...]
+// Внутри значений параметров символы ']', '"' и '\' экранируются обратным слэшем
+func splitStructuredData(s string) (sd string, rest string, err error) {
+	i := 0
+	for i < len(s) && s[i] == '[' {
+		inQuotes := false
+		closed := false
+
+		for i++; i < len(s); i++ {
+			c := s[i]
+			if inQuotes {
+				switch c {
+				case '\\':
+					i++
+				case '"':
+					inQuotes = false
+				}
+
+				continue
+			}
+
+			if c == '"' {
+				inQuotes = true
+			} else if c == ']' {
+				closed = true
+				i++
+
+				break
+			}
+		}
+
+		if !closed {
+			return "", "", errInvalidHeader
+		}
+	}
+
+	if i == 0 {
+		return "", "", errInvalidHeader
+	}
+
+	return s[:i], s[i:], nil
+}
+
+func nilToEmpty(s string) string {
+	if s == nilValue {
+		return ""
+	}
+
+	return s
+}
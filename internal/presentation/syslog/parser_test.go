@@ -0,0 +1,163 @@
+package syslog
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/n-r-w/log-server-v2/internal/domain/entity"
+)
+
+func TestParse(t *testing.T) {
+	receiveTime := time.Date(2023, 10, 11, 22, 14, 20, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		input    string
+		expected entity.LogRecord
+	}{
+		{
+			name:  "rfc 5424",
+			input: "<34>1 2023-10-11T22:14:15.003Z mymachine.example.com su - ID47 - 'su root' failed for lonvick on /dev/pts/8",
+			expected: entity.LogRecord{
+				LogTime:  time.Date(2023, 10, 11, 22, 14, 15, 3000000, time.UTC),
+				Level:    entity.LevelFatal,
+				Host:     "mymachine.example.com",
+				Source:   "su",
+				Message1: "'su root' failed for lonvick on /dev/pts/8",
+				Message2: "ID47",
+			},
+		},
+		{
+			name: "rfc 5424 structured data",
+			input: `<165>1 2023-10-11T22:14:15.000003-07:00 192.0.2.1 myproc 8710 - ` +
+				`[exampleSDID@32473 iut="3" eventSource="App\]lication"][examplePriority@32473 class="high"]` + " \ufeffAn application event",
+			expected: entity.LogRecord{
+				LogTime:  time.Date(2023, 10, 12, 5, 14, 15, 3000, time.UTC),
+				Level:    entity.LevelInfo,
+				Host:     "192.0.2.1",
+				Source:   "myproc",
+				Message1: "An application event",
+				Message3: `[exampleSDID@32473 iut="3" eventSource="App\]lication"][examplePriority@32473 class="high"]`,
+			},
+		},
+		{
+			name:  "rfc 5424 without timestamp and message",
+			input: "<15>1 - - app - - -",
+			expected: entity.LogRecord{
+				LogTime:  receiveTime,
+				Level:    entity.LevelDebug,
+				Host:     "10.0.0.1",
+				Source:   "app",
+				Message1: "-",
+			},
+		},
+		{
+			name:  "rfc 3164",
+			input: "<13>Oct 11 22:14:15 mymachine sshd[1234]: session opened",
+			expected: entity.LogRecord{
+				LogTime:  time.Date(2023, 10, 11, 22, 14, 15, 0, time.Local),
+				Level:    entity.LevelInfo,
+				Host:     "mymachine",
+				Source:   "sshd",
+				Message1: "session opened",
+			},
+		},
+		{
+			name:  "rfc 3164 previous year",
+			input: "<12>Dec 31 23:59:59 mymachine cron: job done",
+			expected: entity.LogRecord{
+				LogTime:  time.Date(2022, 12, 31, 23, 59, 59, 0, time.Local),
+				Level:    entity.LevelWarn,
+				Host:     "mymachine",
+				Source:   "cron",
+				Message1: "job done",
+			},
+		},
+		{
+			name:  "rfc 3164 without timestamp",
+			input: "<11>myapp: disk is full\n",
+			expected: entity.LogRecord{
+				LogTime:  receiveTime,
+				Level:    entity.LevelError,
+				Host:     "10.0.0.1",
+				Source:   "myapp",
+				Message1: "disk is full",
+			},
+		},
+		{
+			name:  "free text",
+			input: "<14>just some text",
+			expected: entity.LogRecord{
+				LogTime:  receiveTime,
+				Level:    entity.LevelInfo,
+				Host:     "10.0.0.1",
+				Message1: "just some text",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m, err := parse([]byte(test.input), receiveTime)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			r := m.record(receiveTime, "10.0.0.1")
+			e := test.expected
+			if !r.LogTime.Equal(e.LogTime) || r.Level != e.Level || r.Host != e.Host || r.Source != e.Source ||
+				r.Message1 != e.Message1 || r.Message2 != e.Message2 || r.Message3 != e.Message3 {
+				t.Fatalf("expected %+v, got %+v", e, r)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected error
+	}{
+		{name: "empty", input: "\r\n", expected: errEmptyMessage},
+		{name: "no priority", input: "Oct 11 22:14:15 host app: text", expected: errInvalidPriority},
+		{name: "unclosed priority", input: "<13 text", expected: errInvalidPriority},
+		{name: "empty priority", input: "<>text", expected: errInvalidPriority},
+		{name: "priority not a number", input: "<1a>text", expected: errInvalidPriority},
+		{name: "priority too large", input: "<192>text", expected: errInvalidPriority},
+		{name: "rfc 5424 short header", input: "<13>1 2023-10-11T22:14:15Z host", expected: errInvalidHeader},
+		{name: "rfc 5424 bad timestamp", input: "<13>1 yesterday host app - - - text", expected: errInvalidHeader},
+		{name: "rfc 5424 unclosed structured data", input: `<13>1 - host app - - [id a="b" text`, expected: errInvalidHeader},
+		{name: "rfc 5424 bad structured data", input: "<13>1 - host app - - text", expected: errInvalidHeader},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := parse([]byte(test.input), time.Now()); !errors.Is(err, test.expected) {
+				t.Fatalf("expected %v, got %v", test.expected, err)
+			}
+		})
+	}
+}
+
+func TestParseSeverity(t *testing.T) {
+	// emergency, alert, critical, error, warning, notice, informational, debug
+	expected := []int{
+		entity.LevelFatal, entity.LevelFatal, entity.LevelFatal, entity.LevelError,
+		entity.LevelWarn, entity.LevelInfo, entity.LevelInfo, entity.LevelDebug,
+	}
+
+	for severity, level := range expected {
+		// facility local0 (16) не влияет на уровень
+		m, err := parse([]byte("<"+strconv.Itoa(16*8+severity)+">1 - host app - - - text"), time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if r := m.record(time.Now(), ""); r.Level != level {
+			t.Fatalf("severity %d: expected level %d, got %d", severity, level, r.Level)
+		}
+	}
+}
@@ -0,0 +1,363 @@
+// Package syslog Прием журналов по протоколу syslog (RFC 5424 и RFC 3164) через UDP и TCP
+package syslog
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/n-r-w/log-server-v2/internal/domain/entity"
+	"github.com/n-r-w/log-server-v2/pkg/logger"
+)
+
+const (
+	defaultMaxMessageSize = 64 * 1024
+	defaultBatchSize      = 500
+	defaultFlushInterval  = 200 * time.Millisecond
+	defaultIdleTimeout    = 5 * time.Minute
+)
+
+var errInvalidFrameLength = errors.New("invalid syslog frame length")
+
+// LogInterface интерфейс, реализуемый юскейсом работы с логами
+type LogInterface interface {
+	Insert(ctx context.Context, logs []entity.LogRecord) error
+}
+
+// Server - прием сообщений syslog. Принятые сообщения накапливаются и пакетами передаются в LogInterface
+type Server struct {
+	log    LogInterface
+	logger logger.Interface
+
+	udpAddress     string
+	tcpAddress     string
+	maxMessageSize int
+	batchSize      int
+	flushInterval  time.Duration
+	idleTimeout    time.Duration
+
+	udpConn     net.PacketConn
+	tcpListener net.Listener
+
+	records chan entity.LogRecord
+	notify  chan error
+	done    chan struct{}
+
+	mu       sync.Mutex
+	tcpConns map[net.Conn]struct{}
+
+	wg      sync.WaitGroup
+	flushWg sync.WaitGroup
+}
+
+func New(log LogInterface, logger logger.Interface, opts ...Option) *Server {
+	s := &Server{
+		log:            log,
+		logger:         logger,
+		maxMessageSize: defaultMaxMessageSize,
+		batchSize:      defaultBatchSize,
+		flushInterval:  defaultFlushInterval,
+		idleTimeout:    defaultIdleTimeout,
+		notify:         make(chan error, 2),
+		done:           make(chan struct{}),
+		tcpConns:       make(map[net.Conn]struct{}),
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	s.records = make(chan entity.LogRecord, s.batchSize*2)
+
+	s.start()
+
+	return s
+}
+
+func (s *Server) start() {
+	s.flushWg.Add(1)
+	go s.flushLoop()
+
+	if s.udpAddress != "" {
+		conn, err := net.ListenPacket("udp", s.udpAddress)
+		if err != nil {
+			s.notifyError(err)
+		} else {
+			s.udpConn = conn
+			s.logger.Info("syslog udp started on %s", s.udpAddress)
+
+			s.wg.Add(1)
+			go s.serveUDP()
+		}
+	}
+
+	if s.tcpAddress != "" {
+		l, err := net.Listen("tcp", s.tcpAddress)
+		if err != nil {
+			s.notifyError(err)
+		} else {
+			s.tcpListener = l
+			s.logger.Info("syslog tcp started on %s", s.tcpAddress)
+
+			s.wg.Add(1)
+			go s.serveTCP()
+		}
+	}
+}
+
+// Notify Канал для получения ошибок запуска и работы сервера
+func (s *Server) Notify() <-chan error {
+	return s.notify
+}
+
+// Shutdown Остановка приема сообщений и запись накопленного буфера
+func (s *Server) Shutdown() {
+	close(s.done)
+
+	if s.udpConn != nil {
+		_ = s.udpConn.Close()
+	}
+
+	if s.tcpListener != nil {
+		_ = s.tcpListener.Close()
+	}
+
+	s.mu.Lock()
+	for c := range s.tcpConns {
+		_ = c.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+
+	close(s.records)
+	s.flushWg.Wait()
+}
+
+func (s *Server) serveUDP() {
+	defer s.wg.Done()
+
+	buf := make([]byte, s.maxMessageSize)
+	for {
+		n, addr, err := s.udpConn.ReadFrom(buf)
+		if err != nil {
+			if !s.stopped() {
+				s.notifyError(err)
+			}
+
+			return
+		}
+
+		s.handleMessage(buf[:n], addr)
+	}
+}
+
+func (s *Server) serveTCP() {
+	defer s.wg.Done()
+
+	for {
+		conn, err := s.tcpListener.Accept()
+		if err != nil {
+			if !s.stopped() {
+				s.notifyError(err)
+			}
+
+			return
+		}
+
+		s.mu.Lock()
+		s.tcpConns[conn] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go s.serveTCPConn(conn)
+	}
+}
+
+// serveTCPConn Чтение потока сообщений. Поддерживаются оба варианта разбиения из RFC 6587:
+// octet counting ("LEN MSG") и разделение символом перевода строки. Соединение, по которому
+// дольше idleTimeout не приходит ни одного сообщения, закрывается
+func (s *Server) serveTCPConn(conn net.Conn) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.tcpConns, conn)
+		s.mu.Unlock()
+
+		_ = conn.Close()
+		s.wg.Done()
+	}()
+
+	r := bufio.NewReaderSize(conn, s.maxMessageSize)
+	for {
+		if s.idleTimeout > 0 {
+			if err := conn.SetReadDeadline(time.Now().Add(s.idleTimeout)); err != nil {
+				return
+			}
+		}
+
+		data, err := s.readFrame(r)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				s.logger.Debug("syslog tcp %s: idle timeout", conn.RemoteAddr())
+
+				return
+			}
+
+			if !errors.Is(err, io.EOF) && !s.stopped() {
+				s.logger.Warn("syslog tcp %s: %v", conn.RemoteAddr(), err)
+			}
+
+			return
+		}
+
+		if len(data) > 0 {
+			s.handleMessage(data, conn.RemoteAddr())
+		}
+	}
+}
+
+// readFrame Чтение одного сообщения. Длина сообщения и ее запись ограничены maxMessageSize,
+// чтобы клиент не мог заставить сервер читать или выделять память без ограничений
+func (s *Server) readFrame(r *bufio.Reader) ([]byte, error) {
+	first, err := r.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+
+	if first[0] >= '1' && first[0] <= '9' {
+		size, err := s.readFrameLength(r)
+		if err != nil {
+			return nil, err
+		}
+
+		data := make([]byte, size)
+		if _, err = io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+
+		return data, nil
+	}
+
+	data, err := r.ReadSlice('\n')
+	if errors.Is(err, bufio.ErrBufferFull) {
+		return nil, errors.New("syslog message too long")
+	}
+	if err != nil && !(errors.Is(err, io.EOF) && len(data) > 0) {
+		return nil, err
+	}
+
+	return append([]byte(nil), data...), nil
+}
+
+// readFrameLength Длина сообщения в формате octet counting: цифры, за которыми следует пробел.
+// Цифр читается не больше, чем в записи maxMessageSize
+func (s *Server) readFrameLength(r *bufio.Reader) (int, error) {
+	maxDigits := len(strconv.Itoa(s.maxMessageSize))
+	size := 0
+
+	for i := 0; ; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+
+		if b == ' ' && i > 0 {
+			break
+		}
+
+		if b < '0' || b > '9' || i >= maxDigits {
+			return 0, errInvalidFrameLength
+		}
+
+		size = size*10 + int(b-'0')
+	}
+
+	if size > s.maxMessageSize {
+		return 0, errInvalidFrameLength
+	}
+
+	return size, nil
+}
+
+func (s *Server) handleMessage(data []byte, addr net.Addr) {
+	receiveTime := time.Now()
+
+	m, err := parse(data, receiveTime)
+	if err != nil {
+		s.logger.Warn("syslog message from %s: %v", addr, err)
+
+		return
+	}
+
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		host = addr.String()
+	}
+
+	select {
+	case s.records <- m.record(receiveTime, host):
+	case <-s.done:
+	}
+}
+
+// flushLoop Накопление записей и передача их пакетами, чтобы не создавать отдельную задачу на каждое сообщение
+func (s *Server) flushLoop() {
+	defer s.flushWg.Done()
+
+	ticker := time.NewTicker(s.flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]entity.LogRecord, 0, s.batchSize)
+
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+
+		if err := s.log.Insert(context.Background(), batch); err != nil {
+			s.logger.Warn("syslog: %d records dropped: %v", len(batch), err)
+		}
+
+		batch = make([]entity.LogRecord, 0, s.batchSize)
+	}
+
+	for {
+		select {
+		case rec, ok := <-s.records:
+			if !ok {
+				flush()
+
+				return
+			}
+
+			batch = append(batch, rec)
+			if len(batch) >= s.batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+func (s *Server) notifyError(err error) {
+	select {
+	case s.notify <- err:
+	default:
+	}
+}
+
+func (s *Server) stopped() bool {
+	select {
+	case <-s.done:
+		return true
+	default:
+		return false
+	}
+}
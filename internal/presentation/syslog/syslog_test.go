@@ -0,0 +1,83 @@
+package syslog
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/n-r-w/log-server-v2/pkg/logger"
+)
+
+func TestReadFrame(t *testing.T) {
+	s := &Server{maxMessageSize: 100}
+
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+		err      bool
+	}{
+		{name: "octet counting", input: "5 hello", expected: "hello"},
+		{name: "maximum size", input: "100 " + strings.Repeat("x", 100), expected: strings.Repeat("x", 100)},
+		{name: "too long", input: "101 " + strings.Repeat("x", 101), err: true},
+		// длина не может быть записана большим числом цифр, чем maxMessageSize
+		{name: "long length prefix", input: strings.Repeat("1", 1000) + " x", err: true},
+		{name: "length out of range", input: "1000005 hello", err: true},
+		{name: "not a number", input: "5x hello", err: true},
+		{name: "newline", input: "<13>hello\n", expected: "<13>hello\n"},
+		{name: "newline too long", input: "<13>" + strings.Repeat("x", 200) + "\n", err: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := bufio.NewReaderSize(strings.NewReader(test.input), s.maxMessageSize)
+
+			data, err := s.readFrame(r)
+			if test.err {
+				if err == nil {
+					t.Fatalf("expected error, got %q", data)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != test.expected {
+				t.Fatalf("expected %q, got %q", test.expected, data)
+			}
+		})
+	}
+}
+
+func TestIdleTimeout(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := l.Addr().String()
+	l.Close()
+
+	s := New(nil, logger.New(), TCPAddress(address), IdleTimeout(100*time.Millisecond))
+	defer s.Shutdown()
+
+	conn, err := net.Dial("tcp", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// сервер должен сам закрыть соединение, по которому ничего не приходит
+	if err = conn.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	var netErr net.Error
+	if _, err = conn.Read(make([]byte, 1)); err == nil || (errors.As(err, &netErr) && netErr.Timeout()) {
+		t.Fatalf("expected connection closed by server, got %v", err)
+	}
+}
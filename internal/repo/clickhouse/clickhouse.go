@@ -0,0 +1,469 @@
+// Package clickhouse Содержит реализацию интерфейса репозитория логов для ClickHouse через его HTTP интерфейс.
+// Колоночное хранение ускоряет поиск и подсчет по большому журналу. Таблица log создается миграцией
+// из каталога migration/clickhouse
+package clickhouse
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/n-r-w/log-server-v2/internal/domain/entity"
+)
+
+const (
+	defaultDatabase = "default"
+	defaultMaxConns = 10
+
+	// Формат времени в запросах и ответах. Столбцы времени в UTC
+	timeLayout = "2006-01-02 15:04:05.000000"
+	timeType   = "DateTime64(6, 'UTC')"
+
+	// Сколько байт ответа с ошибкой включать в текст ошибки
+	maxErrorSize = 4096
+)
+
+// Начало отсчета времени в ID записи
+var idEpoch = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+type logRepo struct {
+	// поля для atomic в начале структуры, чтобы они были выровнены на 32-битных платформах
+
+	// последний выданный ID
+	lastID uint64
+
+	// номер экземпляра сервера в младших битах ID
+	node uint64
+
+	url      *url.URL
+	database string
+	user     string
+	password string
+	maxConns int
+	client   *http.Client
+
+	maxLogRecordsResult int
+	insertTimeout       time.Duration
+	findTimeout         time.Duration
+}
+
+// NewLog Репозиторий журнала. address - адрес HTTP интерфейса ClickHouse, например http://localhost:8123.
+// Для записи и поиска задаются свои ограничения времени. Таблица должна существовать: это проверяется при создании
+func NewLog(address string, maxLogRecordsResult int, insertTimeout time.Duration, findTimeout time.Duration, options ...Option) (*logRepo, error) {
+	u, err := url.Parse(address)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("clickhouse: %q is not a valid url, expected http(s)://host:port", address)
+	}
+
+	var node [1]byte
+	if _, err := rand.Read(node[:]); err != nil {
+		return nil, fmt.Errorf("clickhouse: %w", err)
+	}
+
+	r := &logRepo{
+		lastID:              0,
+		node:                uint64(node[0] & 0x0f),
+		url:                 u,
+		database:            defaultDatabase,
+		user:                "",
+		password:            "",
+		maxConns:            defaultMaxConns,
+		client:              nil,
+		maxLogRecordsResult: maxLogRecordsResult,
+		insertTimeout:       insertTimeout,
+		findTimeout:         findTimeout,
+	}
+
+	for _, opt := range options {
+		opt(r)
+	}
+
+	r.client = &http.Client{
+		Transport: &http.Transport{
+			Proxy:               http.ProxyFromEnvironment,
+			MaxConnsPerHost:     r.maxConns,
+			MaxIdleConnsPerHost: r.maxConns,
+			IdleConnTimeout:     90 * time.Second,
+		},
+	}
+
+	// заодно проверяется, что таблица создана
+	ctx, cancel := context.WithTimeout(context.Background(), insertTimeout)
+	defer cancel()
+	if err := r.exec(ctx, "SELECT count() FROM log WHERE 0", nil, nil); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *logRepo) PoolSize() int {
+	return r.maxConns
+}
+
+// insertRow Строка для записи в формате JSONEachRow
+type insertRow struct {
+	ID              uint64 `json:"id"`
+	RecordTimestamp string `json:"record_timestamp"`
+	RealTimestamp   string `json:"real_timestamp"`
+	Level           int    `json:"level"`
+	Host            string `json:"host"`
+	Source          string `json:"source"`
+	Message1        string `json:"message1"`
+	Message2        string `json:"message2"`
+	Message3        string `json:"message3"`
+}
+
+// Insert Пакет записывается одним запросом. ClickHouse рассчитан именно на запись пакетами,
+// а их формирует буфер записи
+func (r *logRepo) Insert(ctx context.Context, records []entity.LogRecord) error {
+	var body bytes.Buffer
+	encoder := json.NewEncoder(&body)
+	now := time.Now().UTC().Format(timeLayout)
+
+	for _, lr := range records {
+		if err := lr.Validate(); err != nil {
+			return err //nolint:wrapcheck
+		}
+
+		if err := encoder.Encode(insertRow{
+			ID:              r.nextID(),
+			RecordTimestamp: lr.LogTime.UTC().Format(timeLayout),
+			RealTimestamp:   now,
+			Level:           lr.Level,
+			Host:            lr.Host,
+			Source:          lr.Source,
+			Message1:        lr.Message1,
+			Message2:        lr.Message2,
+			Message3:        lr.Message3,
+		}); err != nil {
+			return fmt.Errorf("clickhouse: %w", err)
+		}
+	}
+
+	if body.Len() == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, r.insertTimeout)
+	defer cancel()
+
+	return r.exec(ctx,
+		`INSERT INTO log (id, record_timestamp, real_timestamp, level, host, source, message1, message2, message3)
+		FORMAT JSONEachRow`,
+		nil, &body)
+}
+
+// findRow Строка результата поиска. 64-битные числа ClickHouse передает в JSON строками
+type findRow struct {
+	ID              uint64 `json:"id,string"`
+	RecordTimestamp string `json:"record_timestamp"`
+	RealTimestamp   string `json:"real_timestamp"`
+	Level           int    `json:"level"`
+	Host            string `json:"host"`
+	Source          string `json:"source"`
+	Message1        string `json:"message1"`
+	Message2        string `json:"message2"`
+	Message3        string `json:"message3"`
+}
+
+func (r *logRepo) Find(ctx context.Context, query entity.LogQuery) (records []entity.LogRecord, limited bool, err error) {
+	limit := query.Limit
+	if limit <= 0 || limit > r.maxLogRecordsResult {
+		limit = r.maxLogRecordsResult
+	}
+
+	where, params := findCondition(query)
+	params["limit"] = strconv.Itoa(limit + 1)
+
+	ctx, cancel := context.WithTimeout(ctx, r.findTimeout)
+	defer cancel()
+
+	var recs []entity.LogRecord
+	err = r.query(ctx,
+		`SELECT id, record_timestamp, real_timestamp, level, host, source, message1, message2, message3
+		FROM log
+		WHERE `+where+`
+		ORDER BY record_timestamp DESC, id DESC
+		LIMIT {limit:UInt32}
+		FORMAT JSONEachRow`,
+		params,
+		func(decoder *json.Decoder) error {
+			var row findRow
+			if err := decoder.Decode(&row); err != nil {
+				return err //nolint:wrapcheck
+			}
+
+			if len(recs) == limit {
+				limited = true
+
+				return nil
+			}
+
+			record, err := row.record()
+			if err != nil {
+				return err
+			}
+			recs = append(recs, record)
+
+			return nil
+		})
+	if err != nil {
+		return nil, false, err
+	}
+
+	return recs, limited, nil
+}
+
+func (row *findRow) record() (entity.LogRecord, error) {
+	logTime, err := time.ParseInLocation(timeLayout, row.RecordTimestamp, time.UTC)
+	if err != nil {
+		return entity.LogRecord{}, fmt.Errorf("clickhouse: record_timestamp: %w", err)
+	}
+
+	realTime, err := time.ParseInLocation(timeLayout, row.RealTimestamp, time.UTC)
+	if err != nil {
+		return entity.LogRecord{}, fmt.Errorf("clickhouse: real_timestamp: %w", err)
+	}
+
+	return entity.LogRecord{
+		ID:       row.ID,
+		LogTime:  logTime,
+		RealTime: realTime,
+		Level:    row.Level,
+		Host:     row.Host,
+		Source:   row.Source,
+		Message1: row.Message1,
+		Message2: row.Message2,
+		Message3: row.Message3,
+	}, nil
+}
+
+// Выражения для группировки при подсчете записей. Формат ключей тот же, что и в остальных хранилищах
+var countKeys = map[string]string{
+	entity.LogGroupLevel:  "toString(level)",
+	entity.LogGroupHost:   "host",
+	entity.LogGroupSource: "source",
+	entity.LogGroupHour:   "formatDateTime(toStartOfHour(record_timestamp), '%Y-%m-%dT%H:00:00Z')",
+	entity.LogGroupDay:    "formatDateTime(toStartOfDay(record_timestamp), '%Y-%m-%dT00:00:00Z')",
+}
+
+func (r *logRepo) Count(ctx context.Context, query entity.LogQuery, group string) ([]entity.LogCount, error) {
+	key, ok := countKeys[group]
+	if !ok {
+		return nil, fmt.Errorf("unknown log group %q", group)
+	}
+
+	query.Cursor = nil
+	where, params := findCondition(query)
+
+	ctx, cancel := context.WithTimeout(ctx, r.findTimeout)
+	defer cancel()
+
+	var counts []entity.LogCount
+	err := r.query(ctx,
+		`SELECT `+key+` AS key, count() AS count
+		FROM log
+		WHERE `+where+`
+		GROUP BY key
+		ORDER BY key
+		FORMAT JSONEachRow`,
+		params,
+		func(decoder *json.Decoder) error {
+			var row struct {
+				Key   string `json:"key"`
+				Count uint64 `json:"count,string"`
+			}
+			if err := decoder.Decode(&row); err != nil {
+				return err //nolint:wrapcheck
+			}
+
+			counts = append(counts, entity.LogCount{
+				Key:   row.Key,
+				Count: row.Count,
+			})
+
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	return counts, nil
+}
+
+// findCondition Условие WHERE для поиска и его параметры. Значения передаются параметрами запроса
+// ({name:Type}), а не подставляются в текст запроса
+func findCondition(query entity.LogQuery) (where string, params map[string]string) {
+	conditions := []string{"1"}
+	params = make(map[string]string)
+
+	if !query.TimeFrom.IsZero() {
+		conditions = append(conditions, "record_timestamp >= {time_from:"+timeType+"}")
+		params["time_from"] = query.TimeFrom.UTC().Format(timeLayout)
+	}
+	if !query.TimeTo.IsZero() {
+		conditions = append(conditions, "record_timestamp <= {time_to:"+timeType+"}")
+		params["time_to"] = query.TimeTo.UTC().Format(timeLayout)
+	}
+	if len(query.Levels) > 0 {
+		levels := make([]string, 0, len(query.Levels))
+		for _, level := range query.Levels {
+			levels = append(levels, strconv.Itoa(level))
+		}
+		conditions = append(conditions, "has({levels:Array(Int32)}, level)")
+		params["levels"] = "[" + strings.Join(levels, ",") + "]"
+	}
+	if query.MinLevel > 0 {
+		conditions = append(conditions, "level >= {min_level:Int32}")
+		params["min_level"] = strconv.Itoa(query.MinLevel)
+	}
+	if query.MaxLevel > 0 {
+		conditions = append(conditions, "level <= {max_level:Int32}")
+		params["max_level"] = strconv.Itoa(query.MaxLevel)
+	}
+	if len(query.Hosts) > 0 {
+		conditions = append(conditions, "has({hosts:Array(String)}, host)")
+		params["hosts"] = arrayParam(query.Hosts)
+	}
+	if len(query.Sources) > 0 {
+		conditions = append(conditions, "has({sources:Array(String)}, source)")
+		params["sources"] = arrayParam(query.Sources)
+	}
+	if query.Message != "" {
+		conditions = append(conditions, `(positionCaseInsensitiveUTF8(message1, {message:String}) > 0
+			OR positionCaseInsensitiveUTF8(message2, {message:String}) > 0
+			OR positionCaseInsensitiveUTF8(message3, {message:String}) > 0)`)
+		params["message"] = stringEscaper.Replace(query.Message)
+	}
+	if query.Cursor != nil {
+		conditions = append(conditions, "(record_timestamp, id) < ({cursor_time:"+timeType+"}, {cursor_id:UInt64})")
+		params["cursor_time"] = query.Cursor.LogTime.UTC().Format(timeLayout)
+		params["cursor_id"] = strconv.FormatUint(query.Cursor.ID, 10)
+	}
+
+	return strings.Join(conditions, " AND "), params
+}
+
+// Экранирование значений параметров: строка передается в формате TSV, элементы массива - в кавычках
+var (
+	stringEscaper = strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`)
+	quoteEscaper  = strings.NewReplacer(`\`, `\\`, `'`, `\'`, "\t", `\t`, "\n", `\n`)
+)
+
+func arrayParam(values []string) string {
+	quoted := make([]string, 0, len(values))
+	for _, v := range values {
+		quoted = append(quoted, "'"+quoteEscaper.Replace(v)+"'")
+	}
+
+	return "[" + strings.Join(quoted, ",") + "]"
+}
+
+// nextID ID записи: миллисекунды от idEpoch и номер экземпляра сервера в младших 4 битах.
+// ClickHouse не генерирует последовательные ID, а ID нужен для постраничной выборки записей с одинаковым временем.
+// ID возрастают в пределах одного сервера и не превышают 2^53, поэтому не теряют точность в JavaScript
+func (r *logRepo) nextID() uint64 {
+	for {
+		last := atomic.LoadUint64(&r.lastID)
+
+		id := uint64(time.Since(idEpoch).Milliseconds())<<12 | r.node
+		if id <= last {
+			// младшие биты last уже содержат номер экземпляра
+			id = last + 16
+		}
+
+		if atomic.CompareAndSwapUint64(&r.lastID, last, id) {
+			return id
+		}
+	}
+}
+
+// exec Запрос без результата. Если задан body, то текст запроса передается в URL, а body - данные для записи
+func (r *logRepo) exec(ctx context.Context, sql string, params map[string]string, body io.Reader) error {
+	resp, err := r.do(ctx, sql, params, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	_, err = io.Copy(io.Discard, resp.Body)
+
+	return err //nolint:wrapcheck
+}
+
+// query Запрос с результатом в формате JSONEachRow. row вызывается для каждой строки результата
+func (r *logRepo) query(ctx context.Context, sql string, params map[string]string, row func(decoder *json.Decoder) error) error {
+	resp, err := r.do(ctx, sql, params, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	decoder := json.NewDecoder(resp.Body)
+	for decoder.More() {
+		if err := row(decoder); err != nil {
+			// ошибка, возникшая при выполнении запроса, приходит текстом после уже отправленных строк
+			return fmt.Errorf("clickhouse: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (r *logRepo) do(ctx context.Context, sql string, params map[string]string, body io.Reader) (*http.Response, error) {
+	u := *r.url
+	values := u.Query()
+	values.Set("database", r.database)
+	values.Set("output_format_json_quote_64bit_integers", "1")
+	for name, value := range params {
+		values.Set("param_"+name, value)
+	}
+
+	if body == nil {
+		body = strings.NewReader(sql)
+	} else {
+		values.Set("query", sql)
+	}
+	u.RawQuery = values.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), body)
+	if err != nil {
+		return nil, fmt.Errorf("clickhouse: %w", err)
+	}
+	if r.user != "" {
+		req.Header.Set("X-ClickHouse-User", r.user)
+		req.Header.Set("X-ClickHouse-Key", r.password)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		// адрес в ошибке не содержит пароля: он передается в заголовке
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+
+		return nil, fmt.Errorf("clickhouse: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorSize))
+
+		return nil, fmt.Errorf("clickhouse: status %d: %s", resp.StatusCode, strings.TrimSpace(string(message)))
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,484 @@
+package clickhouse
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/n-r-w/log-server-v2/internal/domain/entity"
+	"github.com/n-r-w/log-server-v2/internal/repo/logtest"
+)
+
+// Адрес HTTP интерфейса ClickHouse для тестов. Тесты создают в нем отдельную базу данных и удаляют ее после завершения
+const testClickHouseEnv = "LS_TEST_CLICKHOUSE_URL"
+
+// newTestDatabase База данных с пустой таблицей журнала. Тест пропускается, если ClickHouse не задан или недоступен
+func newTestDatabase(t *testing.T) (address string, database string) {
+	t.Helper()
+
+	address = os.Getenv(testClickHouseEnv)
+	if address == "" {
+		t.Skipf("%s is not set", testClickHouseEnv)
+	}
+
+	database = fmt.Sprintf("logtest_%d", time.Now().UnixNano())
+
+	if err := execSQL(address, "", "SELECT 1"); err != nil {
+		t.Skipf("clickhouse is not available: %v", err)
+	}
+	if err := execSQL(address, "", "CREATE DATABASE "+database); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := execSQL(address, "", "DROP DATABASE "+database); err != nil {
+			t.Errorf("drop database %s: %v", database, err)
+		}
+	})
+
+	migration, err := os.ReadFile(filepath.Join("..", "..", "..", "migration", "clickhouse", "up", "20221026_create_log_up.sql"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := execSQL(address, database, string(migration)); err != nil {
+		t.Fatal(err)
+	}
+
+	return address, database
+}
+
+func execSQL(address string, database string, sql string) error {
+	u := address + "/"
+	if database != "" {
+		u += "?database=" + url.QueryEscape(database)
+	}
+
+	resp, err := http.Post(u, "text/plain", strings.NewReader(sql))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("status %d: %s", resp.StatusCode, body)
+	}
+
+	return nil
+}
+
+func TestConformance(t *testing.T) {
+	address, database := newTestDatabase(t)
+
+	repo, err := NewLog(address, logtest.MinRecordsResult, time.Second*10, time.Second*10, Database(database))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := logtest.Conformance(context.Background(), repo); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// stubRequest Запрос, полученный заглушкой ClickHouse
+type stubRequest struct {
+	sql    string
+	params url.Values
+	body   string
+}
+
+// param Значение параметра запроса {name:Type}
+func (r stubRequest) param(name string) string {
+	return r.params.Get("param_" + name)
+}
+
+// stubServer Заглушка HTTP интерфейса ClickHouse. Проверяет общие параметры запросов и запоминает запросы,
+// ответ формирует respond
+type stubServer struct {
+	t       *testing.T
+	respond func(req stubRequest) (status int, body string)
+
+	mu       sync.Mutex
+	requests []stubRequest
+}
+
+func newStubRepo(t *testing.T, respond func(req stubRequest) (status int, body string)) (*logRepo, *stubServer) {
+	t.Helper()
+
+	stub := &stubServer{
+		t:        t,
+		respond:  respond,
+		mu:       sync.Mutex{},
+		requests: nil,
+	}
+
+	server := httptest.NewServer(stub)
+	t.Cleanup(server.Close)
+
+	repo, err := NewLog(server.URL, 3, time.Second*5, time.Second*5, Database("logs"), Credentials("writer", "secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// проверка таблицы при создании репозитория
+	if req := stub.take(); len(req) != 1 || req[0].sql != "SELECT count() FROM log WHERE 0" {
+		t.Fatalf("unexpected startup requests: %+v", req)
+	}
+
+	return repo, stub
+}
+
+func (s *stubServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	body, _ := io.ReadAll(r.Body)
+
+	if r.Method != http.MethodPost {
+		s.t.Errorf("method %s, expected POST", r.Method)
+	}
+	if params.Get("database") != "logs" {
+		s.t.Errorf("database %q, expected logs", params.Get("database"))
+	}
+	if r.Header.Get("X-ClickHouse-User") != "writer" || r.Header.Get("X-ClickHouse-Key") != "secret" {
+		s.t.Errorf("credentials are not passed in headers")
+	}
+	if strings.Contains(r.URL.RawQuery, "secret") {
+		s.t.Errorf("password is passed in url")
+	}
+	if params.Get("output_format_json_quote_64bit_integers") != "1" {
+		s.t.Errorf("64-bit integers are not quoted")
+	}
+
+	// текст запроса в URL, если в теле данные для записи
+	req := stubRequest{
+		sql:    params.Get("query"),
+		params: params,
+		body:   string(body),
+	}
+	if req.sql == "" {
+		req.sql = req.body
+		req.body = ""
+	}
+	req.sql = strings.Join(strings.Fields(req.sql), " ")
+
+	s.mu.Lock()
+	s.requests = append(s.requests, req)
+	s.mu.Unlock()
+
+	status, response := http.StatusOK, ""
+	if !strings.HasPrefix(req.sql, "SELECT count() FROM log WHERE 0") {
+		status, response = s.respond(req)
+	}
+
+	w.WriteHeader(status)
+	_, _ = io.WriteString(w, response)
+}
+
+// take Полученные запросы с момента предыдущего вызова
+func (s *stubServer) take() []stubRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	requests := s.requests
+	s.requests = nil
+
+	return requests
+}
+
+func (s *stubServer) single(t *testing.T) stubRequest {
+	t.Helper()
+
+	requests := s.take()
+	if len(requests) != 1 {
+		t.Fatalf("expected 1 request, got %d", len(requests))
+	}
+
+	return requests[0]
+}
+
+func ok(stubRequest) (int, string) {
+	return http.StatusOK, ""
+}
+
+func TestStubInsert(t *testing.T) {
+	repo, stub := newStubRepo(t, ok)
+
+	logTime := time.Date(2022, 10, 26, 15, 4, 5, 123456000, time.FixedZone("", 3*3600))
+	records := []entity.LogRecord{
+		{ID: 0, LogTime: logTime, RealTime: time.Time{}, Level: entity.LevelError, Host: "web'1", Source: "api",
+			Message1: "first\n'quoted'\t\\", Message2: "", Message3: ""},
+		{ID: 0, LogTime: logTime, RealTime: time.Time{}, Level: entity.LevelInfo, Host: "", Source: "",
+			Message1: "second", Message2: "details", Message3: "more"},
+	}
+
+	if err := repo.Insert(context.Background(), records); err != nil {
+		t.Fatal(err)
+	}
+
+	req := stub.single(t)
+	expectedSQL := "INSERT INTO log (id, record_timestamp, real_timestamp, level, host, source, message1, message2, message3) FORMAT JSONEachRow"
+	if req.sql != expectedSQL {
+		t.Fatalf("unexpected sql: %s", req.sql)
+	}
+
+	var rows []insertRow
+	scanner := bufio.NewScanner(strings.NewReader(req.body))
+	for scanner.Scan() {
+		var row insertRow
+		if err := json.Unmarshal(scanner.Bytes(), &row); err != nil {
+			t.Fatal(err)
+		}
+		rows = append(rows, row)
+	}
+
+	if len(rows) != len(records) {
+		t.Fatalf("expected %d rows, got %d", len(records), len(rows))
+	}
+	if rows[0].ID == 0 || rows[1].ID <= rows[0].ID {
+		t.Fatalf("IDs must increase: %d, %d", rows[0].ID, rows[1].ID)
+	}
+	// время записывается в UTC
+	if rows[0].RecordTimestamp != "2022-10-26 12:04:05.123456" {
+		t.Fatalf("unexpected record_timestamp %s", rows[0].RecordTimestamp)
+	}
+	if _, err := time.Parse(timeLayout, rows[0].RealTimestamp); err != nil {
+		t.Fatalf("unexpected real_timestamp %s", rows[0].RealTimestamp)
+	}
+	for i, row := range rows {
+		r := records[i]
+		if row.Level != r.Level || row.Host != r.Host || row.Source != r.Source ||
+			row.Message1 != r.Message1 || row.Message2 != r.Message2 || row.Message3 != r.Message3 {
+			t.Fatalf("row %d changed: %+v", i, row)
+		}
+	}
+
+	// некорректная запись не отправляется
+	records[1].Message1 = ""
+	if err := repo.Insert(context.Background(), records); err == nil {
+		t.Fatal("record without message1 accepted")
+	}
+	if requests := stub.take(); len(requests) != 0 {
+		t.Fatalf("invalid batch was sent")
+	}
+}
+
+func TestStubFindFilters(t *testing.T) {
+	repo, stub := newStubRepo(t, ok)
+
+	query := entity.LogQuery{
+		TimeFrom: time.Date(2022, 10, 1, 0, 0, 0, 0, time.UTC),
+		TimeTo:   time.Date(2022, 10, 2, 3, 0, 0, 0, time.FixedZone("", 3*3600)),
+		Levels:   []int{entity.LevelWarn, entity.LevelError},
+		MinLevel: entity.LevelInfo,
+		MaxLevel: entity.LevelFatal,
+		Hosts:    []string{"web'1", `c:\logs`, "tab\there"},
+		Sources:  []string{"api"},
+		Message:  "it's \\ a\ttab\nline",
+		Limit:    0,
+		Cursor:   nil,
+	}
+
+	if _, _, err := repo.Find(context.Background(), query); err != nil {
+		t.Fatal(err)
+	}
+
+	req := stub.single(t)
+	for _, condition := range []string{
+		"record_timestamp >= {time_from:DateTime64(6, 'UTC')}",
+		"record_timestamp <= {time_to:DateTime64(6, 'UTC')}",
+		"has({levels:Array(Int32)}, level)",
+		"level >= {min_level:Int32}",
+		"level <= {max_level:Int32}",
+		"has({hosts:Array(String)}, host)",
+		"has({sources:Array(String)}, source)",
+		"positionCaseInsensitiveUTF8(message1, {message:String}) > 0",
+		"positionCaseInsensitiveUTF8(message3, {message:String}) > 0",
+	} {
+		if !strings.Contains(req.sql, condition) {
+			t.Errorf("condition %q not found in %s", condition, req.sql)
+		}
+	}
+	// значения передаются только параметрами
+	if strings.Contains(req.sql, "web") || strings.Contains(req.sql, "tab") {
+		t.Errorf("values are inserted into sql: %s", req.sql)
+	}
+
+	expected := map[string]string{
+		"time_from": "2022-10-01 00:00:00.000000",
+		"time_to":   "2022-10-02 00:00:00.000000",
+		"levels":    "[3,4]",
+		"min_level": "2",
+		"max_level": "5",
+		// строки в массиве в кавычках: кавычка и обратная косая черта экранируются
+		"hosts":   `['web\'1','c:\\logs','tab\there']`,
+		"sources": `['api']`,
+		// строка в формате TSV: кавычка не экранируется
+		"message": `it's \\ a\ttab\nline`,
+		"limit":   "4",
+	}
+	for name, value := range expected {
+		if got := req.param(name); got != value {
+			t.Errorf("param %s = %q, expected %q", name, got, value)
+		}
+	}
+}
+
+// stubRows Строки результата поиска в формате JSONEachRow, ID в виде строк
+func stubRows(from, to uint64, logTime time.Time) string {
+	var b strings.Builder
+	for id := from; id > to; id-- {
+		fmt.Fprintf(&b, `{"id":"%d","record_timestamp":"%s","real_timestamp":"%s","level":2,"host":"h","source":"s",`+
+			`"message1":"m%d","message2":"","message3":""}`+"\n",
+			id, logTime.Format(timeLayout), logTime.Format(timeLayout), id)
+	}
+
+	return b.String()
+}
+
+func TestStubFindCursorPaging(t *testing.T) {
+	logTime := time.Date(2022, 10, 26, 12, 0, 0, 0, time.UTC)
+
+	// 5 записей с одинаковым временем, ID 10..6. Страница - 3 записи (ограничение репозитория)
+	repo, stub := newStubRepo(t, func(req stubRequest) (int, string) {
+		switch req.param("cursor_id") {
+		case "":
+			return http.StatusOK, stubRows(10, 6, logTime)
+		case "8":
+			return http.StatusOK, stubRows(7, 5, logTime)
+		default:
+			return http.StatusBadRequest, "unexpected cursor"
+		}
+	})
+
+	ctx := context.Background()
+	const order = "ORDER BY record_timestamp DESC, id DESC LIMIT {limit:UInt32} FORMAT JSONEachRow"
+
+	page, limited, err := repo.Find(ctx, entity.LogQuery{Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !limited || len(page) != 3 || page[0].ID != 10 || page[2].ID != 8 {
+		t.Fatalf("unexpected first page: limited %v, %+v", limited, page)
+	}
+	if !page[0].LogTime.Equal(logTime) || page[0].Message1 != "m10" {
+		t.Fatalf("unexpected record: %+v", page[0])
+	}
+
+	req := stub.single(t)
+	if !strings.HasSuffix(req.sql, order) || strings.Contains(req.sql, "cursor") {
+		t.Fatalf("unexpected sql: %s", req.sql)
+	}
+	// на одну больше, чтобы определить, что записи остались
+	if req.param("limit") != "4" {
+		t.Fatalf("limit %s, expected 4", req.param("limit"))
+	}
+
+	last := page[len(page)-1]
+	page, limited, err = repo.Find(ctx, entity.LogQuery{Limit: 2, Cursor: &entity.LogCursor{LogTime: last.LogTime, ID: last.ID}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if limited || len(page) != 2 || page[0].ID != 7 || page[1].ID != 6 {
+		t.Fatalf("unexpected second page: limited %v, %+v", limited, page)
+	}
+
+	req = stub.single(t)
+	if !strings.Contains(req.sql, "(record_timestamp, id) < ({cursor_time:DateTime64(6, 'UTC')}, {cursor_id:UInt64})") ||
+		!strings.HasSuffix(req.sql, order) {
+		t.Fatalf("unexpected sql: %s", req.sql)
+	}
+	if req.param("cursor_time") != "2022-10-26 12:00:00.000000" || req.param("limit") != "3" {
+		t.Fatalf("unexpected params: %v", req.params)
+	}
+}
+
+func TestStubCount(t *testing.T) {
+	groups := map[string]string{
+		entity.LogGroupLevel:  "toString(level)",
+		entity.LogGroupHost:   "host",
+		entity.LogGroupSource: "source",
+		entity.LogGroupHour:   "formatDateTime(toStartOfHour(record_timestamp), '%Y-%m-%dT%H:00:00Z')",
+		entity.LogGroupDay:    "formatDateTime(toStartOfDay(record_timestamp), '%Y-%m-%dT00:00:00Z')",
+	}
+
+	for group, key := range groups {
+		t.Run(group, func(t *testing.T) {
+			repo, stub := newStubRepo(t, func(stubRequest) (int, string) {
+				return http.StatusOK, `{"key":"a","count":"18446744073709551615"}` + "\n" + `{"key":"b","count":"2"}` + "\n"
+			})
+
+			counts, err := repo.Count(context.Background(), entity.LogQuery{
+				Hosts:  []string{"web'1"},
+				Limit:  1,
+				Cursor: &entity.LogCursor{LogTime: time.Now(), ID: 1},
+			}, group)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(counts) != 2 || counts[0] != (entity.LogCount{Key: "a", Count: 18446744073709551615}) ||
+				counts[1] != (entity.LogCount{Key: "b", Count: 2}) {
+				t.Fatalf("unexpected counts: %+v", counts)
+			}
+
+			req := stub.single(t)
+			expectedSQL := "SELECT " + key + " AS key, count() AS count FROM log WHERE 1 AND has({hosts:Array(String)}, host) " +
+				"GROUP BY key ORDER BY key FORMAT JSONEachRow"
+			if req.sql != expectedSQL {
+				t.Fatalf("unexpected sql:\n%s\nexpected:\n%s", req.sql, expectedSQL)
+			}
+			if req.param("hosts") != `['web\'1']` || req.params.Has("param_limit") || req.params.Has("param_cursor_id") {
+				t.Fatalf("unexpected params: %v", req.params)
+			}
+		})
+	}
+
+	repo, stub := newStubRepo(t, ok)
+	if _, err := repo.Count(context.Background(), entity.LogQuery{}, "week"); err == nil {
+		t.Fatal("unknown group accepted")
+	}
+	if requests := stub.take(); len(requests) != 0 {
+		t.Fatal("request sent for unknown group")
+	}
+}
+
+func TestStubErrors(t *testing.T) {
+	repo, _ := newStubRepo(t, func(stubRequest) (int, string) {
+		return http.StatusInternalServerError, "Code: 241. DB::Exception: Memory limit exceeded\n"
+	})
+
+	_, _, err := repo.Find(context.Background(), entity.LogQuery{})
+	if err == nil || !strings.Contains(err.Error(), "Memory limit exceeded") || !strings.Contains(err.Error(), "500") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// ошибка, возникшая после отправки части строк
+	repo, _ = newStubRepo(t, func(stubRequest) (int, string) {
+		return http.StatusOK, stubRows(2, 1, time.Now()) + "Code: 159. DB::Exception: Timeout exceeded\n"
+	})
+
+	if _, _, err := repo.Find(context.Background(), entity.LogQuery{}); err == nil {
+		t.Fatal("error in the middle of the result is ignored")
+	}
+
+	// таблица не создана
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Code: 60. DB::Exception: Table default.log doesn't exist", http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	if _, err := NewLog(server.URL, 3, time.Second, time.Second); err == nil || !strings.Contains(err.Error(), "doesn't exist") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := NewLog("localhost:8123", 3, time.Second, time.Second); err == nil {
+		t.Fatal("url without scheme accepted")
+	}
+}
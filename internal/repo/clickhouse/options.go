@@ -0,0 +1,25 @@
+package clickhouse
+
+type Option func(*logRepo)
+
+// Database База данных, в которой находится таблица log
+func Database(name string) Option {
+	return func(r *logRepo) {
+		r.database = name
+	}
+}
+
+// Credentials Пользователь и пароль ClickHouse
+func Credentials(user string, password string) Option {
+	return func(r *logRepo) {
+		r.user = user
+		r.password = password
+	}
+}
+
+// MaxConns Максимальное количество HTTP соединений с сервером
+func MaxConns(n int) Option {
+	return func(r *logRepo) {
+		r.maxConns = n
+	}
+}
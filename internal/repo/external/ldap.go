@@ -0,0 +1,278 @@
+package external
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/n-r-w/log-server-v2/internal/domain/entity"
+)
+
+// LDAPProvider Идентификатор провайдера, который сохраняется у пользователей LDAP
+const LDAPProvider = "ldap"
+
+// LDAPConfig Параметры подключения к LDAP или Active Directory
+type LDAPConfig struct {
+	// URL адрес сервера: ldap://host:389 или ldaps://host:636
+	URL string
+	// StartTLS переход на TLS после подключения по ldap://
+	StartTLS bool
+	// InsecureSkipVerify не проверять сертификат сервера
+	InsecureSkipVerify bool
+	// BindDN и BindPassword учетная запись для поиска пользователей. Пустой BindDN - анонимный поиск
+	BindDN       string
+	BindPassword string
+	// BaseDN где искать пользователей
+	BaseDN string
+	// UserFilter фильтр поиска пользователя, %s заменяется на логин. Например (uid=%s) или (sAMAccountName=%s)
+	UserFilter string
+	// LoginAttribute атрибут с логином. Его значение становится логином пользователя на сервере
+	LoginAttribute string
+	// NameAttribute атрибут с именем пользователя
+	NameAttribute string
+	// GroupAttribute атрибут со списком групп пользователя
+	GroupAttribute string
+	// AdminGroups группы, участникам которых назначается роль admin
+	AdminGroups []string
+	// UserGroups группы, участникам которых разрешен вход с ролью user. Пустой список - вход разрешен всем пользователям каталога
+	UserGroups []string
+	// Timeout таймаут подключения и операций
+	Timeout time.Duration
+}
+
+type passwordVerifier struct {
+	cfg         LDAPConfig
+	adminGroups groupSet
+	userGroups  groupSet
+}
+
+// NewPasswordVerifier Проверка паролей через LDAP: поиск пользователя по логину и bind с его DN и паролем.
+// Группы сравниваются по полному DN без учета регистра и пробелов вокруг разделителей. Сравнение только
+// по CN недопустимо: группа с тем же CN может быть создана в любом другом месте каталога
+func NewPasswordVerifier(cfg LDAPConfig) (*passwordVerifier, error) {
+	if cfg.URL == "" || cfg.BaseDN == "" {
+		return nil, fmt.Errorf("ldap url and base dn must be defined")
+	}
+
+	if strings.Count(cfg.UserFilter, "%s") != 1 {
+		return nil, fmt.Errorf("ldap user filter must contain exactly one %%s: %s", cfg.UserFilter)
+	}
+
+	return &passwordVerifier{
+		cfg:         cfg,
+		adminGroups: newGroupSet(cfg.AdminGroups),
+		userGroups:  newGroupSet(cfg.UserGroups),
+	}, nil
+}
+
+// Authenticate Проверка пароля
+func (p *passwordVerifier) Authenticate(ctx context.Context, login string, password string) (entity.Identity, error) {
+	login = strings.TrimSpace(login)
+
+	// bind с пустым паролем по RFC 4513 является анонимным и проходит успешно
+	if login == "" || password == "" {
+		return entity.Identity{}, nil
+	}
+
+	if err := ctx.Err(); err != nil {
+		return entity.Identity{}, err //nolint:wrapcheck
+	}
+
+	conn, err := p.connect()
+	if err != nil {
+		return entity.Identity{}, err
+	}
+	defer conn.Close()
+
+	// библиотека ldap не поддерживает context, поэтому при отмене запроса соединение закрывается,
+	// что прерывает текущую операцию. Повторное закрытие соединения допустимо
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	entry, err := p.findUser(conn, login)
+	if err != nil || entry == nil {
+		return entity.Identity{}, err
+	}
+
+	if err = conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return entity.Identity{}, nil
+		}
+
+		return entity.Identity{}, fmt.Errorf("ldap bind %s: %w", entry.DN, err)
+	}
+
+	role, allowed := p.mapRole(entry.GetAttributeValues(p.cfg.GroupAttribute))
+	if !allowed {
+		return entity.Identity{}, nil
+	}
+
+	identity := entity.Identity{
+		Provider: LDAPProvider,
+		Login:    strings.TrimSpace(entry.GetAttributeValue(p.cfg.LoginAttribute)),
+		Name:     strings.TrimSpace(entry.GetAttributeValue(p.cfg.NameAttribute)),
+		Role:     role,
+	}
+
+	if identity.Login == "" {
+		identity.Login = login
+	}
+
+	return identity, nil
+}
+
+func (p *passwordVerifier) connect() (*ldap.Conn, error) {
+	// при StartTLS имя сервера для проверки сертификата само не определяется
+	tlsConfig := &tls.Config{ //nolint:gosec
+		ServerName:         "",
+		InsecureSkipVerify: p.cfg.InsecureSkipVerify,
+	}
+	if u, err := url.Parse(p.cfg.URL); err == nil {
+		tlsConfig.ServerName = u.Hostname()
+	}
+
+	conn, err := ldap.DialURL(p.cfg.URL,
+		ldap.DialWithDialer(&net.Dialer{Timeout: p.cfg.Timeout}),
+		ldap.DialWithTLSConfig(tlsConfig))
+	if err != nil {
+		return nil, fmt.Errorf("ldap connect %s: %w", p.cfg.URL, err)
+	}
+
+	conn.SetTimeout(p.cfg.Timeout)
+
+	if p.cfg.StartTLS {
+		if err = conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+
+			return nil, fmt.Errorf("ldap start tls: %w", err)
+		}
+	}
+
+	if p.cfg.BindDN == "" {
+		err = conn.UnauthenticatedBind("")
+	} else {
+		err = conn.Bind(p.cfg.BindDN, p.cfg.BindPassword)
+	}
+
+	if err != nil {
+		conn.Close()
+
+		return nil, fmt.Errorf("ldap service bind: %w", err)
+	}
+
+	return conn, nil
+}
+
+// findUser Поиск пользователя по логину. nil - пользователь не найден
+func (p *passwordVerifier) findUser(conn *ldap.Conn, login string) (*ldap.Entry, error) {
+	request := ldap.NewSearchRequest(p.cfg.BaseDN,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+		2, int(p.cfg.Timeout/time.Second), false,
+		fmt.Sprintf(p.cfg.UserFilter, ldap.EscapeFilter(login)),
+		[]string{p.cfg.LoginAttribute, p.cfg.NameAttribute, p.cfg.GroupAttribute},
+		nil)
+
+	result, err := conn.Search(request)
+	if err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultNoSuchObject) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("ldap search %s: %w", login, err)
+	}
+
+	switch len(result.Entries) {
+	case 0:
+		return nil, nil
+	case 1:
+		return result.Entries[0], nil
+	default:
+		return nil, fmt.Errorf("ldap search %s: more than one user found", login)
+	}
+}
+
+// mapRole Роль пользователя по его группам. allowed = false - пользователь не входит ни в одну из разрешенных групп
+func (p *passwordVerifier) mapRole(groups []string) (role string, allowed bool) {
+	if p.adminGroups.match(groups) {
+		return entity.RoleAdmin, true
+	}
+
+	if p.userGroups.empty() || p.userGroups.match(groups) {
+		return entity.RoleUser, true
+	}
+
+	return "", false
+}
+
+// groupSet Группы из настроек. Значения, которые не являются DN (в некоторых каталогах атрибут групп
+// содержит только имена), сравниваются целиком без учета регистра
+type groupSet struct {
+	dns   []*ldap.DN
+	names map[string]struct{}
+}
+
+func newGroupSet(values []string) groupSet {
+	set := groupSet{
+		dns:   nil,
+		names: make(map[string]struct{}),
+	}
+
+	for _, v := range values {
+		v = strings.TrimSpace(v)
+		if dn, ok := parseDN(v); ok {
+			set.dns = append(set.dns, dn)
+		} else {
+			set.names[strings.ToLower(v)] = struct{}{}
+		}
+	}
+
+	return set
+}
+
+func (s groupSet) empty() bool {
+	return len(s.dns) == 0 && len(s.names) == 0
+}
+
+func (s groupSet) match(groups []string) bool {
+	for _, g := range groups {
+		g = strings.TrimSpace(g)
+
+		dn, ok := parseDN(g)
+		if !ok {
+			if _, found := s.names[strings.ToLower(g)]; found {
+				return true
+			}
+
+			continue
+		}
+
+		for _, d := range s.dns {
+			if d.EqualFold(dn) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func parseDN(value string) (*ldap.DN, bool) {
+	dn, err := ldap.ParseDN(value)
+	if err != nil || len(dn.RDNs) == 0 {
+		return nil, false
+	}
+
+	return dn, true
+}
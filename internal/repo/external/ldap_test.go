@@ -0,0 +1,357 @@
+package external
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+	"github.com/n-r-w/log-server-v2/internal/domain/entity"
+)
+
+const (
+	testBaseDN          = "dc=example,dc=com"
+	testServiceDN       = "cn=service,dc=example,dc=com"
+	testServicePassword = "service-secret"
+	testAdminGroup      = "cn=admins,ou=groups,dc=example,dc=com"
+	testUserGroup       = "cn=users,ou=groups,dc=example,dc=com"
+)
+
+type fakeEntry struct {
+	password   string
+	attributes map[string][]string
+}
+
+// fakeDirectory Каталог LDAP в памяти. Поддерживает только то, что нужно для проверки пароля:
+// simple bind, поиск по фильтру на равенство и unbind
+type fakeDirectory struct {
+	listener net.Listener
+	entries  map[string]fakeEntry
+
+	wg sync.WaitGroup
+}
+
+func newFakeDirectory(t *testing.T) *fakeDirectory {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := &fakeDirectory{
+		listener: listener,
+		entries: map[string]fakeEntry{
+			testServiceDN: {password: testServicePassword, attributes: nil},
+			"uid=alice,ou=people,dc=example,dc=com": {
+				password: "alice-password",
+				attributes: map[string][]string{
+					"uid":      {"alice"},
+					"cn":       {"Alice"},
+					"memberOf": {"CN=Admins, OU=Groups, DC=Example, DC=Com"},
+				},
+			},
+			"uid=bob,ou=people,dc=example,dc=com": {
+				password: "bob-password",
+				attributes: map[string][]string{
+					"uid":      {"bob"},
+					"cn":       {"Bob"},
+					"memberOf": {testUserGroup},
+				},
+			},
+			// группа с тем же CN, что и у группы админов, но в другом месте каталога
+			"uid=mallory,ou=people,dc=example,dc=com": {
+				password: "mallory-password",
+				attributes: map[string][]string{
+					"uid":      {"mallory"},
+					"cn":       {"Mallory"},
+					"memberOf": {"cn=admins,ou=other,dc=evil"},
+				},
+			},
+		},
+		wg: sync.WaitGroup{},
+	}
+
+	d.wg.Add(1)
+	go d.serve()
+
+	t.Cleanup(func() {
+		listener.Close()
+		d.wg.Wait()
+	})
+
+	return d
+}
+
+func (d *fakeDirectory) url() string {
+	return "ldap://" + d.listener.Addr().String()
+}
+
+func (d *fakeDirectory) serve() {
+	defer d.wg.Done()
+
+	for {
+		conn, err := d.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		d.wg.Add(1)
+		go func() {
+			defer d.wg.Done()
+			defer conn.Close()
+
+			d.handle(conn)
+		}()
+	}
+}
+
+func (d *fakeDirectory) handle(conn net.Conn) {
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+
+		id := packet.Children[0].Value
+		op := packet.Children[1]
+
+		var responses []*ber.Packet
+		switch op.Tag {
+		case ldap.ApplicationBindRequest:
+			responses = append(responses, d.bind(op))
+		case ldap.ApplicationSearchRequest:
+			responses = d.search(op)
+		default:
+			return
+		}
+
+		for _, response := range responses {
+			envelope := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+			envelope.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, "MessageID"))
+			envelope.AppendChild(response)
+
+			if _, err := conn.Write(envelope.Bytes()); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (d *fakeDirectory) bind(op *ber.Packet) *ber.Packet {
+	dn := op.Children[1].Data.String()
+	password := op.Children[2].Data.String()
+
+	code := ldap.LDAPResultSuccess
+	if dn != "" {
+		entry, ok := d.entries[dn]
+		if !ok || entry.password != password {
+			code = ldap.LDAPResultInvalidCredentials
+		}
+	}
+
+	return ldapResult(ldap.ApplicationBindResponse, code)
+}
+
+// search Поддерживается только фильтр (attr=value)
+func (d *fakeDirectory) search(op *ber.Packet) []*ber.Packet {
+	filter := op.Children[6]
+	if filter.Tag != ldap.FilterEqualityMatch || len(filter.Children) != 2 {
+		return []*ber.Packet{ldapResult(ldap.ApplicationSearchResultDone, ldap.LDAPResultUnwillingToPerform)}
+	}
+	attr := filter.Children[0].Data.String()
+	value := filter.Children[1].Data.String()
+
+	var responses []*ber.Packet
+	for dn, entry := range d.entries {
+		found := false
+		for _, v := range entry.attributes[attr] {
+			found = found || strings.EqualFold(v, value)
+		}
+		if !found {
+			continue
+		}
+
+		result := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "Search Result Entry")
+		result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, dn, "DN"))
+		attributes := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attributes")
+		for name, values := range entry.attributes {
+			attribute := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attribute")
+			attribute.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "Type"))
+			set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "Values")
+			for _, v := range values {
+				set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, v, "Value"))
+			}
+			attribute.AppendChild(set)
+			attributes.AppendChild(attribute)
+		}
+		result.AppendChild(attributes)
+		responses = append(responses, result)
+	}
+
+	return append(responses, ldapResult(ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess))
+}
+
+func ldapResult(application ber.Tag, code int) *ber.Packet {
+	result := ber.Encode(ber.ClassApplication, ber.TypeConstructed, application, nil, "Result")
+	result.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(code), "Result Code"))
+	result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Matched DN"))
+	result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Diagnostic Message"))
+
+	return result
+}
+
+func testLDAPConfig(url string) LDAPConfig {
+	return LDAPConfig{
+		URL:                url,
+		StartTLS:           false,
+		InsecureSkipVerify: false,
+		BindDN:             testServiceDN,
+		BindPassword:       testServicePassword,
+		BaseDN:             testBaseDN,
+		UserFilter:         "(uid=%s)",
+		LoginAttribute:     "uid",
+		NameAttribute:      "cn",
+		GroupAttribute:     "memberOf",
+		AdminGroups:        []string{testAdminGroup},
+		UserGroups:         nil,
+		Timeout:            time.Second * 3,
+	}
+}
+
+func TestLDAPAuthenticate(t *testing.T) {
+	d := newFakeDirectory(t)
+
+	tests := []struct {
+		name        string
+		adminGroups []string
+		userGroups  []string
+		login       string
+		password    string
+		expected    entity.Identity
+	}{
+		{
+			name:     "admin group by full DN",
+			login:    "alice",
+			password: "alice-password",
+			expected: entity.Identity{Provider: LDAPProvider, Login: "alice", Name: "Alice", Role: entity.RoleAdmin},
+		},
+		{
+			name:     "any user of the directory",
+			login:    "bob",
+			password: "bob-password",
+			expected: entity.Identity{Provider: LDAPProvider, Login: "bob", Name: "Bob", Role: entity.RoleUser},
+		},
+		{
+			name:       "user group",
+			userGroups: []string{testUserGroup},
+			login:      "bob",
+			password:   "bob-password",
+			expected:   entity.Identity{Provider: LDAPProvider, Login: "bob", Name: "Bob", Role: entity.RoleUser},
+		},
+		{
+			name:     "same CN in another branch is not admin",
+			login:    "mallory",
+			password: "mallory-password",
+			expected: entity.Identity{Provider: LDAPProvider, Login: "mallory", Name: "Mallory", Role: entity.RoleUser},
+		},
+		{
+			name:       "same CN in another branch is not allowed",
+			userGroups: []string{testUserGroup},
+			login:      "mallory",
+			password:   "mallory-password",
+			expected:   entity.Identity{},
+		},
+		{
+			name:        "CN alone does not match",
+			adminGroups: []string{"admins"},
+			login:       "mallory",
+			password:    "mallory-password",
+			expected:    entity.Identity{Provider: LDAPProvider, Login: "mallory", Name: "Mallory", Role: entity.RoleUser},
+		},
+		{
+			name:     "wrong password",
+			login:    "alice",
+			password: "wrong",
+			expected: entity.Identity{},
+		},
+		{
+			name:     "unknown user",
+			login:    "nobody",
+			password: "password",
+			expected: entity.Identity{},
+		},
+		{
+			name:     "empty password",
+			login:    "alice",
+			password: "",
+			expected: entity.Identity{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := testLDAPConfig(d.url())
+			if test.adminGroups != nil {
+				cfg.AdminGroups = test.adminGroups
+			}
+			cfg.UserGroups = test.userGroups
+
+			verifier, err := NewPasswordVerifier(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			identity, err := verifier.Authenticate(context.Background(), test.login, test.password)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if identity != test.expected {
+				t.Fatalf("expected %+v, got %+v", test.expected, identity)
+			}
+		})
+	}
+}
+
+func TestLDAPServiceBindFailure(t *testing.T) {
+	d := newFakeDirectory(t)
+
+	cfg := testLDAPConfig(d.url())
+	cfg.BindPassword = "wrong"
+
+	verifier, err := NewPasswordVerifier(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := verifier.Authenticate(context.Background(), "alice", "alice-password"); err == nil {
+		t.Fatal("expected service bind error")
+	}
+}
+
+func TestLDAPUnreachable(t *testing.T) {
+	// адрес, на котором точно никто не слушает
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	url := "ldap://" + listener.Addr().String()
+	listener.Close()
+
+	verifier, err := NewPasswordVerifier(testLDAPConfig(url))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	identity, err := verifier.Authenticate(context.Background(), "alice", "alice-password")
+	if err == nil {
+		t.Fatal("expected connection error")
+	}
+	if identity != (entity.Identity{}) {
+		t.Fatalf("expected empty identity, got %+v", identity)
+	}
+}
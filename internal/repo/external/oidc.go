@@ -0,0 +1,57 @@
+// Package external Реализация интерфейсов внешних провайдеров аутентификации
+package external
+
+import (
+	"context"
+
+	"github.com/n-r-w/log-server-v2/internal/domain/entity"
+	"github.com/n-r-w/log-server-v2/pkg/oidc"
+)
+
+type tokenVerifier struct {
+	verifier   *oidc.Verifier
+	adminRoles map[string]struct{}
+}
+
+// NewTokenVerifier Проверка токенов OIDC. adminRoles - роли (группы) провайдера, которым соответствует роль admin
+func NewTokenVerifier(verifier *oidc.Verifier, adminRoles []string) *tokenVerifier {
+	return &tokenVerifier{
+		verifier:   verifier,
+		adminRoles: toSet(adminRoles),
+	}
+}
+
+// Verify Проверка токена
+func (t *tokenVerifier) Verify(ctx context.Context, token string) (entity.Identity, error) {
+	identity, err := t.verifier.Verify(ctx, token)
+	if err != nil {
+		return entity.Identity{}, err
+	}
+
+	return entity.Identity{
+		Provider: identity.Issuer,
+		Login:    identity.Login,
+		Name:     identity.Name,
+		Role:     mapRole(identity.Roles, t.adminRoles),
+	}, nil
+}
+
+// mapRole Роль пользователя по его ролям (группам) у провайдера
+func mapRole(roles []string, adminRoles map[string]struct{}) string {
+	for _, r := range roles {
+		if _, ok := adminRoles[r]; ok {
+			return entity.RoleAdmin
+		}
+	}
+
+	return entity.RoleUser
+}
+
+func toSet(values []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(values))
+	for _, v := range values {
+		set[v] = struct{}{}
+	}
+
+	return set
+}
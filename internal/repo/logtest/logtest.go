@@ -0,0 +1,329 @@
+// Package logtest Проверка реализации usecase.LogInterface: запись, порядок записей, фильтры, ограничение
+// количества, постраничная выборка и подсчет по группам. Одна и та же проверка выполняется для всех хранилищ журнала, поэтому
+// их поведение не расходится. Использование в тесте:
+//
+//	if err := logtest.Conformance(ctx, repo); err != nil {
+//		t.Fatal(err)
+//	}
+package logtest
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/n-r-w/log-server-v2/internal/domain/entity"
+	"github.com/n-r-w/log-server-v2/internal/domain/usecase"
+)
+
+// MinRecordsResult Ограничение количества записей в ответе, при котором проходит проверка
+const MinRecordsResult = 20
+
+// Conformance Проверить хранилище. Хранилище должно быть пустым, а его ограничение количества записей
+// в ответе - не меньше MinRecordsResult. Возвращает описание первого несоответствия
+func Conformance(ctx context.Context, repo usecase.LogInterface) error {
+	if err := repo.Insert(ctx, []entity.LogRecord{{
+		ID:       0,
+		LogTime:  time.Now(),
+		RealTime: time.Time{},
+		Level:    entity.LevelInfo,
+		Host:     "",
+		Source:   "",
+		Message1: "",
+		Message2: "",
+		Message3: "",
+	}}); err == nil {
+		return fmt.Errorf("insert: record without message1 accepted")
+	}
+
+	records := testRecords()
+	// несколькими пакетами, чтобы проверить и продолжение записи
+	for _, batch := range [][]entity.LogRecord{records[:5], records[5:6], records[6:]} {
+		if err := repo.Insert(ctx, batch); err != nil {
+			return fmt.Errorf("insert: %w", err)
+		}
+	}
+
+	all, limited, err := repo.Find(ctx, entity.LogQuery{})
+	if err != nil {
+		return fmt.Errorf("find all: %w", err)
+	}
+	if limited {
+		return fmt.Errorf("find all: limited is set for %d records", len(all))
+	}
+	if err := checkRecords(all, records); err != nil {
+		return fmt.Errorf("find all: %w", err)
+	}
+
+	base := records[0].LogTime
+	// время в запросе может быть не в UTC
+	offset := time.FixedZone("UTC+3", 3*60*60)
+	cases := []struct {
+		name  string
+		query entity.LogQuery
+	}{
+		{"time range", entity.LogQuery{TimeFrom: base.Add(3 * time.Minute), TimeTo: base.Add(9 * time.Minute)}},
+		{"time range with offset", entity.LogQuery{TimeFrom: base.Add(3 * time.Minute).In(offset), TimeTo: base.Add(9 * time.Minute).In(offset)}},
+		{"levels", entity.LogQuery{Levels: []int{entity.LevelDebug, entity.LevelError}}},
+		{"min and max level", entity.LogQuery{MinLevel: entity.LevelInfo, MaxLevel: entity.LevelWarn}},
+		{"hosts", entity.LogQuery{Hosts: []string{"host-b"}}},
+		{"sources", entity.LogQuery{Sources: []string{"app-a", "app-c"}}},
+		{"message", entity.LogQuery{Message: "needle"}},
+		{"message special chars", entity.LogQuery{Message: "100%_done"}},
+		{"combined", entity.LogQuery{TimeFrom: base.Add(2 * time.Minute), MinLevel: entity.LevelInfo, Sources: []string{"app-a"}}},
+	}
+	for _, c := range cases {
+		found, limited, err := repo.Find(ctx, c.query)
+		if err != nil {
+			return fmt.Errorf("find %s: %w", c.name, err)
+		}
+		if limited {
+			return fmt.Errorf("find %s: limited is set for %d records", c.name, len(found))
+		}
+		if err := checkRecords(found, filter(records, c.query)); err != nil {
+			return fmt.Errorf("find %s: %w", c.name, err)
+		}
+	}
+
+	found, limited, err := repo.Find(ctx, entity.LogQuery{Limit: 5})
+	if err != nil {
+		return fmt.Errorf("find limit: %w", err)
+	}
+	if !limited {
+		return fmt.Errorf("find limit: limited is not set")
+	}
+	if err := checkRecords(found, newest(records, 5)); err != nil {
+		return fmt.Errorf("find limit: %w", err)
+	}
+
+	// постраничная выборка должна вернуть все записи без повторов и пропусков
+	var pages []entity.LogRecord
+	query := entity.LogQuery{Limit: 4}
+	for page := 0; ; page++ {
+		if page > len(records) {
+			return fmt.Errorf("find pages: cursor does not advance")
+		}
+
+		found, limited, err := repo.Find(ctx, query)
+		if err != nil {
+			return fmt.Errorf("find pages: %w", err)
+		}
+		pages = append(pages, found...)
+		if !limited {
+			break
+		}
+		query.Cursor = entity.NewLogCursor(found[len(found)-1])
+		query.Cursor.LogTime = query.Cursor.LogTime.In(offset)
+	}
+	if err := checkRecords(pages, records); err != nil {
+		return fmt.Errorf("find pages: %w", err)
+	}
+
+	return checkCounts(ctx, repo, records)
+}
+
+// checkCounts Подсчет записей по группам
+func checkCounts(ctx context.Context, repo usecase.LogInterface, records []entity.LogRecord) error {
+	base := records[0].LogTime
+	cases := []struct {
+		group string
+		query entity.LogQuery
+		key   func(r entity.LogRecord) string
+	}{
+		{entity.LogGroupLevel, entity.LogQuery{}, func(r entity.LogRecord) string { return strconv.Itoa(r.Level) }},
+		{entity.LogGroupHost, entity.LogQuery{MinLevel: entity.LevelWarn}, func(r entity.LogRecord) string { return r.Host }},
+		{entity.LogGroupSource, entity.LogQuery{Message: "needle"}, func(r entity.LogRecord) string { return r.Source }},
+		{entity.LogGroupHour, entity.LogQuery{TimeFrom: base}, func(r entity.LogRecord) string {
+			return r.LogTime.UTC().Truncate(time.Hour).Format(time.RFC3339)
+		}},
+		{entity.LogGroupDay, entity.LogQuery{Limit: 1}, func(r entity.LogRecord) string {
+			t := r.LogTime.UTC()
+
+			return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC).Format(time.RFC3339)
+		}},
+	}
+
+	for _, c := range cases {
+		expected := make(map[string]uint64)
+		for _, r := range filter(records, c.query) {
+			expected[c.key(r)]++
+		}
+
+		counts, err := repo.Count(ctx, c.query, c.group)
+		if err != nil {
+			return fmt.Errorf("count %s: %w", c.group, err)
+		}
+
+		if len(counts) != len(expected) {
+			return fmt.Errorf("count %s: expected %v, got %v", c.group, expected, counts)
+		}
+		for i, count := range counts {
+			if expected[count.Key] != count.Count {
+				return fmt.Errorf("count %s: expected %v, got %v", c.group, expected, counts)
+			}
+			if i > 0 && counts[i-1].Key >= count.Key {
+				return fmt.Errorf("count %s: groups are not ordered by key: %v", c.group, counts)
+			}
+		}
+	}
+
+	return nil
+}
+
+// testRecords Записи с разным временем, чтобы их порядок не зависел от ID. Время с точностью до секунды,
+// т.к. хранилища могут хранить его с разной точностью
+func testRecords() []entity.LogRecord {
+	base := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	hosts := []string{"host-a", "host-b"}
+	sources := []string{"app-a", "app-b", "app-c"}
+
+	// время не по порядку: хранилище должно упорядочить записи само
+	offsets := []int{7, 2, 11, 0, 5, 9, 1, 12, 4, 8, 3, 10, 6}
+
+	records := make([]entity.LogRecord, 0, len(offsets))
+	for i, offset := range offsets {
+		r := entity.LogRecord{
+			ID:       0,
+			LogTime:  base.Add(time.Duration(offset) * time.Minute),
+			RealTime: time.Time{},
+			Level:    entity.LevelDebug + i%5,
+			Host:     hosts[i%len(hosts)],
+			Source:   sources[i%len(sources)],
+			Message1: fmt.Sprintf("record %02d", i),
+			Message2: "",
+			Message3: "",
+		}
+
+		switch i % 4 {
+		case 1:
+			r.Message2 = "has NEEDLE inside"
+		case 2:
+			r.Message3 = "Needle"
+		}
+		if i == 3 {
+			r.Message2 = "100%_done"
+		}
+		if i == 4 {
+			// символы шаблона LIKE должны искаться как обычные символы
+			r.Message2 = "1000 done"
+		}
+
+		records = append(records, r)
+	}
+
+	return records
+}
+
+// filter Записи, которые должно вернуть хранилище
+func filter(records []entity.LogRecord, q entity.LogQuery) []entity.LogRecord {
+	var res []entity.LogRecord
+
+	for _, r := range records {
+		if !q.TimeFrom.IsZero() && r.LogTime.Before(q.TimeFrom) ||
+			!q.TimeTo.IsZero() && r.LogTime.After(q.TimeTo) ||
+			len(q.Levels) > 0 && !containsInt(q.Levels, r.Level) ||
+			q.MinLevel > 0 && r.Level < q.MinLevel ||
+			q.MaxLevel > 0 && r.Level > q.MaxLevel ||
+			len(q.Hosts) > 0 && !containsString(q.Hosts, r.Host) ||
+			len(q.Sources) > 0 && !containsString(q.Sources, r.Source) {
+			continue
+		}
+
+		if q.Message != "" {
+			m := strings.ToLower(q.Message)
+			if !strings.Contains(strings.ToLower(r.Message1), m) &&
+				!strings.Contains(strings.ToLower(r.Message2), m) &&
+				!strings.Contains(strings.ToLower(r.Message3), m) {
+				continue
+			}
+		}
+
+		res = append(res, r)
+	}
+
+	return res
+}
+
+// newest n самых новых записей
+func newest(records []entity.LogRecord, n int) []entity.LogRecord {
+	sorted := sortByTime(records)
+	if len(sorted) > n {
+		sorted = sorted[:n]
+	}
+
+	return sorted
+}
+
+func sortByTime(records []entity.LogRecord) []entity.LogRecord {
+	sorted := make([]entity.LogRecord, len(records))
+	copy(sorted, records)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].LogTime.After(sorted[j].LogTime)
+	})
+
+	return sorted
+}
+
+// checkRecords Найденные записи совпадают с ожидаемыми и упорядочены по убыванию времени
+func checkRecords(found []entity.LogRecord, expected []entity.LogRecord) error {
+	expected = sortByTime(expected)
+
+	if len(found) != len(expected) {
+		return fmt.Errorf("expected %d records, got %d: %s", len(expected), len(found), messages(found))
+	}
+
+	ids := make(map[uint64]bool, len(found))
+	for i, f := range found {
+		e := expected[i]
+
+		if f.ID == 0 || ids[f.ID] {
+			return fmt.Errorf("record %q: ID %d is empty or not unique", f.Message1, f.ID)
+		}
+		ids[f.ID] = true
+
+		if f.Message1 != e.Message1 {
+			return fmt.Errorf("record %d: expected %q, got %q. Records: %s", i, e.Message1, f.Message1, messages(found))
+		}
+		if !f.LogTime.Equal(e.LogTime) || f.Level != e.Level || f.Host != e.Host || f.Source != e.Source ||
+			f.Message2 != e.Message2 || f.Message3 != e.Message3 {
+			return fmt.Errorf("record %q: stored as %+v, expected %+v", e.Message1, f, e)
+		}
+		if f.RealTime.IsZero() {
+			return fmt.Errorf("record %q: RealTime is not set", e.Message1)
+		}
+	}
+
+	return nil
+}
+
+func messages(records []entity.LogRecord) string {
+	m := make([]string, 0, len(records))
+	for _, r := range records {
+		m = append(m, r.Message1)
+	}
+
+	return strings.Join(m, ", ")
+}
+
+func containsInt(values []int, v int) bool {
+	for _, x := range values {
+		if x == v {
+			return true
+		}
+	}
+
+	return false
+}
+
+func containsString(values []string, v string) bool {
+	for _, x := range values {
+		if x == v {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,115 @@
+// Package psql Содержит реализацию журнала аудита в postgres
+package psql
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/n-r-w/log-server-v2/internal/domain/entity"
+	"github.com/n-r-w/log-server-v2/pkg/postgres"
+)
+
+type auditRepo struct {
+	*postgres.Postgres
+	maxResult int
+}
+
+func NewAudit(pg *postgres.Postgres, maxResult int) *auditRepo {
+	return &auditRepo{
+		Postgres:  pg,
+		maxResult: maxResult,
+	}
+}
+
+// Insert Добавить событие
+func (r *auditRepo) Insert(ctx context.Context, event entity.AuditEvent) error {
+	ctx, cancel := r.WithTimeout(ctx)
+	defer cancel()
+
+	_, err := r.Pool.Exec(ctx,
+		`INSERT INTO audit (event_time, actor_id, actor, action, target, address, request_id, result, details) 
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		event.Time.UTC(),
+		event.ActorID,
+		event.Actor,
+		event.Action,
+		event.Target,
+		event.Address,
+		event.RequestID,
+		event.Result,
+		event.Details,
+	)
+
+	return err
+}
+
+// Find Поиск событий. Последние события в начале. Может выполняться на реплике
+func (r *auditRepo) Find(ctx context.Context, query entity.AuditQuery) ([]entity.AuditEvent, error) {
+	ctx, cancel := r.WithTimeout(ctx)
+	defer cancel()
+
+	limit := query.Limit
+	if limit <= 0 || limit > r.maxResult {
+		limit = r.maxResult
+	}
+
+	where, args := auditCondition(query)
+	args = append(args, limit)
+
+	rows, err := r.ReadPool().Query(ctx,
+		`SELECT id, event_time, actor_id, actor, action, target, address, request_id, result, details 
+		FROM audit
+		WHERE `+where+`
+		ORDER BY event_time DESC, id DESC
+		LIMIT $`+strconv.Itoa(len(args)),
+		args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close() // освобождаем контекст sql запроса при выходе
+
+	var events []entity.AuditEvent
+
+	for rows.Next() {
+		var e entity.AuditEvent
+		if err = rows.Scan(&e.ID, &e.Time, &e.ActorID, &e.Actor, &e.Action, &e.Target,
+			&e.Address, &e.RequestID, &e.Result, &e.Details); err != nil {
+			return nil, err
+		}
+
+		events = append(events, e)
+	}
+
+	rows.Close()
+
+	return events, rows.Err()
+}
+
+// auditCondition Условие WHERE для поиска событий и его параметры
+func auditCondition(query entity.AuditQuery) (where string, args []interface{}) {
+	conditions := []string{"TRUE"}
+
+	add := func(condition string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, strings.Replace(condition, "?", "$"+strconv.Itoa(len(args)), 1))
+	}
+
+	if !query.TimeFrom.IsZero() {
+		add("event_time >= ?", query.TimeFrom.UTC())
+	}
+	if !query.TimeTo.IsZero() {
+		add("event_time <= ?", query.TimeTo.UTC())
+	}
+	if query.Actor != "" {
+		add("actor = ?", query.Actor)
+	}
+	if query.Action != "" {
+		add("action = ?", query.Action)
+	}
+	if query.Target != "" {
+		add("target = ?", query.Target)
+	}
+
+	return strings.Join(conditions, " AND "), args
+}
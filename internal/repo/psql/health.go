@@ -0,0 +1,53 @@
+// Package psql Содержит реализацию проверки состояния БД
+package psql
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/n-r-w/log-server-v2/internal/domain/entity"
+	"github.com/n-r-w/log-server-v2/pkg/postgres"
+)
+
+type healthRepo struct {
+	*postgres.Postgres
+}
+
+func NewHealth(pg *postgres.Postgres) *healthRepo {
+	return &healthRepo{
+		Postgres: pg,
+	}
+}
+
+// Health Состояние основного сервера и реплик. Реплики называются по номеру, а не по адресу,
+// т.к. состояние доступно без аутентификации
+func (r *healthRepo) Health(ctx context.Context) []entity.ComponentHealth {
+	components := make([]entity.ComponentHealth, 0, len(r.Replicas())+1)
+
+	db := entity.ComponentHealth{
+		Name:    "database",
+		Status:  entity.HealthOK,
+		Details: "",
+	}
+	if breaker := r.Breaker(); breaker.Open {
+		db.Status = entity.HealthUnavailable
+		db.Details = fmt.Sprintf("unavailable since %s, requests are rejected", breaker.Since.UTC().Format(time.RFC3339))
+	}
+	components = append(components, db)
+
+	for i, replica := range r.Replicas() {
+		c := entity.ComponentHealth{
+			Name:    fmt.Sprintf("database replica %d", i+1),
+			Status:  entity.HealthOK,
+			Details: "",
+		}
+		if !replica.Healthy {
+			c.Status = entity.HealthDegraded
+			c.Details = "unavailable or lags behind, reading from primary"
+		}
+		components = append(components, c)
+	}
+
+	return components
+}
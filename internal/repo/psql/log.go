@@ -4,6 +4,8 @@ package psql
 import (
 	"context"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/jackc/pgx/v4"
@@ -14,12 +16,18 @@ import (
 type logRepo struct {
 	*postgres.Postgres
 	maxLogRecordsResult int
+	insertTimeout       time.Duration
+	findTimeout         time.Duration
 }
 
-func NewLog(pg *postgres.Postgres, maxLogRecordsResult int) *logRepo {
+// NewLog Репозиторий журнала. Для записи и поиска задаются свои ограничения времени: поиск по большому журналу
+// может занимать намного больше времени, чем остальные запросы
+func NewLog(pg *postgres.Postgres, maxLogRecordsResult int, insertTimeout time.Duration, findTimeout time.Duration) *logRepo {
 	return &logRepo{
 		Postgres:            pg,
 		maxLogRecordsResult: maxLogRecordsResult,
+		insertTimeout:       insertTimeout,
+		findTimeout:         findTimeout,
 	}
 }
 
@@ -27,35 +35,55 @@ func (p *logRepo) PoolSize() int {
 	return int(p.Pool.Stat().TotalConns())
 }
 
-func (p *logRepo) Insert(records []entity.LogRecord) error {
-	var sqlText string
+// Insert Пакет записывается через COPY: значения передаются отдельно от запроса, поэтому любые символы
+// в сообщениях безопасны, а запись большого пакета быстрее отдельных INSERT
+func (p *logRepo) Insert(ctx context.Context, records []entity.LogRecord) error {
+	rows := make([][]interface{}, 0, len(records))
 
 	for _, lr := range records {
 		if err := lr.Validate(); err != nil {
 			return err
 		}
 
-		t, _ := lr.LogTime.UTC().MarshalText()
-		sqlText += fmt.Sprintf(`INSERT INTO log (record_timestamp, level, message1, message2, message3) 
-		 					    VALUES ('%s', %d, '%s', '%s', '%s');`,
-			t, lr.Level, lr.Message1, lr.Message2, lr.Message3)
+		rows = append(rows, []interface{}{
+			lr.LogTime.UTC(), lr.Level, lr.Host, lr.Source, lr.Message1, lr.Message2, lr.Message3,
+		})
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	if len(rows) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, p.insertTimeout)
 	defer cancel()
-	_, err := p.Pool.Exec(ctx, sqlText, pgx.QuerySimpleProtocol(true))
+	_, err := p.Pool.CopyFrom(ctx, pgx.Identifier{"log"},
+		[]string{"record_timestamp", "level", "host", "source", "message1", "message2", "message3"},
+		pgx.CopyFromRows(rows))
 
 	return err
 }
 
-func (p *logRepo) Find(dateFrom time.Time, dateTo time.Time, limit int) (records []entity.LogRecord, limited bool, err error) {
-	rows, err := p.Pool.Query(context.Background(),
-		`SELECT id, record_timestamp, real_timestamp, level,  message1, COALESCE(message2, ''), COALESCE(message3, '') 
+func (p *logRepo) Find(ctx context.Context, query entity.LogQuery) (records []entity.LogRecord, limited bool, err error) {
+	limit := query.Limit
+	if limit <= 0 || limit > p.maxLogRecordsResult {
+		limit = p.maxLogRecordsResult
+	}
+
+	where, args := findCondition(query)
+	args = append(args, limit+1)
+
+	ctx, cancel := context.WithTimeout(ctx, p.findTimeout)
+	defer cancel()
+
+	// поиск по журналу может выполняться на реплике: только что записанные логи могут найтись не сразу
+	rows, err := p.ReadPool().Query(ctx,
+		`SELECT id, record_timestamp, real_timestamp, level, COALESCE(host, ''), COALESCE(source, ''),
+			message1, COALESCE(message2, ''), COALESCE(message3, '') 
 		FROM log
-		WHERE ($1 OR record_timestamp >= $2) AND ($3 OR record_timestamp <= $4)
-		ORDER BY record_timestamp DESC
-		LIMIT $5`,
-		dateFrom.IsZero(), dateFrom, dateTo.IsZero(), dateTo, limit+1)
+		WHERE `+where+`
+		ORDER BY record_timestamp DESC, id DESC
+		LIMIT $`+strconv.Itoa(len(args)),
+		args...)
 	if err != nil {
 		return nil, false, err
 	}
@@ -70,7 +98,7 @@ func (p *logRepo) Find(dateFrom time.Time, dateTo time.Time, limit int) (records
 		var record entity.LogRecord
 
 		if err := rows.Scan(&record.ID, &record.LogTime, &record.RealTime,
-			&record.Level, &record.Message1, &record.Message2, &record.Message3); err != nil {
+			&record.Level, &record.Host, &record.Source, &record.Message1, &record.Message2, &record.Message3); err != nil {
 			return nil, false, err
 		}
 
@@ -90,9 +118,108 @@ func (p *logRepo) Find(dateFrom time.Time, dateTo time.Time, limit int) (records
 		recs = append(recs, record)
 	}
 
-	// при rows.Scan может быть ошибка и тогда defer rows.Close() не вызовется
-	// поэтому надежнее сделать как defer rows.Close(), так и прямое закрытие здесь
-	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, false, err
+	}
 
 	return recs, limited, nil
 }
+
+// Выражения для группировки при подсчете записей
+var countKeys = map[string]string{
+	entity.LogGroupLevel:  "level::text",
+	entity.LogGroupHost:   "COALESCE(host, '')",
+	entity.LogGroupSource: "COALESCE(source, '')",
+	entity.LogGroupHour:   `to_char(date_trunc('hour', record_timestamp), 'YYYY-MM-DD"T"HH24:00:00"Z"')`,
+	entity.LogGroupDay:    `to_char(date_trunc('day', record_timestamp), 'YYYY-MM-DD"T00:00:00Z"')`,
+}
+
+func (p *logRepo) Count(ctx context.Context, query entity.LogQuery, group string) ([]entity.LogCount, error) {
+	key, ok := countKeys[group]
+	if !ok {
+		return nil, fmt.Errorf("unknown log group %q", group)
+	}
+
+	query.Cursor = nil
+	where, args := findCondition(query)
+
+	ctx, cancel := context.WithTimeout(ctx, p.findTimeout)
+	defer cancel()
+
+	// COLLATE "C" - побайтное сравнение, как и в остальных хранилищах
+	rows, err := p.ReadPool().Query(ctx,
+		`SELECT `+key+`, count(*)
+		FROM log
+		WHERE `+where+`
+		GROUP BY 1
+		ORDER BY `+key+` COLLATE "C"`,
+		args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var counts []entity.LogCount
+	for rows.Next() {
+		var (
+			c     entity.LogCount
+			count int64
+		)
+		if err := rows.Scan(&c.Key, &count); err != nil {
+			return nil, err
+		}
+		c.Count = uint64(count)
+
+		counts = append(counts, c)
+	}
+
+	return counts, rows.Err()
+}
+
+// findCondition Условие WHERE для поиска и его параметры
+func findCondition(query entity.LogQuery) (where string, args []interface{}) {
+	conditions := []string{"TRUE"}
+
+	add := func(condition string, values ...interface{}) {
+		for _, v := range values {
+			args = append(args, v)
+			condition = strings.Replace(condition, "?", "$"+strconv.Itoa(len(args)), 1)
+		}
+		conditions = append(conditions, condition)
+	}
+
+	// record_timestamp - timestamp without time zone в UTC, как и при записи
+	if !query.TimeFrom.IsZero() {
+		add("record_timestamp >= ?", query.TimeFrom.UTC())
+	}
+	if !query.TimeTo.IsZero() {
+		add("record_timestamp <= ?", query.TimeTo.UTC())
+	}
+	if len(query.Levels) > 0 {
+		add("level = ANY(?)", query.Levels)
+	}
+	if query.MinLevel > 0 {
+		add("level >= ?", query.MinLevel)
+	}
+	if query.MaxLevel > 0 {
+		add("level <= ?", query.MaxLevel)
+	}
+	if len(query.Hosts) > 0 {
+		add("host = ANY(?)", query.Hosts)
+	}
+	if len(query.Sources) > 0 {
+		add("source = ANY(?)", query.Sources)
+	}
+	if query.Message != "" {
+		pattern := "%" + likeEscaper.Replace(query.Message) + "%"
+		add("(message1 ILIKE ? OR message2 ILIKE ? OR message3 ILIKE ?)", pattern, pattern, pattern)
+	}
+	if query.Cursor != nil {
+		add("(record_timestamp, id) < (?, ?)", query.Cursor.LogTime.UTC(), query.Cursor.ID)
+	}
+
+	return strings.Join(conditions, " AND "), args
+}
+
+// Экранирование спецсимволов шаблона LIKE
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
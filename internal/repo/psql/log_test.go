@@ -0,0 +1,134 @@
+package psql
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/n-r-w/log-server-v2/internal/domain/entity"
+	"github.com/n-r-w/log-server-v2/internal/repo/logtest"
+	"github.com/n-r-w/log-server-v2/pkg/logger"
+	"github.com/n-r-w/log-server-v2/pkg/postgres"
+)
+
+// Адрес БД для тестов. Тесты создают в ней отдельную схему и удаляют ее после завершения
+const testDatabaseEnv = "LS_TEST_DATABASE_URL"
+
+// Миграции таблицы журнала
+var logMigrations = []string{
+	"20220422_create_log_up.sql",
+	"20221019_add_log_source_up.sql",
+}
+
+// newTestPostgres Подключение к пустой схеме с таблицей журнала. Тест пропускается, если БД не задана или недоступна
+func newTestPostgres(t *testing.T) *postgres.Postgres {
+	t.Helper()
+
+	url := os.Getenv(testDatabaseEnv)
+	if url == "" {
+		t.Skipf("%s is not set", testDatabaseEnv)
+	}
+
+	schema := fmt.Sprintf("logtest_%d", time.Now().UnixNano())
+
+	admin, err := postgres.New(url, logger.New(), postgres.ConnAttempts(1), postgres.ConnTimeout(time.Second*3))
+	if err != nil {
+		t.Skipf("database is not available: %v", err)
+	}
+	defer admin.Close()
+
+	ctx := context.Background()
+	if _, err := admin.Pool.Exec(ctx, "CREATE SCHEMA "+schema); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		admin, err := postgres.New(url, logger.New(), postgres.ConnAttempts(1))
+		if err != nil {
+			t.Errorf("drop schema %s: %v", schema, err)
+
+			return
+		}
+		defer admin.Close()
+
+		if _, err := admin.Pool.Exec(context.Background(), "DROP SCHEMA "+schema+" CASCADE"); err != nil {
+			t.Errorf("drop schema %s: %v", schema, err)
+		}
+	})
+
+	for _, name := range logMigrations {
+		sql, err := os.ReadFile(filepath.Join("..", "..", "..", "migration", "up", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := admin.Pool.Exec(ctx, strings.ReplaceAll(string(sql), "public.", schema+".")); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+	}
+
+	if strings.Contains(url, "://") {
+		if strings.Contains(url, "?") {
+			url += "&search_path=" + schema
+		} else {
+			url += "?search_path=" + schema
+		}
+	} else {
+		url += " search_path=" + schema
+	}
+
+	pg, err := postgres.New(url, logger.New(), postgres.ConnAttempts(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pg.Close)
+
+	return pg
+}
+
+func TestLogInsertSpecialCharacters(t *testing.T) {
+	repo := NewLog(newTestPostgres(t), 100, time.Second*10, time.Second*10)
+	ctx := context.Background()
+
+	record := entity.LogRecord{
+		ID:       0,
+		LogTime:  time.Date(2022, 10, 26, 12, 0, 0, 0, time.UTC),
+		RealTime: time.Time{},
+		Level:    entity.LevelError,
+		Host:     "host'; DROP TABLE log; --",
+		Source:   "it's",
+		Message1: "'); DELETE FROM log; --",
+		Message2: `\'; "quoted"`,
+		Message3: ";",
+	}
+	records := []entity.LogRecord{record, record}
+	records[1].Message1 = "second"
+
+	if err := repo.Insert(ctx, records); err != nil {
+		t.Fatal(err)
+	}
+
+	found, _, err := repo.Find(ctx, entity.LogQuery{Hosts: []string{record.Host}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 2 {
+		t.Fatalf("expected 2 records, got %d", len(found))
+	}
+
+	got := found[1]
+	if got.Host != record.Host || got.Source != record.Source || got.Message1 != record.Message1 ||
+		got.Message2 != record.Message2 || got.Message3 != record.Message3 || !got.LogTime.Equal(record.LogTime) {
+		t.Fatalf("record changed: %+v", got)
+	}
+}
+
+func TestLogConformance(t *testing.T) {
+	repo := NewLog(newTestPostgres(t), logtest.MinRecordsResult, time.Second*10, time.Second*10)
+
+	if err := logtest.Conformance(context.Background(), repo); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,97 @@
+// Package psql Содержит реализацию хранилища незавершенных входов в postgres
+package psql
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/n-r-w/log-server-v2/internal/domain/entity"
+	"github.com/n-r-w/log-server-v2/pkg/postgres"
+)
+
+type loginChallengeRepo struct {
+	*postgres.Postgres
+}
+
+func NewLoginChallenge(pg *postgres.Postgres) *loginChallengeRepo {
+	return &loginChallengeRepo{
+		Postgres: pg,
+	}
+}
+
+// Insert Добавить незавершенный вход
+func (r *loginChallengeRepo) Insert(ctx context.Context, challenge entity.LoginChallenge) error {
+	ctx, cancel := r.WithTimeout(ctx)
+	defer cancel()
+
+	_, err := r.Pool.Exec(ctx,
+		"INSERT INTO login_challenges (id, user_id, expires_at, attempts) VALUES ($1, $2, $3, $4)",
+		challenge.ID, challenge.UserID, challenge.ExpiresAt.UTC(), challenge.Attempts)
+
+	return err
+}
+
+// FindByID Поиск по ID
+func (r *loginChallengeRepo) FindByID(ctx context.Context, challengeID string) (entity.LoginChallenge, error) {
+	ctx, cancel := r.WithTimeout(ctx)
+	defer cancel()
+
+	var c entity.LoginChallenge
+	if err := r.Pool.QueryRow(ctx,
+		"SELECT id, user_id, expires_at, attempts FROM login_challenges WHERE id = $1",
+		challengeID,
+	).Scan(
+		&c.ID,
+		&c.UserID,
+		&c.ExpiresAt,
+		&c.Attempts,
+	); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return entity.LoginChallenge{}, nil
+		}
+
+		return entity.LoginChallenge{}, err
+	}
+
+	return c, nil
+}
+
+// AddAttempt Учесть неверный код
+func (r *loginChallengeRepo) AddAttempt(ctx context.Context, challengeID string) (int, error) {
+	ctx, cancel := r.WithTimeout(ctx)
+	defer cancel()
+
+	var attempts int
+	err := r.Pool.QueryRow(ctx,
+		"UPDATE login_challenges SET attempts = attempts + 1 WHERE id = $1 RETURNING attempts",
+		challengeID,
+	).Scan(&attempts)
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, nil
+	}
+
+	return attempts, err
+}
+
+// Remove Удалить незавершенный вход
+func (r *loginChallengeRepo) Remove(ctx context.Context, challengeID string) error {
+	ctx, cancel := r.WithTimeout(ctx)
+	defer cancel()
+
+	_, err := r.Pool.Exec(ctx, "DELETE FROM login_challenges WHERE id = $1", challengeID)
+
+	return err
+}
+
+// RemoveExpired Удалить истекшие записи
+func (r *loginChallengeRepo) RemoveExpired(ctx context.Context, now time.Time) error {
+	ctx, cancel := r.WithTimeout(ctx)
+	defer cancel()
+
+	_, err := r.Pool.Exec(ctx, "DELETE FROM login_challenges WHERE expires_at <= $1", now.UTC())
+
+	return err
+}
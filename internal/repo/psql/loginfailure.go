@@ -0,0 +1,113 @@
+// Package psql Содержит реализацию хранилища неудачных попыток входа в postgres
+package psql
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/n-r-w/log-server-v2/internal/domain/entity"
+	"github.com/n-r-w/log-server-v2/pkg/postgres"
+)
+
+type loginFailureRepo struct {
+	*postgres.Postgres
+}
+
+func NewLoginFailure(pg *postgres.Postgres) *loginFailureRepo {
+	return &loginFailureRepo{
+		Postgres: pg,
+	}
+}
+
+// Find Поиск по ключу
+func (r *loginFailureRepo) Find(ctx context.Context, key string) (entity.LoginFailure, error) {
+	ctx, cancel := r.WithTimeout(ctx)
+	defer cancel()
+
+	var f entity.LoginFailure
+	if err := r.Pool.QueryRow(ctx,
+		"SELECT key, failures, last_failure, locked_until FROM login_failures WHERE key = $1",
+		key,
+	).Scan(
+		&f.Key,
+		&f.Failures,
+		&f.LastFailure,
+		&f.LockedUntil,
+	); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return entity.LoginFailure{}, nil
+		}
+
+		return entity.LoginFailure{}, err
+	}
+
+	return f, nil
+}
+
+// AddFailure Учесть неудачную попытку. Счетчик увеличивается одним запросом, чтобы параллельные попытки
+// не затирали друг друга. Если предыдущая неудача была раньше resetBefore, то счет начинается заново
+func (r *loginFailureRepo) AddFailure(ctx context.Context, key string, now time.Time, resetBefore time.Time) (entity.LoginFailure, error) {
+	ctx, cancel := r.WithTimeout(ctx)
+	defer cancel()
+
+	var f entity.LoginFailure
+	err := r.Pool.QueryRow(ctx,
+		`INSERT INTO login_failures AS f (key, failures, last_failure, locked_until) 
+		VALUES ($1, 1, $2, $2)
+		ON CONFLICT (key) DO UPDATE SET
+			failures = CASE WHEN f.last_failure < $3 THEN 1 ELSE f.failures + 1 END,
+			last_failure = $2
+		RETURNING key, failures, last_failure, locked_until`,
+		key, now.UTC(), resetBefore.UTC(),
+	).Scan(
+		&f.Key,
+		&f.Failures,
+		&f.LastFailure,
+		&f.LockedUntil,
+	)
+
+	return f, err
+}
+
+// SubtractFailure Отменить попытку, учтенную AddFailure, но оказавшуюся успешной или не завершившуюся
+func (r *loginFailureRepo) SubtractFailure(ctx context.Context, key string) error {
+	ctx, cancel := r.WithTimeout(ctx)
+	defer cancel()
+
+	_, err := r.Pool.Exec(ctx, "UPDATE login_failures SET failures = failures - 1 WHERE key = $1 AND failures > 0", key)
+
+	return err
+}
+
+// Lock Запретить вход до момента until
+func (r *loginFailureRepo) Lock(ctx context.Context, key string, until time.Time) error {
+	ctx, cancel := r.WithTimeout(ctx)
+	defer cancel()
+
+	_, err := r.Pool.Exec(ctx, "UPDATE login_failures SET locked_until = $1 WHERE key = $2", until.UTC(), key)
+
+	return err
+}
+
+// Remove Удалить информацию о неудачных попытках
+func (r *loginFailureRepo) Remove(ctx context.Context, key string) error {
+	ctx, cancel := r.WithTimeout(ctx)
+	defer cancel()
+
+	_, err := r.Pool.Exec(ctx, "DELETE FROM login_failures WHERE key = $1", key)
+
+	return err
+}
+
+// RemoveExpired Удалить записи, последняя неудача в которых была раньше before и блокировка которых уже снята
+func (r *loginFailureRepo) RemoveExpired(ctx context.Context, before time.Time) error {
+	ctx, cancel := r.WithTimeout(ctx)
+	defer cancel()
+
+	_, err := r.Pool.Exec(ctx,
+		"DELETE FROM login_failures WHERE last_failure < $1 AND locked_until < $1", before.UTC())
+
+	return err
+}
@@ -0,0 +1,129 @@
+// Package psql Содержит реализацию хранилища сессий пользователей в postgres
+package psql
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/n-r-w/log-server-v2/internal/domain/entity"
+	"github.com/n-r-w/log-server-v2/pkg/postgres"
+)
+
+type sessionRepo struct {
+	*postgres.Postgres
+}
+
+func NewSession(pg *postgres.Postgres) *sessionRepo {
+	return &sessionRepo{
+		Postgres: pg,
+	}
+}
+
+// Insert Добавить сессию
+func (r *sessionRepo) Insert(ctx context.Context, session entity.Session) error {
+	ctx, cancel := r.WithTimeout(ctx)
+	defer cancel()
+
+	_, err := r.Pool.Exec(ctx,
+		`INSERT INTO sessions (id, user_id, created_at, expires_at, address, user_agent) 
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		session.ID,
+		session.UserID,
+		session.CreatedAt.UTC(),
+		session.ExpiresAt.UTC(),
+		session.Address,
+		session.UserAgent,
+	)
+
+	return err
+}
+
+// FindByID Поиск сессии по ID
+func (r *sessionRepo) FindByID(ctx context.Context, sessionID string) (entity.Session, error) {
+	ctx, cancel := r.WithTimeout(ctx)
+	defer cancel()
+
+	var s entity.Session
+	if err := r.Pool.QueryRow(ctx,
+		"SELECT id, user_id, created_at, expires_at, address, user_agent FROM sessions WHERE id = $1",
+		sessionID,
+	).Scan(
+		&s.ID,
+		&s.UserID,
+		&s.CreatedAt,
+		&s.ExpiresAt,
+		&s.Address,
+		&s.UserAgent,
+	); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return entity.Session{}, nil
+		}
+
+		return entity.Session{}, err
+	}
+
+	return s, nil
+}
+
+// FindByUser Действующие сессии пользователя
+func (r *sessionRepo) FindByUser(ctx context.Context, userID uint64, now time.Time) ([]entity.Session, error) {
+	ctx, cancel := r.WithTimeout(ctx)
+	defer cancel()
+
+	rows, err := r.Pool.Query(ctx,
+		`SELECT id, user_id, created_at, expires_at, address, user_agent FROM sessions 
+		WHERE user_id = $1 AND expires_at > $2
+		ORDER BY created_at DESC`,
+		userID, now.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close() // освобождаем контекст sql запроса при выходе
+
+	var sessions []entity.Session
+
+	for rows.Next() {
+		var s entity.Session
+		if err = rows.Scan(&s.ID, &s.UserID, &s.CreatedAt, &s.ExpiresAt, &s.Address, &s.UserAgent); err != nil {
+			return nil, err
+		}
+
+		sessions = append(sessions, s)
+	}
+
+	rows.Close()
+
+	return sessions, rows.Err()
+}
+
+// Remove Удалить сессию
+func (r *sessionRepo) Remove(ctx context.Context, sessionID string) error {
+	ctx, cancel := r.WithTimeout(ctx)
+	defer cancel()
+
+	_, err := r.Pool.Exec(ctx, "DELETE FROM sessions WHERE id = $1", sessionID)
+
+	return err
+}
+
+// RemoveByUser Удалить все сессии пользователя
+func (r *sessionRepo) RemoveByUser(ctx context.Context, userID uint64) error {
+	ctx, cancel := r.WithTimeout(ctx)
+	defer cancel()
+
+	_, err := r.Pool.Exec(ctx, "DELETE FROM sessions WHERE user_id = $1", userID)
+
+	return err
+}
+
+// RemoveExpired Удалить истекшие сессии
+func (r *sessionRepo) RemoveExpired(ctx context.Context, now time.Time) error {
+	ctx, cancel := r.WithTimeout(ctx)
+	defer cancel()
+
+	_, err := r.Pool.Exec(ctx, "DELETE FROM sessions WHERE expires_at <= $1", now.UTC())
+
+	return err
+}
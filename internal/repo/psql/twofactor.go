@@ -0,0 +1,148 @@
+// Package psql Содержит реализацию хранилища вторых факторов пользователей в postgres
+package psql
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/n-r-w/log-server-v2/internal/domain/entity"
+	"github.com/n-r-w/log-server-v2/pkg/postgres"
+)
+
+type twoFactorRepo struct {
+	*postgres.Postgres
+}
+
+func NewTwoFactor(pg *postgres.Postgres) *twoFactorRepo {
+	return &twoFactorRepo{
+		Postgres: pg,
+	}
+}
+
+// Find Поиск по пользователю
+func (r *twoFactorRepo) Find(ctx context.Context, userID uint64) (entity.TOTP, error) {
+	ctx, cancel := r.WithTimeout(ctx)
+	defer cancel()
+
+	var t entity.TOTP
+	if err := r.Pool.QueryRow(ctx,
+		"SELECT user_id, secret, enabled, last_step, recovery_codes FROM user_totp WHERE user_id = $1",
+		userID,
+	).Scan(
+		&t.UserID,
+		&t.Secret,
+		&t.Enabled,
+		&t.LastStep,
+		&t.RecoveryCodes,
+	); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return entity.TOTP{}, nil
+		}
+
+		return entity.TOTP{}, err
+	}
+
+	return t, nil
+}
+
+// Save Добавить или заменить запись пользователя
+func (r *twoFactorRepo) Save(ctx context.Context, totp entity.TOTP) error {
+	ctx, cancel := r.WithTimeout(ctx)
+	defer cancel()
+
+	codes := totp.RecoveryCodes
+	if codes == nil {
+		codes = []string{}
+	}
+
+	_, err := r.Pool.Exec(ctx,
+		`INSERT INTO user_totp (user_id, secret, enabled, last_step, recovery_codes) 
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (user_id) DO UPDATE SET
+			secret = EXCLUDED.secret,
+			enabled = EXCLUDED.enabled,
+			last_step = EXCLUDED.last_step,
+			recovery_codes = EXCLUDED.recovery_codes`,
+		totp.UserID, totp.Secret, totp.Enabled, totp.LastStep, codes)
+
+	return err
+}
+
+// Remove Удалить второй фактор пользователя
+func (r *twoFactorRepo) Remove(ctx context.Context, userID uint64) error {
+	ctx, cancel := r.WithTimeout(ctx)
+	defer cancel()
+
+	_, err := r.Pool.Exec(ctx, "DELETE FROM user_totp WHERE user_id = $1", userID)
+
+	return err
+}
+
+// UseStep Принять код периода step. Проверка и обновление выполняются одним запросом, поэтому
+// один и тот же код не будет принят дважды даже при параллельных запросах
+func (r *twoFactorRepo) UseStep(ctx context.Context, userID uint64, step int64) (bool, error) {
+	ctx, cancel := r.WithTimeout(ctx)
+	defer cancel()
+
+	tag, err := r.Pool.Exec(ctx,
+		"UPDATE user_totp SET last_step = $2 WHERE user_id = $1 AND last_step < $2",
+		userID, step)
+	if err != nil {
+		return false, err
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+// UseRecoveryCode Удалить резервный код. Каждый код действует один раз
+func (r *twoFactorRepo) UseRecoveryCode(ctx context.Context, userID uint64, codeHash string) (bool, error) {
+	ctx, cancel := r.WithTimeout(ctx)
+	defer cancel()
+
+	tag, err := r.Pool.Exec(ctx,
+		"UPDATE user_totp SET recovery_codes = array_remove(recovery_codes, $2) WHERE user_id = $1 AND $2 = ANY(recovery_codes)",
+		userID, codeHash)
+	if err != nil {
+		return false, err
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+// GetPolicies Правила обязательности второго фактора. Роли, для которых правило не задано, не возвращаются
+func (r *twoFactorRepo) GetPolicies(ctx context.Context) ([]entity.TwoFactorPolicy, error) {
+	ctx, cancel := r.WithTimeout(ctx)
+	defer cancel()
+
+	rows, err := r.Pool.Query(ctx, "SELECT role, required FROM two_factor_policy ORDER BY role")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var policies []entity.TwoFactorPolicy
+	for rows.Next() {
+		var p entity.TwoFactorPolicy
+		if err = rows.Scan(&p.Role, &p.Required); err != nil {
+			return nil, err
+		}
+
+		policies = append(policies, p)
+	}
+
+	return policies, rows.Err()
+}
+
+// SetPolicy Задать правило для роли
+func (r *twoFactorRepo) SetPolicy(ctx context.Context, policy entity.TwoFactorPolicy) error {
+	ctx, cancel := r.WithTimeout(ctx)
+	defer cancel()
+
+	_, err := r.Pool.Exec(ctx,
+		`INSERT INTO two_factor_policy (role, required) VALUES ($1, $2)
+		ON CONFLICT (role) DO UPDATE SET required = EXCLUDED.required`,
+		policy.Role, policy.Required)
+
+	return err
+}
@@ -3,13 +3,14 @@ package psql
 
 import (
 	"context"
-	"database/sql"
 	"errors"
 	"strings"
+	"sync"
 
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/jackc/pgx/v4"
 	"github.com/n-r-w/log-server-v2/internal/domain/entity"
 	"github.com/n-r-w/log-server-v2/internal/repo"
-	"github.com/n-r-w/log-server-v2/pkg/logger"
 	"github.com/n-r-w/log-server-v2/pkg/postgres"
 	"github.com/n-r-w/log-server-v2/pkg/tools"
 	"github.com/omeid/pgerror"
@@ -17,46 +18,64 @@ import (
 
 type userRepo struct {
 	*postgres.Postgres
-	logger             logger.Interface
-	superAdminID       uint64
-	superAdminLogin    string
-	superAdminPassword string
+	hasher *tools.PasswordHasher
 
+	mu                 sync.RWMutex
 	passwordRegex      string
 	passwordRegexError string
 }
 
-func NewUser(pg *postgres.Postgres, logger logger.Interface, superAdminID uint64, superAdminLogin string, superAdminPassword string,
-	passwordRegex string, passwordRegexError string) *userRepo {
+func NewUser(pg *postgres.Postgres, hasher *tools.PasswordHasher, passwordRegex string, passwordRegexError string) *userRepo {
 	return &userRepo{
 		Postgres:           pg,
-		logger:             logger,
-		superAdminID:       superAdminID,
-		superAdminLogin:    superAdminLogin,
-		superAdminPassword: superAdminPassword,
+		hasher:             hasher,
 		passwordRegex:      passwordRegex,
 		passwordRegexError: passwordRegexError,
 	}
 }
 
-// Insert Добавить нового пользвателя
-func (r *userRepo) Insert(user entity.User) error {
-	if user.ID == r.superAdminID || strings.EqualFold(user.Login, r.superAdminLogin) {
-		return repo.ErrCantChangeAdminUser
+// SetPasswordPolicy Изменить требования к паролю без перезапуска сервера
+func (r *userRepo) SetPasswordPolicy(passwordRegex string, passwordRegexError string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.passwordRegex = passwordRegex
+	r.passwordRegexError = passwordRegexError
+}
+
+// validate Проверка пользователя по текущим требованиям к паролю
+func (r *userRepo) validate(user *entity.User) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return user.Validate(r.passwordRegex, r.passwordRegexError)
+}
+
+// Insert Добавить нового пользвателя. Пароль, как и в ChangePassword, проверяется на соответствие правилам до хэширования
+func (r *userRepo) Insert(ctx context.Context, user entity.User) error {
+	user.Normalize()
+	if user.Password != "" {
+		user.EncryptedPassword = ""
 	}
 
-	if err := user.Prepare(true); err != nil {
+	if err := r.validate(&user); err != nil {
 		return err
 	}
 
-	if err := user.Validate(r.passwordRegex, r.passwordRegexError); err != nil {
+	if err := user.Prepare(r.hasher, true); err != nil {
 		return err
 	}
 
-	err := r.Pool.QueryRow(context.Background(),
-		"INSERT INTO users (login, name, encrypted_password) VALUES ($1, $2, $3) RETURNING id",
+	// хэширование пароля может занимать заметное время, поэтому ограничивается только сам запрос
+	ctx, cancel := r.WithTimeout(ctx)
+	defer cancel()
+
+	err := r.Pool.QueryRow(ctx,
+		"INSERT INTO users (login, name, role, auth_provider, encrypted_password) VALUES ($1, $2, $3, $4, $5) RETURNING id",
 		user.Login,
 		user.Name,
+		user.Role,
+		user.AuthProvider,
 		user.EncryptedPassword,
 	).Scan(&user.ID)
 	if err != nil {
@@ -71,21 +90,10 @@ func (r *userRepo) Insert(user entity.User) error {
 }
 
 // ChangePassword Изменить пароль пользователя
-func (r *userRepo) ChangePassword(userID uint64, password string) error {
-	if userID == r.superAdminID {
-		return repo.ErrCantChangeAdminPassword
-	}
-
+func (r *userRepo) ChangePassword(ctx context.Context, userID uint64, password string) error {
 	password = strings.TrimSpace(password)
-	enc, err := tools.EncryptPassword(password)
-
-	if err != nil {
-		return err
-	}
-
-	var user entity.User
-	user, err = r.FindByID(userID)
 
+	user, err := r.FindByID(ctx, userID)
 	if err != nil {
 		return err
 	}
@@ -95,50 +103,70 @@ func (r *userRepo) ChangePassword(userID uint64, password string) error {
 	}
 
 	user.Password = password
-	if err = user.Validate(r.passwordRegex, r.passwordRegexError); err != nil {
+	user.EncryptedPassword = ""
+	if err = r.validate(&user); err != nil {
 		return err
 	}
 
-	if err = user.Prepare(true); err != nil {
+	if err = user.Prepare(r.hasher, true); err != nil {
 		return err
 	}
 
-	_, err = r.Pool.Exec(context.Background(), "UPDATE users SET encrypted_password=$1 WHERE id=$2", enc, userID)
-	if err != nil {
-		if e := pgerror.UniqueViolation(err); e != nil {
-			return repo.ErrLoginExist
-		}
+	ctx, cancel := r.WithTimeout(ctx)
+	defer cancel()
 
-		return err
-	}
+	_, err = r.Pool.Exec(ctx, "UPDATE users SET encrypted_password=$1 WHERE id=$2", user.EncryptedPassword, userID)
 
-	return nil
+	return err
+}
+
+// UpdatePasswordHash Заменить хэш пароля без проверки самого пароля. Используется для перехода на новые
+// параметры хэширования, когда пароль уже проверен
+func (r *userRepo) UpdatePasswordHash(ctx context.Context, userID uint64, encryptedPassword string) error {
+	ctx, cancel := r.WithTimeout(ctx)
+	defer cancel()
+
+	_, err := r.Pool.Exec(ctx, "UPDATE users SET encrypted_password=$1 WHERE id=$2", encryptedPassword, userID)
+
+	return err
 }
 
 // FindByID Поиск пользователя по ID
-func (r *userRepo) FindByID(userID uint64) (entity.User, error) {
-	// не админ ли это?
-	if userID == r.superAdminID {
-		return r.AdminUser(), nil
-	}
+func (r *userRepo) FindByID(ctx context.Context, userID uint64) (entity.User, error) {
+	return r.findUser(ctx, "id = $1", userID)
+}
+
+// FindByLogin Поиск пользователя по логину
+func (r *userRepo) FindByLogin(ctx context.Context, login string) (entity.User, error) {
+	return r.findUser(ctx, "login = $1", strings.TrimSpace(login))
+}
+
+func (r *userRepo) findUser(ctx context.Context, condition string, value interface{}) (entity.User, error) {
+	ctx, cancel := r.WithTimeout(ctx)
+	defer cancel()
 
 	u := entity.User{
 		ID:                0,
 		Login:             "",
 		Name:              "",
+		Role:              "",
+		AuthProvider:      "",
 		Password:          "",
 		EncryptedPassword: "",
 	}
-	if err := r.Pool.QueryRow(context.Background(),
-		"SELECT id, login, name, encrypted_password FROM users WHERE id = $1",
-		userID,
+
+	if err := r.Pool.QueryRow(ctx,
+		"SELECT id, login, name, role, auth_provider, encrypted_password FROM users WHERE "+condition,
+		value,
 	).Scan(
 		&u.ID,
 		&u.Login,
 		&u.Name,
+		&u.Role,
+		&u.AuthProvider,
 		&u.EncryptedPassword,
 	); err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
+		if errors.Is(err, pgx.ErrNoRows) {
 			return entity.User{}, nil
 		}
 
@@ -148,44 +176,14 @@ func (r *userRepo) FindByID(userID uint64) (entity.User, error) {
 	return u, nil
 }
 
-// FindByLogin Поиск пользователя по логину
-func (r *userRepo) FindByLogin(login string) (entity.User, error) {
-	u := entity.User{
-		ID:                0,
-		Login:             "",
-		Name:              "",
-		Password:          "",
-		EncryptedPassword: "",
-	}
-
-	// не админ ли это?
-	if strings.EqualFold(login, r.superAdminLogin) {
-		u = r.AdminUser()
-	} else {
-		if err := r.Pool.QueryRow(context.Background(),
-			"SELECT id, login, name, encrypted_password FROM users WHERE login = $1",
-			login,
-		).Scan(
-			&u.ID,
-			&u.Login,
-			&u.Name,
-			&u.EncryptedPassword,
-		); err != nil {
-			if errors.Is(err, sql.ErrNoRows) {
-				return entity.User{}, nil
-			}
-
-			return entity.User{}, err
-		}
-	}
+// GetUsers Получить список пользователей. Может выполняться на реплике, в отличие от поиска конкретного
+// пользователя, который нужен при входе и сразу после изменения
+func (r *userRepo) GetUsers(ctx context.Context) ([]entity.User, error) {
+	ctx, cancel := r.WithTimeout(ctx)
+	defer cancel()
 
-	return u, nil
-}
-
-// GetUsers Получить список пользователей
-func (r *userRepo) GetUsers() ([]entity.User, error) {
-	rows, err := r.Pool.Query(context.Background(),
-		`SELECT id, login, name, encrypted_password FROM users`)
+	rows, err := r.ReadPool().Query(ctx,
+		`SELECT id, login, name, role, auth_provider, encrypted_password FROM users ORDER BY id`)
 	if err != nil {
 
 		return nil, err
@@ -196,7 +194,7 @@ func (r *userRepo) GetUsers() ([]entity.User, error) {
 
 	for rows.Next() {
 		var usr entity.User
-		err = rows.Scan(&usr.ID, &usr.Login, &usr.Name, &usr.EncryptedPassword)
+		err = rows.Scan(&usr.ID, &usr.Login, &usr.Name, &usr.Role, &usr.AuthProvider, &usr.EncryptedPassword)
 
 		if err != nil {
 			return nil, err
@@ -210,29 +208,35 @@ func (r *userRepo) GetUsers() ([]entity.User, error) {
 	return users, nil
 }
 
-func (r *userRepo) Remove(_ uint64) error {
+func (r *userRepo) Remove(_ context.Context, _ uint64) error {
 
 	return errors.New("not implemeted")
 }
 
-func (r *userRepo) Update(_ entity.User) error {
+// Update Изменить имя и роль пользователя
+func (r *userRepo) Update(ctx context.Context, user entity.User) error {
+	ctx, cancel := r.WithTimeout(ctx)
+	defer cancel()
 
-	return errors.New("not implemeted")
-}
+	user.Name = strings.TrimSpace(user.Name)
+	user.Role = strings.TrimSpace(user.Role)
 
-// AdminUser - Фейковый пользователь - админ
-func (r *userRepo) AdminUser() entity.User {
-	user := entity.User{
-		ID:                r.superAdminID,
-		Name:              "admin",
-		Login:             r.superAdminLogin,
-		Password:          r.superAdminPassword,
-		EncryptedPassword: "",
+	if err := validation.ValidateStruct(
+		&user,
+		validation.Field(&user.Name, validation.Required),
+		validation.Field(&user.Role, validation.Required, validation.In(entity.RoleAdmin, entity.RoleUser)),
+	); err != nil {
+		return err
 	}
 
-	if err := user.Prepare(true); err != nil {
-		r.logger.Error("user prepare error %v", err)
+	tag, err := r.Pool.Exec(ctx, "UPDATE users SET name=$1, role=$2 WHERE id=$3", user.Name, user.Role, user.ID)
+	if err != nil {
+		return err
 	}
 
-	return user
+	if tag.RowsAffected() == 0 {
+		return repo.ErrUserNotFound
+	}
+
+	return nil
 }
@@ -0,0 +1,323 @@
+package segment
+
+import (
+	"bufio"
+	"container/heap"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/n-r-w/log-server-v2/internal/domain/entity"
+)
+
+// Как часто при чтении сегмента проверять, не отменен ли поиск
+const cancelCheckInterval = 1024
+
+// Find Записи упорядочены по убыванию LogTime и ID, как и в PostgreSQL. Сегменты читаются без блокировки записи
+func (s *Store) Find(ctx context.Context, query entity.LogQuery) (records []entity.LogRecord, limited bool, err error) {
+	limit := query.Limit
+	if limit <= 0 || limit > s.maxLogRecordsResult {
+		limit = s.maxLogRecordsResult
+	}
+
+	segments := s.snapshot()
+
+	// сначала сегменты с самыми новыми записями: когда набрано limit+1 записей,
+	// сегменты, в которых все записи старее, можно не читать
+	sort.Slice(segments, func(i, j int) bool {
+		return segments[i].maxTime > segments[j].maxTime
+	})
+
+	m := newMatcher(query)
+	found := &recordHeap{}
+
+	for _, seg := range segments {
+		if seg.count == 0 || !m.overlaps(seg) {
+			continue
+		}
+		if found.Len() > limit && seg.maxTime < (*found)[0].LogTime {
+			continue
+		}
+
+		if err := s.scan(ctx, seg, func(rec storedRecord) {
+			if !m.match(rec) {
+				return
+			}
+
+			if found.Len() <= limit {
+				heap.Push(found, rec)
+			} else if less((*found)[0], rec) {
+				(*found)[0] = rec
+				heap.Fix(found, 0)
+			}
+		}); err != nil {
+			return nil, false, err
+		}
+	}
+
+	limited = found.Len() > limit
+	if limited {
+		heap.Pop(found)
+	}
+
+	records = make([]entity.LogRecord, found.Len())
+	for i := len(records) - 1; i >= 0; i-- {
+		rec := heap.Pop(found).(storedRecord)
+		records[i] = entity.LogRecord{
+			ID:       rec.ID,
+			LogTime:  time.Unix(0, rec.LogTime).UTC(),
+			RealTime: time.Unix(0, rec.RealTime).UTC(),
+			Level:    rec.Level,
+			Host:     rec.Host,
+			Source:   rec.Source,
+			Message1: rec.Message1,
+			Message2: rec.Message2,
+			Message3: rec.Message3,
+		}
+	}
+
+	return records, limited, nil
+}
+
+func (s *Store) Count(ctx context.Context, query entity.LogQuery, group string) ([]entity.LogCount, error) {
+	key, err := countKey(group)
+	if err != nil {
+		return nil, err
+	}
+
+	query.Cursor = nil
+	m := newMatcher(query)
+	counts := make(map[string]uint64)
+
+	for _, seg := range s.snapshot() {
+		if seg.count == 0 || !m.overlaps(seg) {
+			continue
+		}
+
+		if err := s.scan(ctx, seg, func(rec storedRecord) {
+			if m.match(rec) {
+				counts[key(rec)]++
+			}
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	result := make([]entity.LogCount, 0, len(counts))
+	for k, n := range counts {
+		result = append(result, entity.LogCount{
+			Key:   k,
+			Count: n,
+		})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Key < result[j].Key
+	})
+
+	return result, nil
+}
+
+// countKey Ключ группы для записи
+func countKey(group string) (func(rec storedRecord) string, error) {
+	switch group {
+	case entity.LogGroupLevel:
+		return func(rec storedRecord) string { return strconv.Itoa(rec.Level) }, nil
+	case entity.LogGroupHost:
+		return func(rec storedRecord) string { return rec.Host }, nil
+	case entity.LogGroupSource:
+		return func(rec storedRecord) string { return rec.Source }, nil
+	case entity.LogGroupHour:
+		return func(rec storedRecord) string {
+			return time.Unix(0, rec.LogTime).UTC().Truncate(time.Hour).Format(time.RFC3339)
+		}, nil
+	case entity.LogGroupDay:
+		return func(rec storedRecord) string {
+			t := time.Unix(0, rec.LogTime).UTC()
+
+			return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC).Format(time.RFC3339)
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown log group %q", group)
+	}
+}
+
+// snapshot Сегменты на момент начала поиска
+func (s *Store) snapshot() []segment {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	segments := make([]segment, len(s.segments))
+	copy(segments, s.segments)
+
+	return segments
+}
+
+// scan Чтение записей сегмента до размера, известного на момент начала поиска
+func (s *Store) scan(ctx context.Context, seg segment, fn func(rec storedRecord)) error {
+	f, err := os.Open(seg.path)
+	if err != nil {
+		return fmt.Errorf("segment store: %w", err)
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(io.NewSectionReader(f, int64(len(segmentMagic)), seg.size-int64(len(segmentMagic))))
+
+	n := 0
+	_, err = readFrames(r, func(rec storedRecord) error {
+		n++
+		if n%cancelCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return err //nolint:wrapcheck
+			}
+		}
+
+		fn(rec)
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("segment store: %s: %w", seg.path, err)
+	}
+
+	return ctx.Err() //nolint:wrapcheck
+}
+
+// matcher Условия поиска, подготовленные для проверки записей
+type matcher struct {
+	query      entity.LogQuery
+	from       int64
+	to         int64
+	cursorTime int64
+	message    string
+}
+
+func newMatcher(query entity.LogQuery) *matcher {
+	m := &matcher{
+		query:      query,
+		from:       0,
+		to:         0,
+		cursorTime: 0,
+		message:    strings.ToLower(query.Message),
+	}
+	if !query.TimeFrom.IsZero() {
+		m.from = query.TimeFrom.UnixNano()
+	}
+	if !query.TimeTo.IsZero() {
+		m.to = query.TimeTo.UnixNano()
+	}
+	if query.Cursor != nil {
+		m.cursorTime = query.Cursor.LogTime.UnixNano()
+	}
+
+	return m
+}
+
+// overlaps Могут ли в сегменте быть подходящие записи
+func (m *matcher) overlaps(seg segment) bool {
+	if !m.query.TimeFrom.IsZero() && seg.maxTime < m.from {
+		return false
+	}
+	if !m.query.TimeTo.IsZero() && seg.minTime > m.to {
+		return false
+	}
+	if m.query.Cursor != nil && seg.minTime > m.cursorTime {
+		return false
+	}
+
+	return true
+}
+
+func (m *matcher) match(rec storedRecord) bool {
+	q := &m.query
+
+	if !q.TimeFrom.IsZero() && rec.LogTime < m.from {
+		return false
+	}
+	if !q.TimeTo.IsZero() && rec.LogTime > m.to {
+		return false
+	}
+	if len(q.Levels) > 0 && !containsInt(q.Levels, rec.Level) {
+		return false
+	}
+	if q.MinLevel > 0 && rec.Level < q.MinLevel {
+		return false
+	}
+	if q.MaxLevel > 0 && rec.Level > q.MaxLevel {
+		return false
+	}
+	if len(q.Hosts) > 0 && !containsString(q.Hosts, rec.Host) {
+		return false
+	}
+	if len(q.Sources) > 0 && !containsString(q.Sources, rec.Source) {
+		return false
+	}
+	if m.message != "" &&
+		!strings.Contains(strings.ToLower(rec.Message1), m.message) &&
+		!strings.Contains(strings.ToLower(rec.Message2), m.message) &&
+		!strings.Contains(strings.ToLower(rec.Message3), m.message) {
+		return false
+	}
+	if q.Cursor != nil && !older(rec.LogTime, rec.ID, m.cursorTime, q.Cursor.ID) {
+		return false
+	}
+
+	return true
+}
+
+// less Запись a расположена в журнале после b (старее)
+func less(a, b storedRecord) bool {
+	return older(a.LogTime, a.ID, b.LogTime, b.ID)
+}
+
+func older(timeA int64, idA uint64, timeB int64, idB uint64) bool {
+	if timeA != timeB {
+		return timeA < timeB
+	}
+
+	return idA < idB
+}
+
+// recordHeap Найденные записи. В вершине самая старая, которая первой вытесняется более новой
+type recordHeap []storedRecord
+
+func (h recordHeap) Len() int           { return len(h) }
+func (h recordHeap) Less(i, j int) bool { return less(h[i], h[j]) }
+func (h recordHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *recordHeap) Push(x interface{}) {
+	*h = append(*h, x.(storedRecord))
+}
+
+func (h *recordHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+
+	return x
+}
+
+func containsInt(values []int, v int) bool {
+	for _, x := range values {
+		if x == v {
+			return true
+		}
+	}
+
+	return false
+}
+
+func containsString(values []string, v string) bool {
+	for _, x := range values {
+		if x == v {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,10 @@
+package segment
+
+type Option func(*Store)
+
+// SegmentSize Размер сегмента в байтах, после которого записи пишутся в новый сегмент
+func SegmentSize(n int64) Option {
+	return func(s *Store) {
+		s.segmentSize = n
+	}
+}
@@ -0,0 +1,410 @@
+// Package segment Встроенное хранилище журнала в файлах-сегментах, без внешней БД. Подходит для установки
+// на одном сервере и для проверки сервера без PostgreSQL.
+// Записи дописываются в конец текущего сегмента, после превышения размера создается новый сегмент.
+// Для каждого сегмента в памяти хранится диапазон времени его записей, поэтому при поиске по времени
+// читаются только подходящие сегменты
+package segment
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/n-r-w/log-server-v2/internal/domain/entity"
+	"github.com/n-r-w/log-server-v2/pkg/logger"
+)
+
+const (
+	defaultSegmentSize = 64 << 20
+
+	segmentExt = ".seg"
+	// Заголовок файла сегмента: формат и его версия
+	segmentMagic = "LSSEG001"
+	// Заголовок записи: длина и контрольная сумма CRC32
+	frameHeaderSize = 8
+	// Запись большего размера считается повреждением файла
+	maxFrameSize = 256 << 20
+)
+
+// errCorrupted Недописанная или поврежденная запись
+var errCorrupted = errors.New("segment is corrupted")
+
+// storedRecord Запись в файле. Время хранится в наносекундах UTC
+type storedRecord struct {
+	ID       uint64 `json:"i"`
+	LogTime  int64  `json:"t"`
+	RealTime int64  `json:"r"`
+	Level    int    `json:"l"`
+	Host     string `json:"h,omitempty"`
+	Source   string `json:"s,omitempty"`
+	Message1 string `json:"m1"`
+	Message2 string `json:"m2,omitempty"`
+	Message3 string `json:"m3,omitempty"`
+}
+
+// segment Файл сегмента. Поиск читает файл только до size, поэтому запись в конец сегмента
+// не мешает параллельному поиску
+type segment struct {
+	path    string
+	size    int64
+	count   int
+	minTime int64
+	maxTime int64
+}
+
+// Store Хранилище журнала. Реализует интерфейс usecase.LogInterface
+type Store struct {
+	dir                 string
+	maxLogRecordsResult int
+	segmentSize         int64
+	logger              logger.Interface
+
+	mu sync.RWMutex
+	// последний сегмент - текущий, в него идет запись
+	segments []segment
+	active   *os.File
+	lastID   uint64
+}
+
+// New Открыть хранилище в каталоге dir. Если каталога нет, то он создается. Недописанные при аварийной
+// остановке записи в конце последнего сегмента отбрасываются
+func New(dir string, maxLogRecordsResult int, logger logger.Interface, options ...Option) (*Store, error) {
+	s := &Store{
+		dir:                 dir,
+		maxLogRecordsResult: maxLogRecordsResult,
+		segmentSize:         defaultSegmentSize,
+		logger:              logger,
+		segments:            nil,
+		active:              nil,
+		lastID:              0,
+	}
+
+	for _, opt := range options {
+		opt(s)
+	}
+
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("segment store: %w", err)
+	}
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*"+segmentExt))
+	if err != nil {
+		return nil, fmt.Errorf("segment store: %w", err)
+	}
+	// имя сегмента - ID его первой записи с ведущими нулями, поэтому порядок имен совпадает с порядком записи
+	sort.Strings(paths)
+
+	for i, path := range paths {
+		seg, lastID, fileSize, err := openSegment(path)
+		if err != nil {
+			return nil, fmt.Errorf("segment store: %s: %w", path, err)
+		}
+
+		if seg.size < fileSize {
+			if i == len(paths)-1 {
+				// дописывать можно только после последней целой записи
+				if err := os.Truncate(path, seg.size); err != nil {
+					return nil, fmt.Errorf("segment store: %w", err)
+				}
+				logger.Warn("segment store: %s truncated to %d bytes after incomplete write", path, seg.size)
+			} else {
+				logger.Error("segment store: %s is corrupted after %d bytes, the rest is ignored", path, seg.size)
+			}
+		}
+
+		if lastID > s.lastID {
+			s.lastID = lastID
+		}
+		s.segments = append(s.segments, seg)
+	}
+
+	if len(s.segments) == 0 {
+		if err := s.createSegment(); err != nil {
+			return nil, err
+		}
+
+		return s, nil
+	}
+
+	s.active, err = os.OpenFile(s.segments[len(s.segments)-1].path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return nil, fmt.Errorf("segment store: %w", err)
+	}
+
+	return s, nil
+}
+
+// PoolSize Запись идет в один файл
+func (s *Store) PoolSize() int {
+	return 1
+}
+
+func (s *Store) Insert(ctx context.Context, records []entity.LogRecord) error {
+	for _, lr := range records {
+		if err := lr.Validate(); err != nil {
+			return err //nolint:wrapcheck
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.active == nil {
+		return fmt.Errorf("segment store is closed")
+	}
+
+	now := time.Now().UTC().UnixNano()
+	id := s.lastID
+
+	var data bytes.Buffer
+	minTime, maxTime := int64(0), int64(0)
+	for i, lr := range records {
+		id++
+		logTime := lr.LogTime.UTC().UnixNano()
+		if i == 0 || logTime < minTime {
+			minTime = logTime
+		}
+		if i == 0 || logTime > maxTime {
+			maxTime = logTime
+		}
+
+		if err := writeFrame(&data, storedRecord{
+			ID:       id,
+			LogTime:  logTime,
+			RealTime: now,
+			Level:    lr.Level,
+			Host:     lr.Host,
+			Source:   lr.Source,
+			Message1: lr.Message1,
+			Message2: lr.Message2,
+			Message3: lr.Message3,
+		}); err != nil {
+			return err
+		}
+	}
+
+	if data.Len() == 0 {
+		return nil
+	}
+
+	seg := &s.segments[len(s.segments)-1]
+	if seg.count > 0 && seg.size+int64(data.Len()) > s.segmentSize {
+		if err := s.createSegment(); err != nil {
+			return err
+		}
+		seg = &s.segments[len(s.segments)-1]
+	}
+
+	if _, err := s.active.Write(data.Bytes()); err != nil {
+		// убираем то, что успело записаться, чтобы следующие записи шли после целой записи
+		_ = s.active.Truncate(seg.size)
+
+		return fmt.Errorf("segment store: %w", err)
+	}
+	if err := s.active.Sync(); err != nil {
+		_ = s.active.Truncate(seg.size)
+
+		return fmt.Errorf("segment store: %w", err)
+	}
+
+	if seg.count == 0 || minTime < seg.minTime {
+		seg.minTime = minTime
+	}
+	if seg.count == 0 || maxTime > seg.maxTime {
+		seg.maxTime = maxTime
+	}
+	seg.count += len(records)
+	seg.size += int64(data.Len())
+	s.lastID = id
+
+	return nil
+}
+
+// Close Закрыть текущий сегмент. Вызывается после остановки записи
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.active == nil {
+		return nil
+	}
+
+	err := s.active.Close()
+	s.active = nil
+
+	return err //nolint:wrapcheck
+}
+
+// createSegment Начать новый сегмент. Предыдущий сегмент больше не меняется
+func (s *Store) createSegment() error {
+	path := filepath.Join(s.dir, fmt.Sprintf("%020d%s", s.lastID+1, segmentExt))
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE|os.O_EXCL, 0o640)
+	if err != nil {
+		return fmt.Errorf("segment store: %w", err)
+	}
+
+	if _, err := f.Write([]byte(segmentMagic)); err != nil {
+		_ = f.Close()
+		_ = os.Remove(path)
+
+		return fmt.Errorf("segment store: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		_ = os.Remove(path)
+
+		return fmt.Errorf("segment store: %w", err)
+	}
+
+	if s.active != nil {
+		_ = s.active.Close()
+	}
+	s.active = f
+	s.segments = append(s.segments, segment{
+		path:    path,
+		size:    int64(len(segmentMagic)),
+		count:   0,
+		minTime: 0,
+		maxTime: 0,
+	})
+
+	return nil
+}
+
+// openSegment Прочитать сегмент целиком. size у результата - размер до первой недописанной или поврежденной записи
+func openSegment(path string) (seg segment, lastID uint64, fileSize int64, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return segment{}, 0, 0, err //nolint:wrapcheck
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return segment{}, 0, 0, err //nolint:wrapcheck
+	}
+
+	seg = segment{
+		path:    path,
+		size:    0,
+		count:   0,
+		minTime: 0,
+		maxTime: 0,
+	}
+
+	if _, err := strconv.ParseUint(strings.TrimSuffix(filepath.Base(path), segmentExt), 10, 64); err != nil {
+		return segment{}, 0, 0, fmt.Errorf("unexpected segment name")
+	}
+
+	magic := make([]byte, len(segmentMagic))
+	if _, err := io.ReadFull(f, magic); err != nil || string(magic) != segmentMagic {
+		return segment{}, 0, 0, fmt.Errorf("unknown segment format")
+	}
+
+	n, err := readFrames(bufio.NewReader(f), func(rec storedRecord) error {
+		if seg.count == 0 || rec.LogTime < seg.minTime {
+			seg.minTime = rec.LogTime
+		}
+		if seg.count == 0 || rec.LogTime > seg.maxTime {
+			seg.maxTime = rec.LogTime
+		}
+		seg.count++
+		lastID = rec.ID
+
+		return nil
+	})
+	if err != nil && !errors.Is(err, errCorrupted) {
+		return segment{}, 0, 0, err
+	}
+	seg.size = int64(len(segmentMagic)) + n
+
+	return seg, lastID, info.Size(), nil
+}
+
+func writeFrame(w *bytes.Buffer, rec storedRecord) error {
+	payload, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("segment store: %w", err)
+	}
+
+	var header [frameHeaderSize]byte
+	binary.LittleEndian.PutUint32(header[0:4], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(header[4:8], crc32.ChecksumIEEE(payload))
+	w.Write(header[:])
+	w.Write(payload)
+
+	return nil
+}
+
+// readFrames Чтение записей до конца r. Возвращает размер прочитанных целых записей.
+// Если встретилась недописанная или поврежденная запись, то ошибка errCorrupted
+func readFrames(r io.Reader, fn func(rec storedRecord) error) (int64, error) {
+	var (
+		read    int64
+		header  [frameHeaderSize]byte
+		payload []byte
+	)
+
+	for {
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			if errors.Is(err, io.EOF) {
+				return read, nil
+			}
+			if errors.Is(err, io.ErrUnexpectedEOF) {
+				return read, errCorrupted
+			}
+
+			return read, err //nolint:wrapcheck
+		}
+
+		size := binary.LittleEndian.Uint32(header[0:4])
+		if size > maxFrameSize {
+			return read, errCorrupted
+		}
+
+		if cap(payload) < int(size) {
+			payload = make([]byte, size)
+		}
+		payload = payload[:size]
+		if _, err := io.ReadFull(r, payload); err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				return read, errCorrupted
+			}
+
+			return read, err //nolint:wrapcheck
+		}
+
+		if crc32.ChecksumIEEE(payload) != binary.LittleEndian.Uint32(header[4:8]) {
+			return read, errCorrupted
+		}
+
+		var rec storedRecord
+		if err := json.Unmarshal(payload, &rec); err != nil {
+			return read, errCorrupted
+		}
+
+		if err := fn(rec); err != nil {
+			return read, err
+		}
+
+		read += int64(frameHeaderSize) + int64(size)
+	}
+}
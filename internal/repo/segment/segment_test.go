@@ -0,0 +1,111 @@
+package segment
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/n-r-w/log-server-v2/internal/domain/entity"
+	"github.com/n-r-w/log-server-v2/internal/repo/logtest"
+	"github.com/n-r-w/log-server-v2/pkg/logger"
+)
+
+func newTestStore(t *testing.T, dir string, options ...Option) *Store {
+	t.Helper()
+
+	s, err := New(dir, logtest.MinRecordsResult, logger.New(), options...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := s.Close(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	return s
+}
+
+func TestConformance(t *testing.T) {
+	s := newTestStore(t, t.TempDir())
+
+	if err := logtest.Conformance(context.Background(), s); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Маленький размер сегмента: записи распределяются по многим файлам
+func TestConformanceSmallSegments(t *testing.T) {
+	dir := t.TempDir()
+	s := newTestStore(t, dir, SegmentSize(512))
+
+	if err := logtest.Conformance(context.Background(), s); err != nil {
+		t.Fatal(err)
+	}
+
+	paths, _ := filepath.Glob(filepath.Join(dir, "*"+segmentExt))
+	if len(paths) < 2 {
+		t.Fatalf("expected several segments, got %d", len(paths))
+	}
+}
+
+func TestReopenAfterIncompleteWrite(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	s, err := New(dir, logtest.MinRecordsResult, logger.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	record := entity.LogRecord{
+		ID:       0,
+		LogTime:  time.Date(2022, 10, 26, 12, 0, 0, 0, time.UTC),
+		RealTime: time.Time{},
+		Level:    entity.LevelInfo,
+		Host:     "host",
+		Source:   "source",
+		Message1: "message",
+		Message2: "",
+		Message3: "",
+	}
+	if err := s.Insert(ctx, []entity.LogRecord{record, record}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// остаток записи, прерванной аварийной остановкой
+	paths, _ := filepath.Glob(filepath.Join(dir, "*"+segmentExt))
+	if len(paths) != 1 {
+		t.Fatalf("expected 1 segment, got %d", len(paths))
+	}
+	f, err := os.OpenFile(paths[0], os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte{0x10, 0, 0}); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	s = newTestStore(t, dir)
+	if err := s.Insert(ctx, []entity.LogRecord{record}); err != nil {
+		t.Fatal(err)
+	}
+
+	found, _, err := s.Find(ctx, entity.LogQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 3 {
+		t.Fatalf("expected 3 records, got %d", len(found))
+	}
+	// ID продолжаются после перезапуска
+	if found[0].ID <= found[1].ID || found[1].ID <= found[2].ID {
+		t.Fatalf("wrong ID order: %d, %d, %d", found[0].ID, found[1].ID, found[2].ID)
+	}
+}
@@ -0,0 +1,272 @@
+package wbuf
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/n-r-w/log-server-v2/internal/domain/entity"
+	"github.com/n-r-w/log-server-v2/pkg/logger"
+)
+
+const (
+	// Сколько записей может ожидать отправки. Лишние отбрасываются, чтобы журнал не тормозил работу сервера
+	selfLogQueueSize = 1000
+	// Максимальный размер пакета записей
+	selfLogBatchSize = 100
+	// Как часто отправлять накопленные записи
+	selfLogFlushInterval = time.Second
+	// На сколько приостанавливается запись после ошибки, например, пока БД недоступна
+	selfLogPause = 30 * time.Second
+)
+
+// selfLogSink Запись собственных предупреждений и ошибок сервера в таблицу журнала через Dispatcher.
+// Защита от рекурсии и лавины сообщений, когда БД недоступна:
+//   - Dispatcher и БД должны использовать исходный журнал, поэтому ошибки записи не попадают обратно в очередь;
+//   - сообщения о работе самого sink выводятся только в исходный журнал;
+//   - после ошибки записи запись приостанавливается на selfLogPause, а новые сообщения не накапливаются;
+//   - при переполнении очереди сообщения отбрасываются, вызывающий код никогда не ждет
+type selfLogSink struct {
+	// поля для atomic в начале структуры, чтобы они были выровнены на 32-битных платформах
+
+	// до какого момента (UnixNano) запись приостановлена
+	pausedUntil int64
+	// сколько сообщений отброшено из-за переполнения очереди с момента последнего предупреждения
+	dropped int64
+
+	base       logger.Interface
+	dispatcher *Dispatcher
+	host       string
+	minLevel   logger.MessageLevel
+
+	queue chan entity.LogRecord
+	stop  chan struct{}
+	done  chan struct{}
+	once  sync.Once
+}
+
+// selfLogger Реализация logger.Interface: все сообщения выводятся в исходный журнал,
+// а предупреждения и ошибки дополнительно сохраняются в БД с источником entity.ServerLogSource
+type selfLogger struct {
+	base   logger.Interface
+	sink   *selfLogSink
+	fields logger.Fields
+}
+
+// NewSelfLogger Журнал, который дублирует предупреждения и ошибки сервера в его собственную таблицу журнала.
+// base - исходный журнал. Его же должны использовать Dispatcher и доступ к БД
+func NewSelfLogger(dispatcher *Dispatcher, base logger.Interface) *selfLogger {
+	host, err := os.Hostname()
+	if err != nil {
+		host = ""
+	}
+
+	sink := &selfLogSink{
+		pausedUntil: 0,
+		dropped:     0,
+		base:        base,
+		dispatcher:  dispatcher,
+		host:        host,
+		minLevel:    logger.WarnLevel,
+		queue:       make(chan entity.LogRecord, selfLogQueueSize),
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+
+	go sink.run()
+
+	return &selfLogger{
+		base:   base,
+		sink:   sink,
+		fields: nil,
+	}
+}
+
+// Stop Отправить накопленные записи и остановить запись. Вызывается до остановки Dispatcher
+func (l *selfLogger) Stop() {
+	l.sink.once.Do(func() {
+		close(l.sink.stop)
+	})
+	<-l.sink.done
+}
+
+func (l *selfLogger) Level(level logger.MessageLevel, message string, args ...interface{}) {
+	// до вывода в исходный журнал, т.к. при FatalLevel он завершает процесс
+	if level >= l.sink.minLevel {
+		text := message
+		if len(args) > 0 {
+			text = fmt.Sprintf(message, args...)
+		}
+		l.sink.write(level, text, l.fields)
+	}
+
+	l.base.Level(level, message, args...)
+}
+
+func (l *selfLogger) Debug(message string, args ...interface{}) {
+	l.Level(logger.DebugLevel, message, args...)
+}
+
+func (l *selfLogger) Info(message string, args ...interface{}) {
+	l.Level(logger.InfoLevel, message, args...)
+}
+
+func (l *selfLogger) Warn(message string, args ...interface{}) {
+	l.Level(logger.WarnLevel, message, args...)
+}
+
+func (l *selfLogger) Error(message string, args ...interface{}) {
+	l.Level(logger.ErrorLevel, message, args...)
+}
+
+func (l *selfLogger) Fatal(message string, args ...interface{}) {
+	l.Level(logger.FatalLevel, message, args...)
+}
+
+func (l *selfLogger) SetLevel(level logger.MessageLevel) {
+	l.base.SetLevel(level)
+}
+
+func (l *selfLogger) WithFields(fields logger.Fields) logger.Interface {
+	merged := make(logger.Fields, len(l.fields)+len(fields))
+	for k, v := range l.fields {
+		merged[k] = v
+	}
+	for k, v := range fields {
+		merged[k] = v
+	}
+
+	return &selfLogger{
+		base:   l.base.WithFields(fields),
+		sink:   l.sink,
+		fields: merged,
+	}
+}
+
+func (l *selfLogger) PanicIf(err error, msg string) {
+	if err != nil {
+		l.Fatal(msg+": %v", err)
+	}
+}
+
+func (l *selfLogger) ErrorIf(err error, msg string) error {
+	if err != nil {
+		l.Error("%s: %v", msg, err)
+	}
+
+	return err
+}
+
+// write Поставить запись в очередь. Никогда не блокируется
+func (s *selfLogSink) write(level logger.MessageLevel, text string, fields logger.Fields) {
+	now := time.Now()
+	if now.UnixNano() < atomic.LoadInt64(&s.pausedUntil) {
+		return
+	}
+
+	// поля запроса (request_id, route и т.п.) сохраняются как JSON во втором сообщении
+	var details string
+	if len(fields) > 0 {
+		if data, err := json.Marshal(fields); err == nil {
+			details = string(data)
+		}
+	}
+
+	record := entity.LogRecord{
+		ID:       0,
+		LogTime:  now.UTC(),
+		RealTime: now.UTC(),
+		Level:    int(level), // уровни logger совпадают с уровнями entity
+		Host:     s.host,
+		Source:   entity.ServerLogSource,
+		Message1: text,
+		Message2: details,
+		Message3: "",
+	}
+
+	select {
+	case s.queue <- record:
+	default:
+		atomic.AddInt64(&s.dropped, 1)
+	}
+}
+
+func (s *selfLogSink) run() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(selfLogFlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]entity.LogRecord, 0, selfLogBatchSize)
+	for {
+		select {
+		case record := <-s.queue:
+			batch = append(batch, record)
+			if len(batch) >= selfLogBatchSize {
+				batch = s.flush(batch)
+			}
+		case <-ticker.C:
+			batch = s.flush(batch)
+		case <-s.stop:
+			// забираем то, что успело попасть в очередь
+			for {
+				select {
+				case record := <-s.queue:
+					batch = append(batch, record)
+				default:
+					s.flush(batch)
+
+					return
+				}
+			}
+		}
+	}
+}
+
+// flush Отправка пакета в Dispatcher. Возвращает пустой пакет для накопления следующих записей
+func (s *selfLogSink) flush(batch []entity.LogRecord) []entity.LogRecord {
+	if dropped := atomic.SwapInt64(&s.dropped, 0); dropped > 0 {
+		s.base.Warn("self logging: %d records dropped, queue is full", dropped)
+	}
+
+	if len(batch) == 0 {
+		return batch
+	}
+
+	if time.Now().UnixNano() < atomic.LoadInt64(&s.pausedUntil) {
+		return batch[:0]
+	}
+
+	// Dispatcher хранит ссылку на пакет до окончания записи, поэтому отдаем копию
+	records := make([]entity.LogRecord, len(batch))
+	copy(records, batch)
+
+	if err := s.dispatcher.insert(context.Background(), records, s.result); err != nil {
+		s.pause(err)
+	}
+
+	return batch[:0]
+}
+
+// result Результат записи в БД. Вызывается из пула Dispatcher
+func (s *selfLogSink) result(err error) {
+	if err != nil {
+		s.pause(err)
+	}
+}
+
+// pause Приостановить запись после ошибки. Сообщение выводится только в исходный журнал
+func (s *selfLogSink) pause(err error) {
+	now := time.Now().UnixNano()
+	prev := atomic.LoadInt64(&s.pausedUntil)
+	// уже приостановлена (в том числе параллельно из другого потока), повторно не сообщаем
+	if prev >= now || !atomic.CompareAndSwapInt64(&s.pausedUntil, prev, now+int64(selfLogPause)) {
+		return
+	}
+
+	s.base.Warn("self logging suspended for %v: %v", selfLogPause, err)
+}
@@ -2,6 +2,7 @@
 package wbuf
 
 import (
+	"context"
 	"fmt"
 	"time"
 
@@ -9,14 +10,54 @@ import (
 	"github.com/n-r-w/log-server-v2/internal/domain/entity"
 	"github.com/n-r-w/log-server-v2/internal/domain/usecase"
 	"github.com/n-r-w/log-server-v2/pkg/logger"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/time/rate"
 )
 
+// Как часто проверять, не стала ли БД доступной, пока запись приостановлена
+const availabilityPoll = 100 * time.Millisecond
+
+var (
+	// errTooManyRequests Превышено ограничение скорости записи
+	errTooManyRequests = &dispatcherError{message: "too many requests", unavailable: false}
+	// errUnavailable Запись приостановлена, пока БД недоступна, и очередь заполнена
+	errUnavailable = &dispatcherError{message: "database is unavailable, write buffer is full", unavailable: true}
+)
+
+// dispatcherError запись отклонена из-за перегрузки или недоступности БД. Методы Overloaded и Unavailable
+// позволяют обработчику запроса выбрать ответ, не завися от пакета wbuf
+type dispatcherError struct {
+	message     string
+	unavailable bool
+}
+
+func (e *dispatcherError) Error() string {
+	return e.message
+}
+
+// Overloaded Превышено ограничение скорости записи
+func (e *dispatcherError) Overloaded() bool {
+	return !e.unavailable
+}
+
+// Unavailable БД недоступна
+func (e *dispatcherError) Unavailable() bool {
+	return e.unavailable
+}
+
+// availability Репозиторий, который сообщает о доступности БД. Реализуется postgres.Postgres
+type availability interface {
+	Available() bool
+}
+
 type Dispatcher struct {
 	log     logger.Interface
 	dbRepo  usecase.LogInterface
 	limiter *rate.Limiter
 	pool    *workerpool.WorkerPool
+	// nil, если репозиторий не сообщает о доступности БД
+	db   availability
+	stop chan struct{}
 }
 
 func NewDispatcher(workerCount int, rateLimit int, rateLimitBurst int, dbRepo usecase.LogInterface, log logger.Interface) *Dispatcher {
@@ -25,13 +66,19 @@ func NewDispatcher(workerCount int, rateLimit int, rateLimitBurst int, dbRepo us
 		dbRepo:  dbRepo,
 		limiter: rate.NewLimiter(rate.Limit(rateLimit), rateLimitBurst),
 		pool:    workerpool.New(workerCount),
+		db:      nil,
+		stop:    make(chan struct{}),
+	}
+	// пока БД недоступна, записи ждут в очереди, а не теряются с ошибкой
+	if db, ok := dbRepo.(availability); ok {
+		d.db = db
 	}
 
 	// Вывод в фоновом режиме информации о размере буфера раз в секунду
 	go func() {
 		for {
 			size := d.pool.WaitingQueueSize()
-			if size > d.pool.Size()*2 {
+			if size > d.pool.Size()*2 && d.available() {
 				d.log.Info("queue size: %d, pool size: %d", size, d.dbRepo.PoolSize())
 			}
 			time.Sleep(time.Second)
@@ -41,43 +88,104 @@ func NewDispatcher(workerCount int, rateLimit int, rateLimitBurst int, dbRepo us
 	return d
 }
 
+// SetRateLimit Изменить ограничение скорости записи без перезапуска сервера
+func (d *Dispatcher) SetRateLimit(rateLimit int, rateLimitBurst int) {
+	d.limiter.SetLimit(rate.Limit(rateLimit))
+	d.limiter.SetBurst(rateLimitBurst)
+}
+
 func (d *Dispatcher) PoolSize() int {
 	return d.dbRepo.PoolSize()
 }
 
 // Insert - реализация интерфейса usecase.LogInterface
-func (d *Dispatcher) Insert(records []entity.LogRecord) error {
+func (d *Dispatcher) Insert(ctx context.Context, records []entity.LogRecord) error {
+	return d.insert(ctx, records, nil)
+}
+
+// insert Асинхронная запись. result, если задан, вызывается после записи в БД с ее результатом
+func (d *Dispatcher) insert(ctx context.Context, records []entity.LogRecord, result func(err error)) error {
 	// Защита от DDOS и в целом от перегрузки сервера БД запросами
 	if !d.limiter.Allow() {
-		return fmt.Errorf("too many requests")
+		return errTooManyRequests
 	}
 	// Контроль за размером очереди пула задач. Если дать ему бескотрольно расти, то можно остаться без свободных ресурсов
-	// Фактически тут мы искусственно увеличиваем время отклика входящих запросов при переполнении очереди задач
+	// Фактически тут мы искусственно увеличиваем время отклика входящих запросов при переполнении очереди задач.
+	// Если же запись приостановлена из-за недоступности БД, то ждать бесполезно
 	for {
 		if d.pool.WaitingQueueSize() > d.pool.Size()*2 {
+			if !d.available() {
+				return errUnavailable
+			}
 			time.Sleep(time.Millisecond)
 		} else {
 			break
 		}
 	}
+	// Запись выполняется после ответа на запрос, поэтому его контекст к этому моменту уже отменен.
+	// Из него берется только трассировка, чтобы запись в БД попала в трассировку запроса
+	dbCtx := trace.ContextWithSpanContext(context.Background(), trace.SpanContextFromContext(ctx))
+
 	// Отправляем задачу на асинхронную обработку
 	d.pool.Submit(func() {
-		if err := d.dbRepo.Insert(records); err != nil {
+		d.waitAvailable()
+		err := d.dbRepo.Insert(dbCtx, records)
+		if err != nil {
 			d.log.Error("worker error: %v", err)
 		}
+		if result != nil {
+			result(err)
+		}
 	})
 
 	return nil
 }
 
 // Find - реализация интерфейса usecase.LogInterface для его подмены
-func (d *Dispatcher) Find(dateFrom time.Time, dateTo time.Time, limit int) (records []entity.LogRecord, limited bool, err error) {
+func (d *Dispatcher) Find(ctx context.Context, query entity.LogQuery) (records []entity.LogRecord, limited bool, err error) {
 	// просто пересылаем запрос
-	return d.dbRepo.Find(dateFrom, dateTo, limit)
+	return d.dbRepo.Find(ctx, query)
+}
+
+// Health Состояние буфера записи. Реализация интерфейса usecase.HealthInterface
+func (d *Dispatcher) Health(ctx context.Context) []entity.ComponentHealth {
+	c := entity.ComponentHealth{
+		Name:    "write buffer",
+		Status:  entity.HealthOK,
+		Details: "",
+	}
+	if !d.available() {
+		c.Status = entity.HealthDegraded
+		c.Details = fmt.Sprintf("paused while database is unavailable, %d batches waiting", d.pool.WaitingQueueSize())
+	}
+
+	return []entity.ComponentHealth{c}
+}
+
+func (d *Dispatcher) available() bool {
+	return d.db == nil || d.db.Available()
+}
+
+// waitAvailable Приостановить запись, пока БД недоступна. При остановке Dispatcher ожидание прерывается,
+// и запись завершается ошибкой
+func (d *Dispatcher) waitAvailable() {
+	for !d.available() {
+		select {
+		case <-time.After(availabilityPoll):
+		case <-d.stop:
+			return
+		}
+	}
+}
+
+// Count - реализация интерфейса usecase.LogInterface для его подмены
+func (d *Dispatcher) Count(ctx context.Context, query entity.LogQuery, group string) ([]entity.LogCount, error) {
+	return d.dbRepo.Count(ctx, query, group)
 }
 
 func (d *Dispatcher) Stop() {
 	d.log.Info("buffer dispatcher stoping...")
+	close(d.stop)
 	d.pool.StopWait()
 	d.log.Info("buffer dispatcher stopped OK")
 }
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS log (
+  id UInt64,
+  record_timestamp DateTime64(6, 'UTC'),
+  real_timestamp DateTime64(6, 'UTC'),
+  level UInt8,
+  host LowCardinality(String),
+  source LowCardinality(String),
+  message1 String,
+  message2 String,
+  message3 String
+)
+ENGINE = MergeTree
+PARTITION BY toYYYYMM(record_timestamp)
+ORDER BY (record_timestamp, id);
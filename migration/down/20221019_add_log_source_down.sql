@@ -0,0 +1,3 @@
+ALTER TABLE public.log
+  DROP COLUMN host,
+  DROP COLUMN source;
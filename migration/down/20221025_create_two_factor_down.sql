@@ -0,0 +1,3 @@
+DROP TABLE login_challenges;
+DROP TABLE two_factor_policy;
+DROP TABLE user_totp;
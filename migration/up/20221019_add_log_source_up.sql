@@ -0,0 +1,3 @@
+ALTER TABLE public.log
+  ADD COLUMN host text,
+  ADD COLUMN source text;
@@ -0,0 +1,10 @@
+CREATE TABLE sessions (
+  id text not null primary key,
+  user_id bigint not null,
+  created_at timestamp without time zone not null,
+  expires_at timestamp without time zone not null,
+  address text not null default '',
+  user_agent text not null default ''
+);
+CREATE INDEX idx_sessions_user_id ON sessions (user_id);
+CREATE INDEX idx_sessions_expires_at ON sessions (expires_at);
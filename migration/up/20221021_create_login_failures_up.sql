@@ -0,0 +1,7 @@
+CREATE TABLE login_failures (
+  key text not null primary key,
+  failures integer not null,
+  last_failure timestamp without time zone not null,
+  locked_until timestamp without time zone not null
+);
+CREATE INDEX idx_login_failures_last_failure ON login_failures (last_failure);
@@ -0,0 +1,15 @@
+CREATE TABLE audit (
+  id bigserial not null primary key,
+  event_time timestamp without time zone not null,
+  actor_id bigint not null,
+  actor text not null,
+  action text not null,
+  target text not null,
+  address text not null,
+  request_id text not null,
+  result text not null,
+  details text not null default ''
+);
+CREATE INDEX idx_audit_event_time ON audit (event_time);
+CREATE INDEX idx_audit_actor ON audit (actor);
+CREATE INDEX idx_audit_target ON audit (target);
@@ -0,0 +1,2 @@
+ALTER TABLE users
+  ADD COLUMN role text not null default 'user';
@@ -0,0 +1,2 @@
+ALTER TABLE users
+  ADD COLUMN auth_provider text not null default '';
@@ -0,0 +1,20 @@
+CREATE TABLE user_totp (
+  user_id bigint not null primary key,
+  secret text not null,
+  enabled boolean not null default false,
+  last_step bigint not null default 0,
+  recovery_codes text[] not null default '{}'
+);
+
+CREATE TABLE two_factor_policy (
+  role text not null primary key,
+  required boolean not null default false
+);
+
+CREATE TABLE login_challenges (
+  id text not null primary key,
+  user_id bigint not null,
+  expires_at timestamp without time zone not null,
+  attempts integer not null default 0
+);
+CREATE INDEX idx_login_challenges_expires_at ON login_challenges (expires_at);
@@ -1,6 +1,7 @@
 package httpserver
 
 import (
+	"crypto/tls"
 	"net"
 	"time"
 )
@@ -30,3 +31,24 @@ func ShutdownTimeout(timeout time.Duration) Option {
 		s.shutdownTimeout = timeout
 	}
 }
+
+// TLS Принимать подключения по TLS. Сертификат и ключ в формате PEM перечитываются при изменении файлов
+func TLS(certFile string, keyFile string) Option {
+	return func(s *Server) {
+		s.tls.certFile = certFile
+		s.tls.keyFile = keyFile
+	}
+}
+
+// ClientCA Проверять сертификаты клиентов по CA из файла (mTLS). require - подключение без сертификата
+// запрещено, иначе сертификат проверяется, только если клиент его передал. Действует только вместе с TLS
+func ClientCA(caFile string, require bool) Option {
+	return func(s *Server) {
+		s.tls.clientCAFile = caFile
+		if require {
+			s.tls.clientAuth = tls.RequireAndVerifyClientCert
+		} else {
+			s.tls.clientAuth = tls.VerifyClientCertIfGiven
+		}
+	}
+}
@@ -3,6 +3,7 @@ package httpserver
 
 import (
 	"context"
+	"crypto/tls"
 	"net"
 	"net/http"
 	"time"
@@ -22,14 +23,24 @@ type Server struct {
 	logger          logger.Interface
 	notify          chan error
 	shutdownTimeout time.Duration
+	tls             *tlsFiles
+
+	// отмена контекста всех запросов, которые не успели завершиться за shutdownTimeout
+	cancelRequests context.CancelFunc
 }
 
 func New(handler http.Handler, logger logger.Interface, opts ...Option) *Server {
+	// базовый контекст запросов. Сам http.Server при остановке его не отменяет
+	baseCtx, cancel := context.WithCancel(context.Background())
+
 	httpServer := &http.Server{
 		Handler:      handler,
 		ReadTimeout:  defaultReadTimeout,
 		WriteTimeout: defaultWriteTimeout,
 		Addr:         defaultAddr,
+		BaseContext: func(net.Listener) context.Context {
+			return baseCtx
+		},
 	}
 
 	s := &Server{
@@ -37,6 +48,14 @@ func New(handler http.Handler, logger logger.Interface, opts ...Option) *Server
 		logger:          logger,
 		notify:          make(chan error, 1),
 		shutdownTimeout: defaultShutdownTimeout,
+		cancelRequests:  cancel,
+		tls: &tlsFiles{
+			certFile:     "",
+			keyFile:      "",
+			clientCAFile: "",
+			clientAuth:   tls.NoClientCert,
+			logger:       logger,
+		},
 	}
 
 	for _, opt := range opts {
@@ -50,7 +69,7 @@ func New(handler http.Handler, logger logger.Interface, opts ...Option) *Server
 
 func (s *Server) start() {
 	go func() {
-		l, err := net.Listen("tcp", s.server.Addr)
+		l, err := s.listen()
 		if err == nil {
 			s.logger.Info("server started on port %s", s.server.Addr)
 			err = s.server.Serve(l)
@@ -60,13 +79,33 @@ func (s *Server) start() {
 	}()
 }
 
+func (s *Server) listen() (net.Listener, error) {
+	if s.tls.certFile == "" {
+		return net.Listen("tcp", s.server.Addr)
+	}
+
+	if err := s.tls.load(); err != nil {
+		return nil, err
+	}
+
+	l, err := net.Listen("tcp", s.server.Addr)
+	if err != nil {
+		return nil, err
+	}
+
+	return tls.NewListener(l, s.tls.serverConfig()), nil
+}
+
 func (s *Server) Notify() <-chan error {
 	return s.notify
 }
 
+// Shutdown Остановка сервера. Запросы, которые не завершились за shutdownTimeout, отменяются через их контекст,
+// что прерывает в том числе запросы к БД
 func (s *Server) Shutdown() error {
 	ctx, cancel := context.WithTimeout(context.Background(), s.shutdownTimeout)
 	defer cancel()
+	defer s.cancelRequests()
 
 	return s.server.Shutdown(ctx)
 }
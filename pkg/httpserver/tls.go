@@ -0,0 +1,144 @@
+package httpserver
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/n-r-w/log-server-v2/pkg/logger"
+)
+
+// Как часто проверять, изменились ли файлы сертификатов
+const tlsCheckInterval = 5 * time.Second
+
+// tlsFiles Сертификат сервера и сертификаты CA для проверки клиентов, которые перечитываются с диска
+// при изменении файлов. Так сертификат можно обновить без перезапуска сервера. Если новые файлы
+// не удалось загрузить, то продолжают использоваться старые
+type tlsFiles struct {
+	certFile     string
+	keyFile      string
+	clientCAFile string
+	clientAuth   tls.ClientAuthType
+	logger       logger.Interface
+
+	mu          sync.Mutex
+	config      *tls.Config
+	modTimes    [3]time.Time
+	lastChecked time.Time
+}
+
+// load Первоначальная загрузка. Ошибка не дает запустить сервер
+func (f *tlsFiles) load() error {
+	modTimes, err := f.fileTimes()
+	if err != nil {
+		return err
+	}
+
+	config, err := f.read()
+	if err != nil {
+		return err
+	}
+
+	f.config = config
+	f.modTimes = modTimes
+	f.lastChecked = time.Now()
+
+	return nil
+}
+
+// serverConfig Конфигурация для tls.NewListener. Настройки для каждого подключения берутся из getConfig
+func (f *tlsFiles) serverConfig() *tls.Config {
+	return &tls.Config{ //nolint:gosec // MinVersion задается в getConfig
+		GetConfigForClient: f.getConfig,
+	}
+}
+
+func (f *tlsFiles) getConfig(*tls.ClientHelloInfo) (*tls.Config, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(f.lastChecked) < tlsCheckInterval {
+		return f.config, nil
+	}
+	f.lastChecked = now
+
+	modTimes, err := f.fileTimes()
+	if err != nil {
+		f.logger.Error("tls certificate check error: %v", err)
+
+		return f.config, nil
+	}
+
+	if modTimes == f.modTimes {
+		return f.config, nil
+	}
+
+	config, err := f.read()
+	if err != nil {
+		// файлы могут быть записаны не полностью, попробуем при следующей проверке
+		f.logger.Error("tls certificate reload error: %v", err)
+
+		return f.config, nil
+	}
+
+	f.config = config
+	f.modTimes = modTimes
+	f.logger.Info("tls certificate reloaded")
+
+	return f.config, nil
+}
+
+func (f *tlsFiles) read() (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(f.certFile, f.keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("load tls certificate: %w", err)
+	}
+
+	config := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   tls.NoClientCert,
+	}
+
+	if f.clientCAFile != "" {
+		data, err := os.ReadFile(f.clientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("load client ca: %w", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, errors.New("load client ca: no certificates found")
+		}
+
+		config.ClientCAs = pool
+		config.ClientAuth = f.clientAuth
+	}
+
+	return config, nil
+}
+
+// fileTimes Время изменения файлов сертификата, ключа и CA
+func (f *tlsFiles) fileTimes() ([3]time.Time, error) {
+	var res [3]time.Time
+
+	for i, name := range []string{f.certFile, f.keyFile, f.clientCAFile} {
+		if name == "" {
+			continue
+		}
+
+		info, err := os.Stat(name)
+		if err != nil {
+			return res, err
+		}
+
+		res[i] = info.ModTime()
+	}
+
+	return res, nil
+}
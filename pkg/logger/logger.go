@@ -2,13 +2,26 @@
 package logger
 
 import (
+	"context"
+	"fmt"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/sirupsen/logrus"
 )
 
 type MessageLevel int
 
+// Fields Структурированные поля сообщения: ID запроса, пользователь, маршрут и т.п.
+type Fields map[string]interface{}
+
+// Форматы вывода
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
 const (
 	DebugLevel = MessageLevel(1)
 	InfoLevel  = MessageLevel(2)
@@ -24,20 +37,105 @@ type Interface interface {
 	Error(message string, args ...interface{})
 	Fatal(message string, args ...interface{})
 	Level(level MessageLevel, message string, args ...interface{})
+	// SetLevel сообщения ниже этого уровня не выводятся
+	SetLevel(level MessageLevel)
+	// WithFields журнал, который добавляет поля ко всем сообщениям. Уровень и формат общие с исходным журналом
+	WithFields(fields Fields) Interface
 	ErrorIf(err error, msg string) error
 	PanicIf(err error, msg string)
 }
 
+// ParseLevel Уровень по названию: debug, info, warn (warning), error, fatal
+func ParseLevel(name string) (MessageLevel, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "debug":
+		return DebugLevel, nil
+	case "info":
+		return InfoLevel, nil
+	case "warn", "warning":
+		return WarnLevel, nil
+	case "error":
+		return ErrorLevel, nil
+	case "fatal":
+		return FatalLevel, nil
+	default:
+		return 0, fmt.Errorf("unknown log level %q, expected debug, info, warn, error or fatal", name)
+	}
+}
+
 type Logger struct {
 	logger *logrus.Logger
+	fields logrus.Fields
 }
 
 func New() *Logger {
 	l := &Logger{
 		logger: logrus.New(),
+		fields: nil,
+	}
+
+	l.logger.SetFormatter(textFormatter())
+
+	return l
+}
+
+// SetFormat Формат вывода: FormatText - текст для чтения человеком, FormatJSON - JSON объект в строке
+// для систем сбора логов. Поля из WithFields выводятся отдельными ключами в обоих форматах
+func (l *Logger) SetFormat(format string) error {
+	switch strings.ToLower(format) {
+	case FormatText:
+		l.logger.SetFormatter(textFormatter())
+	case FormatJSON:
+		l.logger.SetFormatter(&logrus.JSONFormatter{
+			TimestampFormat:   time.RFC3339Nano,
+			DisableTimestamp:  false,
+			DisableHTMLEscape: true,
+			DataKey:           "",
+			FieldMap:          nil,
+			CallerPrettyfier:  nil,
+			PrettyPrint:       false,
+		})
+	default:
+		return fmt.Errorf("unknown log format %q, expected %s or %s", format, FormatText, FormatJSON)
+	}
+
+	return nil
+}
+
+// WithFields Журнал с дополнительными полями
+func (l *Logger) WithFields(fields Fields) Interface {
+	merged := make(logrus.Fields, len(l.fields)+len(fields))
+	for k, v := range l.fields {
+		merged[k] = v
+	}
+	for k, v := range fields {
+		merged[k] = v
+	}
+
+	return &Logger{
+		logger: l.logger,
+		fields: merged,
+	}
+}
+
+type ctxKey struct{}
+
+// NewContext Контекст, содержащий журнал. Так журнал с полями запроса передается обработчикам
+func NewContext(ctx context.Context, l Interface) context.Context {
+	return context.WithValue(ctx, ctxKey{}, l)
+}
+
+// FromContext Журнал из контекста. Если его там нет, то fallback
+func FromContext(ctx context.Context, fallback Interface) Interface {
+	if l, ok := ctx.Value(ctxKey{}).(Interface); ok {
+		return l
 	}
 
-	l.logger.SetFormatter(&logrus.TextFormatter{
+	return fallback
+}
+
+func textFormatter() *logrus.TextFormatter {
+	return &logrus.TextFormatter{
 		ForceColors:               true,
 		DisableColors:             false,
 		ForceQuote:                false,
@@ -50,33 +148,20 @@ func New() *Logger {
 		DisableLevelTruncation:    false,
 		PadLevelText:              false,
 		QuoteEmptyFields:          false,
-	},
-	)
-
-	return l
+	}
 }
 
 func (l *Logger) Level(level MessageLevel, message string, args ...interface{}) {
-	var lv logrus.Level
-	switch level {
-	case DebugLevel:
-		lv = logrus.DebugLevel
-	case InfoLevel:
-		lv = logrus.InfoLevel
-	case WarnLevel:
-		lv = logrus.WarnLevel
-	case ErrorLevel:
-		lv = logrus.ErrorLevel
-	case FatalLevel:
-		lv = logrus.FatalLevel
-	default:
-		lv = logrus.InfoLevel
+	lv := toLogrus(level)
+	entry := logrus.NewEntry(l.logger)
+	if len(l.fields) > 0 {
+		entry = entry.WithFields(l.fields)
 	}
 
 	if len(args) == 0 {
-		l.logger.Log(lv, message)
+		entry.Log(lv, message)
 	} else {
-		l.logger.Logf(lv, message, args...)
+		entry.Logf(lv, message, args...)
 	}
 
 	if level == FatalLevel {
@@ -84,6 +169,28 @@ func (l *Logger) Level(level MessageLevel, message string, args ...interface{})
 	}
 }
 
+// SetLevel Изменить минимальный уровень выводимых сообщений
+func (l *Logger) SetLevel(level MessageLevel) {
+	l.logger.SetLevel(toLogrus(level))
+}
+
+func toLogrus(level MessageLevel) logrus.Level {
+	switch level {
+	case DebugLevel:
+		return logrus.DebugLevel
+	case InfoLevel:
+		return logrus.InfoLevel
+	case WarnLevel:
+		return logrus.WarnLevel
+	case ErrorLevel:
+		return logrus.ErrorLevel
+	case FatalLevel:
+		return logrus.FatalLevel
+	default:
+		return logrus.InfoLevel
+	}
+}
+
 func (l *Logger) Debug(message string, args ...interface{}) {
 	l.Level(DebugLevel, message, args...)
 }
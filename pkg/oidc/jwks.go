@@ -0,0 +1,260 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Максимальный размер JWKS, загружаемого по URL
+const maxJWKSSize = 1 << 20
+
+var errKeyNotFound = errors.New("signing key not found")
+
+// jwk Ключ в формате JSON Web Key (RFC 7517). Поддерживаются только открытые ключи RSA и EC
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	// RSA
+	N string `json:"n"`
+	E string `json:"e"`
+	// EC
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type publicKey struct {
+	kid string
+	alg string
+	key crypto.PublicKey
+}
+
+// keySet Набор открытых ключей провайдера. Источник - локальный файл или URL. Набор перечитывается
+// раз в refreshInterval, а также если токен подписан неизвестным ключом (не чаще раза в minRefreshInterval)
+type keySet struct {
+	source             string
+	client             *http.Client
+	refreshInterval    time.Duration
+	minRefreshInterval time.Duration
+
+	mu       sync.Mutex
+	keys     []publicKey
+	loadedAt time.Time
+}
+
+func newKeySet(source string, client *http.Client, refreshInterval time.Duration, minRefreshInterval time.Duration) *keySet {
+	return &keySet{
+		source:             source,
+		client:             client,
+		refreshInterval:    refreshInterval,
+		minRefreshInterval: minRefreshInterval,
+	}
+}
+
+// find Поиск ключа по kid. Если kid не задан, то возвращаются все ключи, подходящие для алгоритма
+func (s *keySet) find(ctx context.Context, kid string, alg string) ([]crypto.PublicKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+
+	if s.keys == nil || now.Sub(s.loadedAt) > s.refreshInterval {
+		if err := s.load(ctx, now); err != nil && s.keys == nil {
+			return nil, err
+		}
+	}
+
+	keys := s.match(kid, alg)
+	if len(keys) == 0 && now.Sub(s.loadedAt) > s.minRefreshInterval {
+		// провайдер мог сменить ключи
+		if err := s.load(ctx, now); err != nil {
+			return nil, err
+		}
+
+		keys = s.match(kid, alg)
+	}
+
+	if len(keys) == 0 {
+		return nil, errKeyNotFound
+	}
+
+	return keys, nil
+}
+
+func (s *keySet) match(kid string, alg string) []crypto.PublicKey {
+	var keys []crypto.PublicKey
+
+	for _, k := range s.keys {
+		if kid != "" && k.kid != kid {
+			continue
+		}
+
+		if k.alg != "" && k.alg != alg {
+			continue
+		}
+
+		if !keyFitsAlgorithm(k.key, alg) {
+			continue
+		}
+
+		keys = append(keys, k.key)
+	}
+
+	return keys
+}
+
+func (s *keySet) load(ctx context.Context, now time.Time) error {
+	data, err := s.read(ctx)
+	if err != nil {
+		return fmt.Errorf("jwks %s: %w", s.source, err)
+	}
+
+	keys, err := parseJWKS(data)
+	if err != nil {
+		return fmt.Errorf("jwks %s: %w", s.source, err)
+	}
+
+	s.keys = keys
+	s.loadedAt = now
+
+	return nil
+}
+
+func (s *keySet) read(ctx context.Context) ([]byte, error) {
+	if !strings.HasPrefix(s.source, "http://") && !strings.HasPrefix(s.source, "https://") {
+		return os.ReadFile(s.source)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.client.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.source, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	return io.ReadAll(io.LimitReader(resp.Body, maxJWKSSize))
+}
+
+func parseJWKS(data []byte) ([]publicKey, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, err
+	}
+
+	keys := make([]publicKey, 0, len(set.Keys))
+
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		key, err := k.publicKey()
+		if err != nil {
+			// ключи неподдерживаемых типов пропускаются
+			continue
+		}
+
+		keys = append(keys, publicKey{kid: k.Kid, alg: k.Alg, key: key})
+	}
+
+	if len(keys) == 0 {
+		return nil, errors.New("no supported signing keys")
+	}
+
+	return keys, nil
+}
+
+func (k *jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, errors.New("invalid RSA exponent")
+		}
+
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("invalid EC key")
+		}
+
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(b) == 0 {
+		return nil, errors.New("empty key parameter")
+	}
+
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,310 @@
+// Package oidc Проверка токенов OpenID Connect (JWT), выданных внешними провайдерами.
+// Открытые ключи провайдеров загружаются в формате JWKS из локального файла или по URL
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	_ "crypto/sha256" // регистрация хэш-функций для crypto.Hash
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	defaultLeeway             = time.Minute
+	defaultRefreshInterval    = time.Hour
+	defaultMinRefreshInterval = time.Minute
+	defaultHTTPTimeout        = 10 * time.Second
+)
+
+var (
+	errMalformedToken       = errors.New("malformed token")
+	errUnsupportedAlgorithm = errors.New("unsupported token signing algorithm")
+	errInvalidSignature     = errors.New("invalid token signature")
+	errUnknownIssuer        = errors.New("unknown token issuer")
+	errInvalidAudience      = errors.New("invalid token audience")
+	errTokenExpired         = errors.New("token expired")
+	errTokenNotYetValid     = errors.New("token not yet valid")
+)
+
+// Provider Провайдер, токены которого принимаются
+type Provider struct {
+	// Issuer значение claim "iss"
+	Issuer string
+	// Audience допустимое значение claim "aud". Обязательно: иначе принимался бы любой токен провайдера,
+	// выданный для другого приложения
+	Audience string
+	// JWKS путь к файлу или URL с открытыми ключами провайдера
+	JWKS string
+}
+
+// Identity Пользователь, которому выдан токен
+type Identity struct {
+	Issuer  string
+	Subject string
+	Login   string
+	Name    string
+	Roles   []string
+}
+
+// Verifier Проверка токенов
+type Verifier struct {
+	providers map[string]*provider
+
+	loginClaim string
+	nameClaim  string
+	rolesClaim string
+
+	leeway             time.Duration
+	refreshInterval    time.Duration
+	minRefreshInterval time.Duration
+	client             *http.Client
+}
+
+type provider struct {
+	Provider
+	keys *keySet
+}
+
+func New(providers []Provider, opts ...Option) (*Verifier, error) {
+	v := &Verifier{
+		providers:          make(map[string]*provider, len(providers)),
+		loginClaim:         "preferred_username",
+		nameClaim:          "name",
+		rolesClaim:         "groups",
+		leeway:             defaultLeeway,
+		refreshInterval:    defaultRefreshInterval,
+		minRefreshInterval: defaultMinRefreshInterval,
+		client:             &http.Client{Timeout: defaultHTTPTimeout},
+	}
+
+	for _, opt := range opts {
+		opt(v)
+	}
+
+	for _, p := range providers {
+		if p.Issuer == "" || p.Audience == "" || p.JWKS == "" {
+			return nil, errors.New("oidc provider must have issuer, audience and jwks")
+		}
+
+		if _, ok := v.providers[p.Issuer]; ok {
+			return nil, fmt.Errorf("duplicate oidc issuer %s", p.Issuer)
+		}
+
+		v.providers[p.Issuer] = &provider{
+			Provider: p,
+			keys:     newKeySet(p.JWKS, v.client, v.refreshInterval, v.minRefreshInterval),
+		}
+	}
+
+	return v, nil
+}
+
+// Verify Проверка подписи и срока действия токена. Возвращает пользователя, которому выдан токен.
+// ctx ограничивает загрузку ключей провайдера, если их нет в кэше
+func (v *Verifier) Verify(ctx context.Context, token string) (Identity, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return Identity{}, errMalformedToken
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return Identity{}, errMalformedToken
+	}
+
+	claims := make(map[string]interface{})
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return Identity{}, errMalformedToken
+	}
+
+	// провайдер определяется по claim "iss" до проверки подписи, т.к. от него зависит, каким ключом проверять.
+	// Подделать iss без ключа этого провайдера нельзя
+	issuer, _ := claims["iss"].(string)
+	p, ok := v.providers[issuer]
+	if !ok {
+		return Identity{}, errUnknownIssuer
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return Identity{}, errMalformedToken
+	}
+
+	if err = v.verifySignature(ctx, p, header.Alg, header.Kid, []byte(parts[0]+"."+parts[1]), signature); err != nil {
+		return Identity{}, err
+	}
+
+	if err = v.verifyClaims(p, claims, time.Now()); err != nil {
+		return Identity{}, err
+	}
+
+	identity := Identity{
+		Issuer:  issuer,
+		Subject: claimString(claims, "sub"),
+		Login:   claimString(claims, v.loginClaim),
+		Name:    claimString(claims, v.nameClaim),
+		Roles:   claimStrings(claims, v.rolesClaim),
+	}
+
+	if identity.Login == "" {
+		identity.Login = identity.Subject
+	}
+
+	if identity.Login == "" {
+		return Identity{}, errors.New("token has no login claim")
+	}
+
+	return identity, nil
+}
+
+func (v *Verifier) verifySignature(ctx context.Context, p *provider, alg string, kid string, signed []byte, signature []byte) error {
+	hashFunc, ok := algorithmHash(alg)
+	if !ok {
+		return errUnsupportedAlgorithm
+	}
+
+	keys, err := p.keys.find(ctx, kid, alg)
+	if err != nil {
+		return err
+	}
+
+	h := hashFunc.New()
+	h.Write(signed)
+	digest := h.Sum(nil)
+
+	for _, key := range keys {
+		if verifyDigest(key, alg, hashFunc, digest, signature) {
+			return nil
+		}
+	}
+
+	return errInvalidSignature
+}
+
+func (v *Verifier) verifyClaims(p *provider, claims map[string]interface{}, now time.Time) error {
+	exp, ok := claimTime(claims, "exp")
+	if !ok {
+		return errors.New("token has no expiration time")
+	}
+
+	if now.After(exp.Add(v.leeway)) {
+		return errTokenExpired
+	}
+
+	if nbf, ok := claimTime(claims, "nbf"); ok && now.Add(v.leeway).Before(nbf) {
+		return errTokenNotYetValid
+	}
+
+	for _, aud := range claimStrings(claims, "aud") {
+		if aud == p.Audience {
+			return nil
+		}
+	}
+
+	return errInvalidAudience
+}
+
+func algorithmHash(alg string) (crypto.Hash, bool) {
+	switch alg {
+	case "RS256", "PS256", "ES256":
+		return crypto.SHA256, true
+	case "RS384", "PS384", "ES384":
+		return crypto.SHA384, true
+	case "RS512", "PS512", "ES512":
+		return crypto.SHA512, true
+	default:
+		// в том числе "none" и симметричные HS*, которые для внешних провайдеров недопустимы
+		return 0, false
+	}
+}
+
+func keyFitsAlgorithm(key crypto.PublicKey, alg string) bool {
+	switch key.(type) {
+	case *rsa.PublicKey:
+		return strings.HasPrefix(alg, "RS") || strings.HasPrefix(alg, "PS")
+	case *ecdsa.PublicKey:
+		return strings.HasPrefix(alg, "ES")
+	default:
+		return false
+	}
+}
+
+func verifyDigest(key crypto.PublicKey, alg string, hashFunc crypto.Hash, digest []byte, signature []byte) bool {
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if strings.HasPrefix(alg, "PS") {
+			return rsa.VerifyPSS(k, hashFunc, digest, signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash}) == nil
+		}
+
+		return rsa.VerifyPKCS1v15(k, hashFunc, digest, signature) == nil
+	case *ecdsa.PublicKey:
+		// подпись JWS для EC - это склеенные r и s фиксированной длины (RFC 7518, 3.4)
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return false
+		}
+
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+
+		return ecdsa.Verify(k, digest, r, s)
+	default:
+		return false
+	}
+}
+
+func decodeSegment(segment string, dest interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, dest)
+}
+
+func claimString(claims map[string]interface{}, name string) string {
+	s, _ := claims[name].(string)
+
+	return strings.TrimSpace(s)
+}
+
+// claimStrings Значение claim, которое может быть как строкой, так и массивом строк
+func claimStrings(claims map[string]interface{}, name string) []string {
+	switch v := claims[name].(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		res := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				res = append(res, s)
+			}
+		}
+
+		return res
+	default:
+		return nil
+	}
+}
+
+func claimTime(claims map[string]interface{}, name string) (time.Time, bool) {
+	v, ok := claims[name].(float64)
+	if !ok {
+		return time.Time{}, false
+	}
+
+	return time.Unix(int64(v), 0), true
+}
@@ -0,0 +1,237 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Ключи в testdata: открытый в формате JWKS и закрытый, которым подписываются тестовые токены.
+// Ключи созданы только для тестов, сеть не нужна
+const (
+	testIssuer   = "https://idp.example.com/realms/main"
+	testAudience = "log-server"
+	testKid      = "test-key"
+)
+
+func testKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+
+	data, err := os.ReadFile(filepath.Join("testdata", "key.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		t.Fatal("testdata/key.pem: no PEM block")
+	}
+
+	key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return key
+}
+
+func testVerifier(t *testing.T) *Verifier {
+	t.Helper()
+
+	v, err := New([]Provider{{
+		Issuer:   testIssuer,
+		Audience: testAudience,
+		JWKS:     filepath.Join("testdata", "jwks.json"),
+	}}, Leeway(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return v
+}
+
+func encodeSegment(t *testing.T, v interface{}) string {
+	t.Helper()
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// signToken Токен RS256, подписанный тестовым ключом
+func signToken(t *testing.T, key *rsa.PrivateKey, header map[string]interface{}, claims map[string]interface{}) string {
+	t.Helper()
+
+	signed := encodeSegment(t, header) + "." + encodeSegment(t, claims)
+
+	h := crypto.SHA256.New()
+	h.Write([]byte(signed))
+
+	signature, err := rsa.SignPKCS1v15(nil, key, crypto.SHA256, h.Sum(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func validClaims() map[string]interface{} {
+	now := time.Now()
+
+	return map[string]interface{}{
+		"iss":                testIssuer,
+		"aud":                testAudience,
+		"sub":                "0c9e5f5e",
+		"exp":                now.Add(time.Hour).Unix(),
+		"nbf":                now.Add(-time.Minute).Unix(),
+		"preferred_username": "alice",
+		"name":               "Alice",
+		"groups":             []string{"admins"},
+	}
+}
+
+func TestNewRequiresAudience(t *testing.T) {
+	_, err := New([]Provider{{Issuer: testIssuer, Audience: "", JWKS: filepath.Join("testdata", "jwks.json")}})
+	if err == nil {
+		t.Fatal("expected error for provider without audience")
+	}
+}
+
+func TestVerify(t *testing.T) {
+	key := testKey(t)
+	v := testVerifier(t)
+
+	token := signToken(t, key, map[string]interface{}{"alg": "RS256", "kid": testKid}, validClaims())
+
+	identity, err := v.Verify(context.Background(), token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if identity.Issuer != testIssuer || identity.Login != "alice" || identity.Name != "Alice" ||
+		len(identity.Roles) != 1 || identity.Roles[0] != "admins" {
+		t.Fatalf("unexpected identity %+v", identity)
+	}
+
+	// aud может быть массивом
+	claims := validClaims()
+	claims["aud"] = []string{"other", testAudience}
+	if _, err := v.Verify(context.Background(), signToken(t, key, map[string]interface{}{"alg": "RS256", "kid": testKid}, claims)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifyRejects(t *testing.T) {
+	key := testKey(t)
+	v := testVerifier(t)
+	header := map[string]interface{}{"alg": "RS256", "kid": testKid}
+
+	tests := []struct {
+		name     string
+		token    func() string
+		expected error
+	}{
+		{
+			name: "expired",
+			token: func() string {
+				claims := validClaims()
+				claims["exp"] = time.Now().Add(-time.Minute).Unix()
+
+				return signToken(t, key, header, claims)
+			},
+			expected: errTokenExpired,
+		},
+		{
+			name: "not yet valid",
+			token: func() string {
+				claims := validClaims()
+				claims["nbf"] = time.Now().Add(time.Hour).Unix()
+
+				return signToken(t, key, header, claims)
+			},
+			expected: errTokenNotYetValid,
+		},
+		{
+			name: "wrong audience",
+			token: func() string {
+				claims := validClaims()
+				claims["aud"] = "another-app"
+
+				return signToken(t, key, header, claims)
+			},
+			expected: errInvalidAudience,
+		},
+		{
+			name: "no audience",
+			token: func() string {
+				claims := validClaims()
+				delete(claims, "aud")
+
+				return signToken(t, key, header, claims)
+			},
+			expected: errInvalidAudience,
+		},
+		{
+			name: "wrong issuer",
+			token: func() string {
+				claims := validClaims()
+				claims["iss"] = "https://evil.example.com"
+
+				return signToken(t, key, header, claims)
+			},
+			expected: errUnknownIssuer,
+		},
+		{
+			name: "unknown kid",
+			token: func() string {
+				return signToken(t, key, map[string]interface{}{"alg": "RS256", "kid": "other-key"}, validClaims())
+			},
+			expected: errKeyNotFound,
+		},
+		{
+			name: "alg none",
+			token: func() string {
+				return encodeSegment(t, map[string]interface{}{"alg": "none", "kid": testKid}) + "." +
+					encodeSegment(t, validClaims()) + "."
+			},
+			expected: errUnsupportedAlgorithm,
+		},
+		{
+			name: "changed claims",
+			token: func() string {
+				token := signToken(t, key, header, validClaims())
+				claims := validClaims()
+				claims["preferred_username"] = "admin"
+				parts := strings.Split(token, ".")
+
+				return parts[0] + "." + encodeSegment(t, claims) + "." + parts[2]
+			},
+			expected: errInvalidSignature,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			identity, err := v.Verify(context.Background(), test.token())
+			if !errors.Is(err, test.expected) {
+				t.Fatalf("expected %v, got %v", test.expected, err)
+			}
+			if identity.Login != "" {
+				t.Fatalf("expected empty identity, got %+v", identity)
+			}
+		})
+	}
+}
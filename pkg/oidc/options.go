@@ -0,0 +1,35 @@
+package oidc
+
+import "time"
+
+type Option func(*Verifier)
+
+// Claims Имена claim, из которых берутся логин, имя и роли пользователя. Если claim с логином
+// отсутствует, то используется "sub"
+func Claims(login string, name string, roles string) Option {
+	return func(v *Verifier) {
+		if login != "" {
+			v.loginClaim = login
+		}
+		if name != "" {
+			v.nameClaim = name
+		}
+		if roles != "" {
+			v.rolesClaim = roles
+		}
+	}
+}
+
+// Leeway Допустимое расхождение часов при проверке срока действия токена
+func Leeway(d time.Duration) Option {
+	return func(v *Verifier) {
+		v.leeway = d
+	}
+}
+
+// RefreshInterval Период перечитывания ключей провайдеров
+func RefreshInterval(d time.Duration) Option {
+	return func(v *Verifier) {
+		v.refreshInterval = d
+	}
+}
@@ -0,0 +1,206 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/n-r-w/log-server-v2/pkg/logger"
+)
+
+// ErrUnavailable БД недоступна. Запрос отклонен сразу, без обращения к серверу
+var ErrUnavailable = errors.New("database is unavailable")
+
+// BreakerStatus Состояние защиты от обращений к недоступной БД
+type BreakerStatus struct {
+	// Open БД считается недоступной, запросы отклоняются
+	Open bool
+	// Since Когда БД стала недоступной
+	Since time.Time
+	// Err Последняя ошибка соединения
+	Err error
+}
+
+// breaker Размыкатель цепи. После threshold ошибок соединения подряд БД считается недоступной: запросы
+// отклоняются с ErrUnavailable, не дожидаясь таймаутов. Пока цепь разомкнута, раз в retry выполняется
+// проверка соединения, и после первой успешной запросы снова направляются в БД
+type breaker struct {
+	threshold int
+	retry     time.Duration
+	timeout   time.Duration
+	ping      func(ctx context.Context) error
+	logger    logger.Interface
+
+	mu       sync.Mutex
+	open     bool
+	failures int
+	since    time.Time
+	lastErr  error
+	stopped  bool
+	stop     chan struct{}
+	probing  sync.WaitGroup
+}
+
+// newBreaker threshold < 1 отключает размыкание. timeout - ограничение времени проверки соединения
+func newBreaker(threshold int, retry time.Duration, timeout time.Duration, ping func(ctx context.Context) error, logger logger.Interface) *breaker {
+	return &breaker{
+		threshold: threshold,
+		retry:     retry,
+		timeout:   timeout,
+		ping:      ping,
+		logger:    logger,
+		open:      false,
+		failures:  0,
+		since:     time.Time{},
+		lastErr:   nil,
+		stopped:   false,
+		stop:      make(chan struct{}),
+	}
+}
+
+// allow Можно ли выполнять запрос. nil размыкатель ничего не ограничивает
+func (b *breaker) allow() error {
+	if b == nil {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.open {
+		return fmt.Errorf("%w: %v", ErrUnavailable, b.lastErr)
+	}
+
+	return nil
+}
+
+// done Учесть результат запроса
+func (b *breaker) done(ctx context.Context, err error) {
+	if b == nil || b.threshold < 1 {
+		return
+	}
+
+	// запрос отменила вызывающая сторона (например, клиент разорвал соединение), о БД это ничего не говорит
+	if err != nil && errors.Is(ctx.Err(), context.Canceled) {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !isConnectionError(err) {
+		// ответ от сервера получен, значит соединение есть. Ошибки в самом запросе здесь не важны
+		b.failures = 0
+
+		return
+	}
+
+	b.failures++
+	b.lastErr = err
+	if b.open || b.stopped || b.failures < b.threshold {
+		return
+	}
+
+	b.open = true
+	b.since = time.Now()
+	b.logger.Error("postgres is unavailable after %d failed requests, requests are rejected: %v", b.failures, err)
+
+	b.probing.Add(1)
+	go b.probe()
+}
+
+// probe Проверка соединения, пока цепь разомкнута
+func (b *breaker) probe() {
+	defer b.probing.Done()
+
+	ticker := time.NewTicker(b.retry)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-b.stop:
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), b.timeout)
+		err := b.ping(ctx)
+		cancel()
+
+		b.mu.Lock()
+		if err != nil {
+			b.lastErr = err
+			b.mu.Unlock()
+
+			continue
+		}
+
+		downtime := time.Since(b.since)
+		b.open = false
+		b.failures = 0
+		b.lastErr = nil
+		b.since = time.Time{}
+		b.mu.Unlock()
+
+		b.logger.Info("postgres is available again after %v", downtime.Round(time.Second))
+
+		return
+	}
+}
+
+func (b *breaker) status() BreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return BreakerStatus{
+		Open:  b.open,
+		Since: b.since,
+		Err:   b.lastErr,
+	}
+}
+
+// close Остановить проверку соединения
+func (b *breaker) close() {
+	b.mu.Lock()
+	if b.stopped {
+		b.mu.Unlock()
+
+		return
+	}
+	b.stopped = true
+	close(b.stop)
+	b.mu.Unlock()
+
+	b.probing.Wait()
+}
+
+// isConnectionError Ошибка говорит о недоступности БД, а не о проблеме в самом запросе
+func isConnectionError(err error) bool {
+	if err == nil || errors.Is(err, pgx.ErrNoRows) {
+		return false
+	}
+
+	var scanErr pgx.ScanArgError
+	if errors.As(err, &scanErr) {
+		return false
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && len(pgErr.Code) == 5 {
+		switch pgErr.Code[:2] {
+		case "08", // connection exception
+			"53", // insufficient resources, в том числе too many connections
+			"57": // operator intervention: остановка сервера и т.п.
+			// query_canceled - в том числе statement_timeout. Сервер работает, запрос слишком долгий
+			return pgErr.Code != "57014"
+		default:
+			return false
+		}
+	}
+
+	return true
+}
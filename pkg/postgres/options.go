@@ -22,12 +22,15 @@ func MaxMaxConnIdleTime(n time.Duration) Option {
 	}
 }
 
+// ConnTimeout Ограничение времени установки соединения. Им же ограничена проверка соединения,
+// пока БД недоступна
 func ConnTimeout(n time.Duration) Option {
 	return func(p *Postgres) {
 		p.connTimeout = n
 	}
 }
 
+// StatementTimeout Ограничение времени выполнения запроса на стороне сервера (statement_timeout). 0 - без ограничения
 func StatementTimeout(n time.Duration) Option {
 	return func(p *Postgres) {
 		p.statementTimeout = n
@@ -39,3 +42,54 @@ func ReconnectTimeout(n time.Duration) Option {
 		p.reconnectTimeout = n
 	}
 }
+
+// Tracing Трассировка запросов к БД в OpenTelemetry
+func Tracing(enabled bool) Option {
+	return func(p *Postgres) {
+		p.tracing = enabled
+	}
+}
+
+// QueryTimeout Ограничение времени запроса к БД, если для операции не задано свое
+func QueryTimeout(n time.Duration) Option {
+	return func(p *Postgres) {
+		p.queryTimeout = n
+	}
+}
+
+// Replicas Реплики только для чтения. На них направляются запросы, которые используют ReadPool
+func Replicas(urls []string) Option {
+	return func(p *Postgres) {
+		p.replicaURLs = urls
+	}
+}
+
+// MaxReplicaLag Допустимое отставание реплики от основного сервера. Реплика с большим отставанием не используется,
+// пока не догонит основной сервер
+func MaxReplicaLag(n time.Duration) Option {
+	return func(p *Postgres) {
+		p.maxReplicaLag = n
+	}
+}
+
+// ReplicaCheckInterval Как часто проверять доступность и отставание реплик
+func ReplicaCheckInterval(n time.Duration) Option {
+	return func(p *Postgres) {
+		p.replicaCheckInterval = n
+	}
+}
+
+// BreakerThreshold После скольких ошибок соединения подряд БД считается недоступной. Пока она недоступна,
+// запросы сразу завершаются с ErrUnavailable. Значение меньше 1 отключает эту защиту
+func BreakerThreshold(n int) Option {
+	return func(p *Postgres) {
+		p.breakerThreshold = n
+	}
+}
+
+// BreakerRetry Как часто проверять соединение с недоступной БД
+func BreakerRetry(n time.Duration) Option {
+	return func(p *Postgres) {
+		p.breakerRetry = n
+	}
+}
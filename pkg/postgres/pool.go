@@ -0,0 +1,89 @@
+package postgres
+
+import (
+	"context"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// Pool Пул соединений. Exec, Query, QueryRow и CopyFrom при недоступной БД сразу возвращают ErrUnavailable,
+// а их ошибки соединения учитываются при определении доступности БД. Остальные методы pgxpool.Pool
+// работают без этой защиты
+type Pool struct {
+	*pgxpool.Pool
+
+	// nil, если защита не нужна, например для реплик: их доступность проверяется отдельно
+	breaker *breaker
+}
+
+func (p *Pool) Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	if err := p.breaker.allow(); err != nil {
+		return nil, err
+	}
+
+	tag, err := p.Pool.Exec(ctx, sql, args...)
+	p.breaker.done(ctx, err)
+
+	return tag, err //nolint:wrapcheck
+}
+
+func (p *Pool) CopyFrom(ctx context.Context, tableName pgx.Identifier, columnNames []string, rowSrc pgx.CopyFromSource) (int64, error) {
+	if err := p.breaker.allow(); err != nil {
+		return 0, err
+	}
+
+	n, err := p.Pool.CopyFrom(ctx, tableName, columnNames, rowSrc)
+	p.breaker.done(ctx, err)
+
+	return n, err //nolint:wrapcheck
+}
+
+// Query Учитывается только ошибка самого вызова. Ошибка соединения во время чтения строк проявится
+// в следующих запросах
+func (p *Pool) Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+	if err := p.breaker.allow(); err != nil {
+		return nil, err
+	}
+
+	rows, err := p.Pool.Query(ctx, sql, args...)
+	p.breaker.done(ctx, err)
+
+	return rows, err //nolint:wrapcheck
+}
+
+// QueryRow Результат учитывается при вызове Scan
+func (p *Pool) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+	if err := p.breaker.allow(); err != nil {
+		return errRow{err: err}
+	}
+
+	return &row{
+		ctx:     ctx,
+		row:     p.Pool.QueryRow(ctx, sql, args...),
+		breaker: p.breaker,
+	}
+}
+
+type row struct {
+	ctx     context.Context
+	row     pgx.Row
+	breaker *breaker
+}
+
+func (r *row) Scan(dest ...interface{}) error {
+	err := r.row.Scan(dest...)
+	r.breaker.done(r.ctx, err)
+
+	return err //nolint:wrapcheck
+}
+
+// errRow Строка запроса, который не выполнялся
+type errRow struct {
+	err error
+}
+
+func (r errRow) Scan(...interface{}) error {
+	return r.err
+}
@@ -4,8 +4,10 @@ package postgres
 import (
 	"context"
 	"fmt"
+	"strconv"
 	"time"
 
+	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 	"github.com/n-r-w/log-server-v2/pkg/logger"
 )
@@ -17,44 +19,83 @@ const (
 	defaultConnTimeout        = time.Second * 5
 	defaultStatementTimeout   = time.Second * 5
 	defaultReconnectTimeout   = time.Second
+	defaultQueryTimeout       = time.Second * 10
+	defaultMaxReplicaLag      = time.Second * 10
+	defaultReplicaCheck       = time.Second * 5
+	defaultBreakerThreshold   = 5
+	defaultBreakerRetry       = time.Second * 5
 )
 
 type Postgres struct {
+	// поля для atomic в начале структуры, чтобы они были выровнены на 32-битных платформах
+
+	// счетчик для выбора реплики по кругу
+	nextReplica uint32
+
 	maxConns           int
 	connAttempts       int
 	maxMaxConnIdleTime time.Duration
 	connTimeout        time.Duration
 	statementTimeout   time.Duration
 	reconnectTimeout   time.Duration
+	queryTimeout       time.Duration
+	tracing            bool
+
+	replicaURLs          []string
+	maxReplicaLag        time.Duration
+	replicaCheckInterval time.Duration
+	replicas             []*replica
+	stopReplicas         chan struct{}
+	replicasDone         chan struct{}
+
+	breakerThreshold int
+	breakerRetry     time.Duration
+
+	logger logger.Interface
 
-	Pool *pgxpool.Pool
+	// Pool Основной сервер. Все запросы на изменение и чтение, для которого важна актуальность данных
+	Pool *Pool
 }
 
 func New(url string, logger logger.Interface, options ...Option) (*Postgres, error) {
 	pg := &Postgres{
+		nextReplica:        0,
 		maxConns:           defaultMaxConns,
 		connAttempts:       defaultConnAttempts,
 		maxMaxConnIdleTime: defaultMaxMaxConnIdleTime,
 		connTimeout:        defaultConnTimeout,
 		statementTimeout:   defaultStatementTimeout,
 		reconnectTimeout:   defaultReconnectTimeout,
+		queryTimeout:       defaultQueryTimeout,
+		tracing:            false,
+
+		replicaURLs:          nil,
+		maxReplicaLag:        defaultMaxReplicaLag,
+		replicaCheckInterval: defaultReplicaCheck,
+		replicas:             nil,
+		stopReplicas:         make(chan struct{}),
+		replicasDone:         make(chan struct{}),
+
+		breakerThreshold: defaultBreakerThreshold,
+		breakerRetry:     defaultBreakerRetry,
+
+		logger: logger,
+		Pool:   nil,
 	}
 
 	for _, opt := range options {
 		opt(pg)
 	}
 
-	poolConfig, err := pgxpool.ParseConfig(url)
+	poolConfig, err := pg.poolConfig(url)
 	if err != nil {
-		return nil, fmt.Errorf("pgxpool parse config error: %v", err)
+		return nil, err
 	}
 
-	poolConfig.MaxConnIdleTime = pg.maxMaxConnIdleTime
-	poolConfig.MaxConns = int32(pg.maxConns)
-
+	var pool *pgxpool.Pool
 	connAttempts := pg.connAttempts
 	for connAttempts > 0 {
-		pg.Pool, err = pgxpool.ConnectConfig(context.Background(), poolConfig)
+		pool, err = pgxpool.ConnectConfig(context.Background(), poolConfig)
 		if err == nil {
 			break
 		}
@@ -70,11 +111,65 @@ func New(url string, logger logger.Interface, options ...Option) (*Postgres, err
 		return nil, fmt.Errorf("postgres connection error: %v", err)
 	}
 
+	pg.Pool = &Pool{
+		Pool:    pool,
+		breaker: newBreaker(pg.breakerThreshold, pg.breakerRetry, pg.connTimeout, pool.Ping, logger),
+	}
+
+	if err = pg.connectReplicas(); err != nil {
+		pg.Close()
+
+		return nil, err
+	}
+
 	return pg, nil
 }
 
+// poolConfig Настройки пула соединений, общие для основного сервера и реплик
+func (p *Postgres) poolConfig(url string) (*pgxpool.Config, error) {
+	poolConfig, err := pgxpool.ParseConfig(url)
+	if err != nil {
+		return nil, fmt.Errorf("pgxpool parse config error: %v", err)
+	}
+
+	poolConfig.MaxConnIdleTime = p.maxMaxConnIdleTime
+	poolConfig.MaxConns = int32(p.maxConns)
+	poolConfig.ConnConfig.ConnectTimeout = p.connTimeout
+	if p.statementTimeout > 0 {
+		// ограничение на стороне сервера, на случай если отмена запроса по контексту до него не дошла
+		poolConfig.ConnConfig.RuntimeParams["statement_timeout"] = strconv.FormatInt(p.statementTimeout.Milliseconds(), 10)
+	}
+
+	if p.tracing {
+		// события запросов передаются логгеру pgx только начиная с уровня Info
+		poolConfig.ConnConfig.Logger = newQueryTracer()
+		poolConfig.ConnConfig.LogLevel = pgx.LogLevelInfo
+	}
+
+	return poolConfig, nil
+}
+
+// WithTimeout Контекст запроса к БД, ограниченный по времени QueryTimeout. Запрос прерывается и раньше,
+// если отменен исходный контекст, например клиент разорвал соединение
+func (p *Postgres) WithTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, p.queryTimeout)
+}
+
+// Available Доступна ли БД. Пока недоступна, запросы к основному серверу сразу завершаются с ErrUnavailable
+func (p *Postgres) Available() bool {
+	return !p.Breaker().Open
+}
+
+// Breaker Состояние защиты от обращений к недоступной БД
+func (p *Postgres) Breaker() BreakerStatus {
+	return p.Pool.breaker.status()
+}
+
 func (p *Postgres) Close() {
+	p.closeReplicas()
+
 	if p.Pool != nil {
+		p.Pool.breaker.close()
 		p.Pool.Close()
 	}
 }
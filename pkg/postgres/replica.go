@@ -0,0 +1,177 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// Отставание реплики в секундах. Если реплика получила и применила все изменения, то отставания нет, даже если
+// основной сервер давно ничего не записывал (тогда pg_last_xact_replay_timestamp сильно отстает от now).
+// На сервере, который не является репликой, функции WAL возвращают NULL, и отставание считается нулевым
+const replicaLagSQL = `SELECT CASE
+		WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+		ELSE COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0)
+	END::float8`
+
+// replica Реплика только для чтения
+type replica struct {
+	// поля для atomic в начале структуры, чтобы они были выровнены на 32-битных платформах
+
+	// 1 - реплика доступна и отстает не больше допустимого, 0 - нет, -1 - еще не проверялась
+	healthy int32
+
+	// адрес для журнала, без пароля
+	name string
+	pool *Pool
+}
+
+// ReplicaStatus Состояние реплики
+type ReplicaStatus struct {
+	Name    string
+	Healthy bool
+}
+
+// ReadPool Пул для запросов только на чтение, для которых допустимо отставание данных на MaxReplicaLag.
+// Реплики выбираются по кругу из доступных. Если реплик нет или ни одна не доступна, то возвращается основной пул
+func (p *Postgres) ReadPool() *Pool {
+	n := uint32(len(p.replicas))
+	if n == 0 {
+		return p.Pool
+	}
+
+	start := atomic.AddUint32(&p.nextReplica, 1)
+	for i := uint32(0); i < n; i++ {
+		r := p.replicas[(start+i)%n]
+		if atomic.LoadInt32(&r.healthy) == 1 {
+			return r.pool
+		}
+	}
+
+	return p.Pool
+}
+
+// Replicas Состояние реплик
+func (p *Postgres) Replicas() []ReplicaStatus {
+	status := make([]ReplicaStatus, 0, len(p.replicas))
+	for _, r := range p.replicas {
+		status = append(status, ReplicaStatus{
+			Name:    r.name,
+			Healthy: atomic.LoadInt32(&r.healthy) == 1,
+		})
+	}
+
+	return status
+}
+
+// connectReplicas Подключение к репликам. Недоступная при запуске реплика не мешает запуску: соединения
+// с репликами устанавливаются по мере надобности, а проверка периодически определяет, можно ли ими пользоваться
+func (p *Postgres) connectReplicas() error {
+	fail := func(err error) error {
+		// проверка еще не запущена
+		close(p.replicasDone)
+		p.closeReplicas()
+
+		return err
+	}
+
+	for _, url := range p.replicaURLs {
+		poolConfig, err := p.poolConfig(url)
+		if err != nil {
+			return fail(fmt.Errorf("replica: %w", err))
+		}
+		poolConfig.LazyConnect = true
+
+		pool, err := pgxpool.ConnectConfig(context.Background(), poolConfig)
+		if err != nil {
+			return fail(fmt.Errorf("replica %s: %w", poolConfig.ConnConfig.Host, err))
+		}
+
+		p.replicas = append(p.replicas, &replica{
+			healthy: -1,
+			name:    net.JoinHostPort(poolConfig.ConnConfig.Host, strconv.Itoa(int(poolConfig.ConnConfig.Port))),
+			pool:    &Pool{Pool: pool, breaker: nil},
+		})
+	}
+
+	if len(p.replicas) == 0 {
+		close(p.replicasDone)
+
+		return nil
+	}
+
+	// первая проверка до начала работы, чтобы запросы сразу направлялись на доступные реплики
+	p.checkReplicas()
+
+	go func() {
+		defer close(p.replicasDone)
+
+		ticker := time.NewTicker(p.replicaCheckInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				p.checkReplicas()
+			case <-p.stopReplicas:
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+func (p *Postgres) checkReplicas() {
+	for _, r := range p.replicas {
+		p.checkReplica(r)
+	}
+}
+
+// checkReplica Проверка доступности и отставания реплики. В журнал выводится только изменение состояния
+func (p *Postgres) checkReplica(r *replica) {
+	ctx, cancel := context.WithTimeout(context.Background(), p.replicaCheckInterval)
+	defer cancel()
+
+	var lagSec float64
+	err := r.pool.QueryRow(ctx, replicaLagSQL).Scan(&lagSec)
+	lag := time.Duration(lagSec * float64(time.Second))
+
+	healthy := int32(0)
+	if err == nil && lag <= p.maxReplicaLag {
+		healthy = 1
+	}
+
+	if atomic.SwapInt32(&r.healthy, healthy) == healthy {
+		return
+	}
+
+	switch {
+	case err != nil:
+		p.logger.Warn("postgres replica %s is unavailable, reading from primary: %v", r.name, err)
+	case healthy == 0:
+		p.logger.Warn("postgres replica %s lags behind by %v (max %v), reading from primary", r.name, lag.Round(time.Millisecond), p.maxReplicaLag)
+	default:
+		p.logger.Info("postgres replica %s is available", r.name)
+	}
+}
+
+func (p *Postgres) closeReplicas() {
+	select {
+	case <-p.stopReplicas:
+		return
+	default:
+	}
+
+	close(p.stopReplicas)
+	<-p.replicasDone
+
+	for _, r := range p.replicas {
+		r.pool.Close()
+	}
+}
@@ -0,0 +1,66 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Максимальная длина текста запроса в трассировке. Пакетная вставка логов формирует очень длинные запросы
+const maxTracedStatementLength = 1000
+
+// queryTracer Трассировка запросов. В pgx v4 нет отдельного интерфейса трассировки, но Logger получает
+// контекст запроса, его текст и длительность после выполнения, поэтому span создается задним числом.
+// Запросы трассируются только внутри уже начатой трассировки, фоновые запросы без нее не записываются
+type queryTracer struct {
+	tracer trace.Tracer
+}
+
+func newQueryTracer() *queryTracer {
+	return &queryTracer{
+		tracer: otel.Tracer("github.com/n-r-w/log-server-v2/pkg/postgres"),
+	}
+}
+
+// Log Реализация pgx.Logger
+func (t *queryTracer) Log(ctx context.Context, level pgx.LogLevel, msg string, data map[string]interface{}) {
+	sql, ok := data["sql"].(string)
+	if !ok || !trace.SpanFromContext(ctx).SpanContext().IsValid() {
+		return
+	}
+
+	end := time.Now()
+	start := end
+	if d, ok := data["time"].(time.Duration); ok {
+		start = end.Add(-d)
+	}
+
+	if len(sql) > maxTracedStatementLength {
+		sql = sql[:maxTracedStatementLength] + "..."
+	}
+
+	_, span := t.tracer.Start(ctx, "postgres "+msg,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithTimestamp(start),
+		trace.WithAttributes(
+			semconv.DBSystemPostgreSQL,
+			semconv.DBStatementKey.String(sql),
+		))
+
+	if rowCount, ok := data["rowCount"].(int); ok {
+		span.SetAttributes(attribute.Int("db.rows", rowCount))
+	}
+
+	if level <= pgx.LogLevelError {
+		span.SetStatus(codes.Error, fmt.Sprint(data["err"]))
+	}
+
+	span.End(trace.WithTimestamp(end))
+}
@@ -0,0 +1,187 @@
+package tools
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Алгоритмы хэширования паролей
+const (
+	PasswordBcrypt   = "bcrypt"
+	PasswordArgon2id = "argon2id"
+)
+
+const (
+	defaultArgon2Memory  = 64 * 1024
+	defaultArgon2Time    = 3
+	defaultArgon2Threads = 2
+	argon2SaltSize       = 16
+	argon2KeySize        = 32
+
+	argon2Prefix = "$argon2id$"
+)
+
+// PasswordHasher Генерация и проверка хэшей паролей. Хэш содержит название алгоритма и его параметры:
+// bcrypt в стандартном формате "$2a$...", argon2id в формате PHC "$argon2id$v=19$m=...,t=...,p=...$соль$хэш".
+// Поэтому хэши, созданные разными алгоритмами и с разными параметрами, могут храниться вместе
+type PasswordHasher struct {
+	algorithm  string
+	bcryptCost int
+
+	argon2Memory  uint32
+	argon2Time    uint32
+	argon2Threads uint8
+}
+
+// PasswordOption ...
+type PasswordOption func(*PasswordHasher)
+
+// BcryptCost Сложность bcrypt
+func BcryptCost(cost int) PasswordOption {
+	return func(h *PasswordHasher) {
+		h.bcryptCost = cost
+	}
+}
+
+// Argon2Params Параметры argon2id: память в КБ, количество проходов и потоков
+func Argon2Params(memory uint32, time uint32, threads uint8) PasswordOption {
+	return func(h *PasswordHasher) {
+		h.argon2Memory = memory
+		h.argon2Time = time
+		h.argon2Threads = threads
+	}
+}
+
+// NewPasswordHasher algorithm - алгоритм для новых хэшей: PasswordBcrypt или PasswordArgon2id
+func NewPasswordHasher(algorithm string, opts ...PasswordOption) (*PasswordHasher, error) {
+	h := &PasswordHasher{
+		algorithm:     strings.ToLower(algorithm),
+		bcryptCost:    bcrypt.DefaultCost,
+		argon2Memory:  defaultArgon2Memory,
+		argon2Time:    defaultArgon2Time,
+		argon2Threads: defaultArgon2Threads,
+	}
+
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	switch h.algorithm {
+	case PasswordBcrypt:
+		if h.bcryptCost < bcrypt.MinCost || h.bcryptCost > bcrypt.MaxCost {
+			return nil, fmt.Errorf("bcrypt cost %d is out of range %d..%d", h.bcryptCost, bcrypt.MinCost, bcrypt.MaxCost)
+		}
+	case PasswordArgon2id:
+		if h.argon2Memory == 0 || h.argon2Time == 0 || h.argon2Threads == 0 {
+			return nil, fmt.Errorf("argon2id parameters must be positive")
+		}
+	default:
+		return nil, fmt.Errorf("unknown password hash algorithm %q", algorithm)
+	}
+
+	return h, nil
+}
+
+// Hash Генерация хэша пароля
+func (h *PasswordHasher) Hash(password string) (string, error) {
+	password = strings.TrimSpace(password)
+
+	if h.algorithm == PasswordArgon2id {
+		salt := make([]byte, argon2SaltSize)
+		if _, err := rand.Read(salt); err != nil {
+			return "", err
+		}
+
+		key := argon2.IDKey([]byte(password), salt, h.argon2Time, h.argon2Memory, h.argon2Threads, argon2KeySize)
+
+		return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s", argon2Prefix, argon2.Version,
+			h.argon2Memory, h.argon2Time, h.argon2Threads,
+			base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+	}
+
+	b, err := bcrypt.GenerateFromPassword([]byte(password), h.bcryptCost)
+	if err != nil {
+		return "", fmt.Errorf("failed GenerateFromPassword %v ", err)
+	}
+
+	return string(b), nil
+}
+
+// Compare Подходит ли пароль. Алгоритм определяется по хэшу
+func (h *PasswordHasher) Compare(hash string, password string) bool {
+	if strings.HasPrefix(hash, argon2Prefix) {
+		params, salt, key, err := parseArgon2(hash)
+		if err != nil {
+			return false
+		}
+
+		other := argon2.IDKey([]byte(password), salt, params.time, params.memory, params.threads, uint32(len(key)))
+
+		return subtle.ConstantTimeCompare(key, other) == 1
+	}
+
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+// NeedsRehash Создан ли хэш другим алгоритмом или с другими параметрами. Такой хэш надо пересоздать,
+// когда станет известен пароль, т.е. при успешном входе
+func (h *PasswordHasher) NeedsRehash(hash string) bool {
+	if strings.HasPrefix(hash, argon2Prefix) {
+		if h.algorithm != PasswordArgon2id {
+			return true
+		}
+
+		params, _, _, err := parseArgon2(hash)
+
+		return err != nil || params.memory != h.argon2Memory || params.time != h.argon2Time || params.threads != h.argon2Threads
+	}
+
+	if h.algorithm != PasswordBcrypt {
+		return true
+	}
+
+	cost, err := bcrypt.Cost([]byte(hash))
+
+	return err != nil || cost != h.bcryptCost
+}
+
+type argon2Params struct {
+	memory  uint32
+	time    uint32
+	threads uint8
+}
+
+func parseArgon2(hash string) (params argon2Params, salt []byte, key []byte, err error) {
+	errMalformed := fmt.Errorf("malformed argon2id hash")
+
+	// "", "argon2id", "v=19", "m=...,t=...,p=...", соль, хэш
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return params, nil, nil, errMalformed
+	}
+
+	var version int
+	if _, err = fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, errMalformed
+	}
+
+	if _, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.memory, &params.time, &params.threads); err != nil {
+		return params, nil, nil, errMalformed
+	}
+
+	if salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return params, nil, nil, errMalformed
+	}
+
+	if key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil || len(key) == 0 {
+		return params, nil, nil, errMalformed
+	}
+
+	return params, salt, key, nil
+}
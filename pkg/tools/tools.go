@@ -2,33 +2,16 @@
 package tools
 
 import (
-	"bytes"
-	"compress/flate"
-	"compress/gzip"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"fmt"
-	"io"
-	"strings"
 
 	validation "github.com/go-ozzo/ozzo-validation/v4"
 	"github.com/pkg/errors"
-	"golang.org/x/crypto/bcrypt"
 )
 
-// EncryptPassword Генерация хэша пароля
-func EncryptPassword(s string) (string, error) {
-	b, err := bcrypt.GenerateFromPassword([]byte(strings.TrimSpace(s)), bcrypt.MinCost)
-	if err != nil {
-		return "", fmt.Errorf("failed GenerateFromPassword %v ", err)
-	}
-
-	return string(b), nil
-}
-
-// ComparePassword Подходит ли пароль
-func ComparePassword(encryptedPassword string, password string) bool {
-	return bcrypt.CompareHashAndPassword([]byte(encryptedPassword), []byte(password)) == nil
-}
-
 // RequiredIf Валидатор для проверки по условию
 func RequiredIf(cond bool) validation.RuleFunc {
 	return func(value interface{}) error {
@@ -40,35 +23,19 @@ func RequiredIf(cond bool) validation.RuleFunc {
 	}
 }
 
-// CompressData Сжатие массива данных
-func CompressData(deflateCompression bool, data []byte) (resData []byte, err error) {
-	if data == nil {
-		return []byte{}, nil
-	}
-
-	// алгоритм сжатия
-	var compressor io.WriteCloser
-	// целевой буфер
-	var compressedBuf bytes.Buffer
-
-	// сжимаем по нужному алгоритму
-	if deflateCompression {
-		if compressor, err = flate.NewWriter(&compressedBuf, flate.BestSpeed); err != nil {
-			return nil, errors.Wrap(err, "deflate error")
-		}
-	} else {
-		if compressor, err = gzip.NewWriterLevel(&compressedBuf, gzip.BestSpeed); err != nil {
-			return nil, errors.Wrap(err, "gzip error")
-		}
+// RandomToken Случайная строка из size байт в виде base64 (URL вариант, без выравнивания)
+func RandomToken(size int) (string, error) {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrap(err, "random token error")
 	}
 
-	if _, err := compressor.Write(data); err != nil {
-		return nil, errors.Wrap(err, "compress error")
-	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
 
-	if err := compressor.Close(); err != nil {
-		return nil, errors.Wrap(err, "compress error")
-	}
+// HashToken Хэш токена для хранения на сервере
+func HashToken(token string) string {
+	h := sha256.Sum256([]byte(token))
 
-	return compressedBuf.Bytes(), nil
+	return hex.EncodeToString(h[:])
 }
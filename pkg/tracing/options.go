@@ -0,0 +1,33 @@
+package tracing
+
+type Option func(*Tracing)
+
+// Exporter Куда отправлять трассировки: ExporterNone, ExporterStdout или ExporterOTLP
+func Exporter(name string) Option {
+	return func(t *Tracing) {
+		t.exporter = name
+	}
+}
+
+// OTLPEndpoint Адрес коллектора OTLP/HTTP, например http://localhost:4318. Пустая строка - адрес берется
+// из стандартных переменных окружения OTEL_EXPORTER_OTLP_*
+func OTLPEndpoint(url string) Option {
+	return func(t *Tracing) {
+		t.otlpEndpoint = url
+	}
+}
+
+// ServiceName Имя сервиса в трассировках
+func ServiceName(name string) Option {
+	return func(t *Tracing) {
+		t.serviceName = name
+	}
+}
+
+// SampleRatio Доля запросов, для которых записываются трассировки: от 0 до 1. Если у входящего запроса есть
+// родительская трассировка (traceparent), то решение берется из нее
+func SampleRatio(ratio float64) Option {
+	return func(t *Tracing) {
+		t.sampleRatio = ratio
+	}
+}
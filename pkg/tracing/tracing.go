@@ -0,0 +1,121 @@
+// Package tracing Трассировка запросов OpenTelemetry. Настраивает глобальный TracerProvider и распространение
+// контекста по заголовкам W3C traceparent/tracestate, после чего трассировки доступны через otel.Tracer
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+)
+
+// Куда отправлять трассировки
+const (
+	// ExporterNone трассировки не записываются, но traceparent входящих запросов передается дальше
+	ExporterNone = "none"
+	// ExporterStdout вывод в stdout в виде JSON, для отладки
+	ExporterStdout = "stdout"
+	// ExporterOTLP отправка коллектору по OTLP/HTTP
+	ExporterOTLP = "otlp"
+)
+
+type Tracing struct {
+	exporter     string
+	otlpEndpoint string
+	serviceName  string
+	sampleRatio  float64
+
+	provider *sdktrace.TracerProvider
+}
+
+// New Настройка трассировки. Глобальный распространитель контекста задается всегда, TracerProvider - только
+// если экспорт включен. Иначе используется TracerProvider по умолчанию, который ничего не записывает
+func New(opts ...Option) (*Tracing, error) {
+	t := &Tracing{
+		exporter:     ExporterNone,
+		otlpEndpoint: "",
+		serviceName:  "logserver",
+		sampleRatio:  1,
+		provider:     nil,
+	}
+
+	for _, opt := range opts {
+		opt(t)
+	}
+
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var (
+		exporter sdktrace.SpanExporter
+		err      error
+	)
+
+	switch strings.ToLower(t.exporter) {
+	case "", ExporterNone:
+		return t, nil
+	case ExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case ExporterOTLP:
+		exporter, err = t.otlpExporter()
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q, expected %s, %s or %s", t.exporter, ExporterNone, ExporterStdout, ExporterOTLP)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("trace exporter %s: %w", t.exporter, err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceNameKey.String(t.serviceName)))
+	if err != nil {
+		return nil, fmt.Errorf("trace resource: %w", err)
+	}
+
+	t.provider = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(t.sampleRatio))),
+	)
+	otel.SetTracerProvider(t.provider)
+
+	return t, nil
+}
+
+func (t *Tracing) otlpExporter() (sdktrace.SpanExporter, error) {
+	var opts []otlptracehttp.Option
+
+	if t.otlpEndpoint != "" {
+		u, err := url.Parse(t.otlpEndpoint)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("invalid otlp endpoint %q, expected http(s)://host:port[/path]", t.otlpEndpoint)
+		}
+
+		opts = append(opts, otlptracehttp.WithEndpoint(u.Host))
+		if u.Scheme == "http" {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		if u.Path != "" && u.Path != "/" {
+			opts = append(opts, otlptracehttp.WithURLPath(u.Path))
+		}
+	}
+
+	return otlptracehttp.New(context.Background(), opts...) //nolint:wrapcheck
+}
+
+// Shutdown Отправить накопленные трассировки и остановить экспорт
+func (t *Tracing) Shutdown(ctx context.Context) error {
+	if t.provider == nil {
+		return nil
+	}
+
+	return t.provider.Shutdown(ctx) //nolint:wrapcheck
+}